@@ -0,0 +1,246 @@
+// Command dlqctl inspects, replays and resolves dead-lettered records.
+//
+//	dlqctl list    [filters] [-json]
+//	dlqctl replay  [filters] [-dry-run]
+//	dlqctl resolve [filters] [-note text]
+//
+// Filters are -saga, -order, -type and -ids (comma-separated partition/offset IDs as shown by
+// list). Resolved entries are hidden unless -all is given.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/dlq"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type options struct {
+	topic   string
+	saga    string
+	order   string
+	event   string
+	ids     string
+	all     bool
+	json    bool
+	dryRun  bool
+	note    string
+	idle    time.Duration
+	command string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	opts := options{command: os.Args[1]}
+
+	flags := flag.NewFlagSet(opts.command, flag.ExitOnError)
+	flags.StringVar(&opts.topic, "topic", cfg.Topics.DLQ.Orders, "DLQ topic to work on")
+	flags.StringVar(&opts.saga, "saga", "", "only entries of this saga ID")
+	flags.StringVar(&opts.order, "order", "", "only entries of this order ID")
+	flags.StringVar(&opts.event, "type", "", "only entries of this event type")
+	flags.StringVar(&opts.ids, "ids", "", "only these entries, comma-separated partition/offset")
+	flags.BoolVar(&opts.all, "all", false, "include resolved entries")
+	flags.DurationVar(&opts.idle, "wait", 2*time.Second, "how long to wait for more records before the DLQ is considered read")
+
+	switch opts.command {
+	case "list":
+		flags.BoolVar(&opts.json, "json", false, "print JSON instead of a table")
+	case "replay":
+		flags.BoolVar(&opts.dryRun, "dry-run", false, "only print what would be replayed")
+	case "resolve":
+		flags.StringVar(&opts.note, "note", "", "why the entries were resolved")
+	default:
+		usage()
+	}
+
+	flags.Parse(os.Args[2:])
+
+	filter, err := opts.filter()
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store := dlq.NewStore(cfg.Kafka.Brokers, opts.topic, opts.idle)
+
+	entries, err := store.Entries(ctx)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", opts.topic, err)
+	}
+
+	var selected []dlq.Entry
+	for _, e := range entries {
+		if filter.Match(e) {
+			selected = append(selected, e)
+		}
+	}
+
+	switch opts.command {
+	case "list":
+		if opts.json {
+			err = printJSON(os.Stdout, selected)
+		} else {
+			err = printTable(os.Stdout, selected)
+		}
+	case "replay":
+		err = replay(ctx, cfg, store, selected, opts.dryRun)
+	case "resolve":
+		if isEmpty(filter) {
+			log.Fatalf("Refusing to resolve every entry, pass a filter")
+		}
+
+		if err = store.Resolve(ctx, selected, opts.note); err == nil {
+			fmt.Printf("Resolved %d entries\n", len(selected))
+		}
+	}
+
+	if err != nil {
+		log.Fatalf("%s failed: %v", opts.command, err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlqctl list|replay|resolve [-topic t] [-saga id] [-order id] [-type t] [-ids p/o,...] [-all]")
+	os.Exit(2)
+}
+
+func (o options) filter() (dlq.Filter, error) {
+	f := dlq.Filter{EventType: models.EventType(o.event), IncludeResolved: o.all}
+
+	if o.saga != "" {
+		id, err := uuid.Parse(o.saga)
+		if err != nil {
+			return f, fmt.Errorf("invalid saga ID: %w", err)
+		}
+		f.SagaID = id
+	}
+
+	if o.order != "" {
+		id, err := uuid.Parse(o.order)
+		if err != nil {
+			return f, fmt.Errorf("invalid order ID: %w", err)
+		}
+		f.OrderID = id
+	}
+
+	for _, id := range strings.Split(o.ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			f.IDs = append(f.IDs, id)
+		}
+	}
+
+	return f, nil
+}
+
+func isEmpty(f dlq.Filter) bool {
+	return f.SagaID == uuid.Nil && f.OrderID == uuid.Nil && f.EventType == "" && len(f.IDs) == 0
+}
+
+// replay sends the selected entries back to their original topics and resolves each one that made it
+func replay(ctx context.Context, cfg *config.Config, store *dlq.Store, entries []dlq.Entry, dryRun bool) error {
+	if dryRun {
+		for _, e := range entries {
+			fmt.Printf("Would replay %s to %s\n", e.ID, e.OriginalTopic)
+		}
+
+		return nil
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer producer.Client.Close()
+
+	for _, e := range entries {
+		record, err := e.ReplayRecord()
+		if err != nil {
+			return err
+		}
+
+		if err := producer.PublishRecord(ctx, record); err != nil {
+			return fmt.Errorf("failed to replay %s: %w", e.ID, err)
+		}
+
+		if err := store.Resolve(ctx, []dlq.Entry{e}, "replayed"); err != nil {
+			return fmt.Errorf("replayed %s but failed to resolve it: %w", e.ID, err)
+		}
+
+		fmt.Printf("Replayed %s to %s\n", e.ID, e.OriginalTopic)
+	}
+
+	return nil
+}
+
+func printJSON(w io.Writer, entries []dlq.Entry) error {
+	if entries == nil {
+		entries = []dlq.Entry{}
+	}
+
+	data, err := sonic.ConfigStd.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+
+	return err
+}
+
+func printTable(w io.Writer, entries []dlq.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tFAILED AT\tORIGIN\tEVENT\tSAGA\tORDER\tATTEMPTS\tRESOLVED\tERROR")
+
+	for _, e := range entries {
+		event, sagaID, orderID := "<undecodable>", "-", "-"
+		if e.Event != nil {
+			event, sagaID, orderID = string(e.Event.Event), e.Event.SagaID.String(), e.Event.OrderID.String()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s/%d@%d\t%s\t%s\t%s\t%d\t%t\t%s\n",
+			e.ID,
+			e.FailedAt.Format(time.RFC3339),
+			e.OriginalTopic, e.OriginalPartition, e.OriginalOffset,
+			event, sagaID, orderID,
+			e.Attempts,
+			e.Resolved,
+			truncate(e.Error, 60),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n-3] + "..."
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/inventory"
 	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -13,10 +21,55 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	producer, err := kafka.NewConsumer(cfg, cfg.ConsumerGroups.InventoryService, []string{cfg.Topics.Commands.Inventory})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.Open(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	defer db.Close()
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
 	}
 
 	defer producer.Client.Close()
+
+	consumer, err := kafka.NewCommandConsumer(cfg, cfg.ConsumerGroups.InventoryService, []string{cfg.Topics.Commands.Inventory}, cfg.Topics.DLQ.Inventory)
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
+	}
+
+	defer consumer.Close()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: cfg.GetRedisAddress()})
+	defer redisClient.Close()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Failed to connect to redis: %v", err)
+	}
+
+	inbox := kafka.NewInbox(kafka.NewRedisInboxStore(redisClient, "inventory"), consumer.Publisher(producer), cfg.Inbox.TTL, cfg.Inbox.Lease)
+
+	store := inventory.NewPostgresStore(db)
+	service := inventory.NewService(store, inbox, cfg.Topics.Replies.Inventory, cfg.Inventory.HoldTTL)
+
+	go func() {
+		reaper := inventory.NewReaper(store, producer, cfg.Topics.Replies.Inventory, cfg.Inventory.ReapInterval)
+		if err := reaper.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Inventory reaper stopped: %v", err)
+		}
+	}()
+
+	router := service.Routes()
+	router.Use(kafka.Recover(), kafka.Logging(), kafka.Dedup(inbox))
+
+	log.Printf("Inventory service consuming %s", cfg.Topics.Commands.Inventory)
+
+	if err := consumer.ConsumeEvents(ctx, router.HandleEvent); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Consumer stopped: %v", err)
+	}
 }
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mateusmlo/altimit-ecomm/internal/config"
 	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/notification"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -13,10 +22,77 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	producer, err := kafka.NewConsumer(cfg, cfg.ConsumerGroups.NotificationService, []string{cfg.Topics.Commands.Notification})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	templates, err := notification.DefaultTemplates()
 	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+
+	channels, err := newChannels(cfg.Notification)
+	if err != nil {
+		log.Fatalf("Failed to set up notification channels: %v", err)
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
 	}
 
 	defer producer.Client.Close()
+
+	consumer, err := kafka.NewCommandConsumer(cfg, cfg.ConsumerGroups.NotificationService, []string{cfg.Topics.Commands.Notification}, cfg.Topics.DLQ.Notification)
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
+	}
+
+	defer consumer.Close()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: cfg.GetRedisAddress()})
+	defer redisClient.Close()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Failed to connect to redis: %v", err)
+	}
+
+	inbox := kafka.NewInbox(kafka.NewRedisInboxStore(redisClient, "notification"), consumer.Publisher(producer), cfg.Inbox.TTL, cfg.Inbox.Lease)
+	service := notification.NewService(templates, channels, inbox, cfg.Topics.Replies.Notification, cfg.Notification.Timeout)
+
+	router := service.Routes()
+	router.Use(kafka.Recover(), kafka.Logging(), kafka.Dedup(inbox))
+
+	log.Printf("Notification service consuming %s, delivering through %v", cfg.Topics.Commands.Notification, cfg.Notification.Channels)
+
+	if err := consumer.ConsumeEvents(ctx, router.HandleEvent); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Consumer stopped: %v", err)
+	}
+}
+
+func newChannels(cfg config.NotificationConfig) ([]notification.Channel, error) {
+	channels := make([]notification.Channel, 0, len(cfg.Channels))
+
+	for _, name := range cfg.Channels {
+		switch name {
+		case "log":
+			channels = append(channels, notification.NewLogChannel(os.Stdout))
+		case "email":
+			var auth smtp.Auth
+
+			if cfg.SMTPUsername != "" {
+				host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+				if err != nil {
+					return nil, err
+				}
+
+				auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+			}
+
+			channels = append(channels, notification.NewEmailChannel(cfg.SMTPAddr, cfg.SMTPFrom, cfg.EmailDomain, auth))
+		case "webhook":
+			channels = append(channels, notification.NewWebhookChannel(cfg.WebhookURL, nil))
+		}
+	}
+
+	return channels, nil
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/order"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+	"github.com/mateusmlo/altimit-ecomm/internal/saga"
+	"github.com/redis/go-redis/v9"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
+	}
+
+	defer producer.Client.Close()
+
+	workflow := saga.GetOrderWorkflow()
+	topics := append([]string{cfg.Topics.Commands.Orders}, workflow.ReplyTopics()...)
+
+	consumer, err := kafka.NewConsumer(cfg, cfg.ConsumerGroups.SagaOrchestrator, topics, cfg.Topics.DLQ.Orders)
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
+	}
+
+	defer consumer.Close()
+
+	// Orders always live in postgres, whichever store keeps the sagas
+	db, err := postgres.Open(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	defer db.Close()
+
+	store, closeStore, err := openStore(ctx, cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to open saga store: %v", err)
+	}
+
+	defer closeStore()
+
+	orders := order.NewStatusUpdater(order.NewPostgresStore(db), cfg.Topics.Events.Orders)
+	orchestrator := saga.NewOrchestrator(workflow, store, producer, orders)
+
+	go func() {
+		if err := saga.NewSweeper(orchestrator, cfg.Saga.SweepInterval).Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Saga sweeper stopped: %v", err)
+		}
+	}()
+
+	server := &http.Server{Addr: cfg.Saga.HTTPAddr, Handler: saga.NewQueryHandler(orchestrator)}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Saga query API stopped: %v", err)
+		}
+	}()
+
+	defer server.Close()
+
+	log.Printf("Saga orchestrator consuming %v, query API on %s", topics, cfg.Saga.HTTPAddr)
+
+	if err := consumer.Consume(ctx, orchestrator.HandleRecord); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Consumer stopped: %v", err)
+	}
+}
+
+// openStore opens the configured saga store. The postgres store keeps sagas in db and queues
+// commands in the outbox, which the relay publishes
+func openStore(ctx context.Context, cfg *config.Config, db *sql.DB) (saga.SagaStore, func(), error) {
+	if cfg.Saga.Store == "redis" {
+		client := redis.NewClient(&redis.Options{Addr: cfg.GetRedisAddress()})
+
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+
+		return saga.NewRedisStore(client), func() { client.Close() }, nil
+	}
+
+	return saga.NewPostgresStore(db), func() {}, nil
+}
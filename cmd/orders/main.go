@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/fx"
+	"github.com/mateusmlo/altimit-ecomm/internal/order"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.Open(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	defer db.Close()
+
+	rates := fx.NewStaticProvider(cfg.Orders.BaseCurrency, nil, time.Now())
+
+	if cfg.Orders.FXRatesFile != "" {
+		if rates, err = fx.LoadStaticProvider(cfg.Orders.FXRatesFile); err != nil {
+			log.Fatalf("Failed to load FX rates: %v", err)
+		}
+	}
+
+	ids, err := order.NewPublicIDGenerator(cfg.Region)
+	if err != nil {
+		log.Fatalf("Failed to create public ID generator: %v", err)
+	}
+
+	service := order.NewService(
+		order.NewPostgresStore(db),
+		cfg.Topics.Commands.Orders,
+		ids,
+		fx.NewCachedProvider(rates, cfg.Orders.FXCacheTTL),
+		cfg.Orders.BaseCurrency,
+		cfg.Orders.DefaultCurrency,
+	)
+	server := &http.Server{Addr: cfg.Orders.HTTPAddr, Handler: order.NewHandler(service)}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down order API: %v", err)
+		}
+	}()
+
+	log.Printf("Order API listening on %s, starting sagas on %s through the outbox", cfg.Orders.HTTPAddr, cfg.Topics.Commands.Orders)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Order API stopped: %v", err)
+	}
+}
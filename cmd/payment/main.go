@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mateusmlo/altimit-ecomm/internal/config"
 	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/payment"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -13,10 +20,44 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	producer, err := kafka.NewConsumer(cfg, cfg.ConsumerGroups.PaymentService, []string{cfg.Topics.Commands.Payment})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rules, err := payment.ParseFakeRules(cfg.Payment.FakeRules)
 	if err != nil {
-		log.Fatalf("Failed to create consumer: %v", err)
+		log.Fatalf("Failed to parse fake gateway rules: %v", err)
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
 	}
 
 	defer producer.Client.Close()
+
+	consumer, err := kafka.NewCommandConsumer(cfg, cfg.ConsumerGroups.PaymentService, []string{cfg.Topics.Commands.Payment}, cfg.Topics.DLQ.Payment)
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
+	}
+
+	defer consumer.Close()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: cfg.GetRedisAddress()})
+	defer redisClient.Close()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		log.Fatalf("Failed to connect to redis: %v", err)
+	}
+
+	inbox := kafka.NewInbox(kafka.NewRedisInboxStore(redisClient, "payment"), consumer.Publisher(producer), cfg.Inbox.TTL, cfg.Inbox.Lease)
+	service := payment.NewService(payment.NewFakeGateway(rules...), inbox, cfg.Topics.Replies.Payment, cfg.Payment.GatewayTimeout)
+
+	router := service.Routes()
+	router.Use(kafka.Recover(), kafka.Logging(), kafka.Dedup(inbox))
+
+	log.Printf("Payment service consuming %s with fake gateway (%d rules)", cfg.Topics.Commands.Payment, len(rules))
+
+	if err := consumer.ConsumeEvents(ctx, router.HandleEvent); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Consumer stopped: %v", err)
+	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.Open(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	defer db.Close()
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
+	}
+
+	defer producer.Client.Close()
+
+	relay := outbox.NewRelay(db, producer, cfg.Outbox.BatchSize, cfg.Outbox.Retention)
+
+	log.Printf("Outbox relay polling every %s", cfg.Outbox.PollInterval)
+
+	if err := relay.Run(ctx, cfg.Outbox.PollInterval); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Outbox relay stopped: %v", err)
+	}
+}
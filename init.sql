@@ -0,0 +1,78 @@
+CREATE TABLE IF NOT EXISTS items (
+    id          UUID PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price       NUMERIC(15, 3) NOT NULL,
+    currency    CHAR(3) NOT NULL DEFAULT 'USD',
+    stock       INTEGER NOT NULL CHECK (stock >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS reservations (
+    saga_id    UUID PRIMARY KEY,
+    order_id   UUID NOT NULL,
+    items      JSONB NOT NULL,
+    status     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS reservations_held_expiry_idx ON reservations (expires_at) WHERE status = 'HELD';
+
+CREATE TABLE IF NOT EXISTS orders (
+    id          UUID PRIMARY KEY,
+    public_id   TEXT NOT NULL UNIQUE,
+    saga_id     UUID NOT NULL,
+    customer_id TEXT NOT NULL,
+    currency    CHAR(3) NOT NULL,
+    fx_rate     JSONB,
+    status      TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id       UUID PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES orders (id),
+    item_id  UUID NOT NULL REFERENCES items (id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    price    NUMERIC(15, 3) NOT NULL,
+    currency CHAR(3) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_items_order_idx ON order_items (order_id);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    UUID NOT NULL REFERENCES orders (id),
+    from_status TEXT NOT NULL,
+    to_status   TEXT NOT NULL,
+    reason      TEXT NOT NULL DEFAULT '',
+    changed_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_idx ON order_status_history (order_id);
+
+CREATE TABLE IF NOT EXISTS sagas (
+    saga_id    UUID PRIMARY KEY,
+    status     TEXT NOT NULL,
+    version    BIGINT NOT NULL,
+    state      JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS sagas_status_idx ON sagas (status);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    topic      TEXT NOT NULL,
+    key        BYTEA,
+    event      JSONB NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -16,6 +17,13 @@ type Config struct {
 	Redis          RedisConfig
 	Topics         TopicsConfig
 	ConsumerGroups ConsumerGroupsConfig
+	Saga           SagaConfig
+	Inventory      InventoryConfig
+	Payment        PaymentConfig
+	Notification   NotificationConfig
+	Orders         OrdersConfig
+	Outbox         OutboxConfig
+	Inbox          InboxConfig
 	Region         string
 }
 
@@ -24,6 +32,15 @@ type KafkaConfig struct {
 	Brokers           []string
 	MaxRequestRetries int
 	MaxRecordRetries  int
+	HandlerAttempts   int
+	RetryBackoff      time.Duration
+	RetryTiers        []time.Duration
+	// MaxInFlight caps how many records a consumer handles at once across its partitions
+	MaxInFlight int
+	// Transactional makes services reply and commit offsets in one Kafka transaction. Each
+	// instance needs its own TransactionalID that stays the same across restarts
+	Transactional   bool
+	TransactionalID string
 }
 
 // PostgresConfig holds PostgreSQL-related configuration
@@ -45,6 +62,7 @@ type RedisConfig struct {
 type TopicsConfig struct {
 	Commands CommandTopics
 	Replies  ReplyTopics
+	Events   EventTopics
 	DLQ      DLQTopics
 }
 
@@ -63,11 +81,20 @@ type ReplyTopics struct {
 	Notification string
 }
 
-// DLQTopics holds dead letter queue topic names
-type DLQTopics struct {
+// EventTopics holds the topics services announce their own state changes on
+type EventTopics struct {
 	Orders string
 }
 
+// DLQTopics holds dead letter queue topic names. Orders is used by the saga orchestrator,
+// the others by the service consuming the matching command topic
+type DLQTopics struct {
+	Orders       string
+	Inventory    string
+	Payment      string
+	Notification string
+}
+
 // ConsumerGroupsConfig holds all consumer group IDs
 type ConsumerGroupsConfig struct {
 	SagaOrchestrator    string
@@ -76,6 +103,63 @@ type ConsumerGroupsConfig struct {
 	NotificationService string
 }
 
+// SagaConfig holds saga orchestrator settings. Store is where saga state lives: postgres, which
+// queues commands in the outbox, or redis, which publishes them directly
+type SagaConfig struct {
+	SweepInterval time.Duration
+	HTTPAddr      string
+	Store         string
+}
+
+// InventoryConfig holds inventory service settings
+type InventoryConfig struct {
+	HoldTTL      time.Duration
+	ReapInterval time.Duration
+}
+
+// PaymentConfig holds payment service settings
+type PaymentConfig struct {
+	GatewayTimeout time.Duration
+	FakeRules      string
+}
+
+// NotificationConfig holds notification service settings
+type NotificationConfig struct {
+	Channels     []string
+	Timeout      time.Duration
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	EmailDomain  string
+	WebhookURL   string
+}
+
+// OrdersConfig holds order API settings. Catalog prices are in BaseCurrency and orders are
+// priced in DefaultCurrency unless the customer asks for another, converted with the rates of
+// FXRatesFile which are cached for FXCacheTTL
+type OrdersConfig struct {
+	HTTPAddr        string
+	BaseCurrency    string
+	DefaultCurrency string
+	FXRatesFile     string
+	FXCacheTTL      time.Duration
+}
+
+// InboxConfig holds the settings of the processed-event inbox. TTL is how long an event ID is
+// remembered, Lease how long a claim lasts before a crashed consumer's event is processed again
+type InboxConfig struct {
+	TTL   time.Duration
+	Lease time.Duration
+}
+
+// OutboxConfig holds outbox relay settings
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Retention    time.Duration
+}
+
 // Load reads configuration from environment variables using Viper
 func Load() (*Config, error) {
 	v := viper.New()
@@ -97,12 +181,23 @@ func Load() (*Config, error) {
 		// If file not found, we'll just use environment variables
 	}
 
+	retryTiers, err := parseDurations(v.GetString("KAFKA_RETRY_TIERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KAFKA_RETRY_TIERS: %w", err)
+	}
+
 	// Build the config struct
 	cfg := &Config{
 		Kafka: KafkaConfig{
 			Brokers:           parseBrokers(v.GetString("KAFKA_BROKERS")),
 			MaxRequestRetries: v.GetInt("MAX_REQ_RETRIES"),
 			MaxRecordRetries:  v.GetInt("MAX_RECORD_RETRIES"),
+			HandlerAttempts:   v.GetInt("KAFKA_HANDLER_ATTEMPTS"),
+			RetryBackoff:      v.GetDuration("KAFKA_RETRY_BACKOFF"),
+			MaxInFlight:       v.GetInt("KAFKA_MAX_IN_FLIGHT"),
+			Transactional:     v.GetBool("KAFKA_TRANSACTIONAL"),
+			TransactionalID:   v.GetString("KAFKA_TRANSACTIONAL_ID"),
+			RetryTiers:        retryTiers,
 		},
 		Postgres: PostgresConfig{
 			User:     v.GetString("POSTGRES_USER"),
@@ -127,8 +222,14 @@ func Load() (*Config, error) {
 				Payment:      v.GetString("PAYMENT_REPLIES_TOPIC"),
 				Notification: v.GetString("NOTIFICATION_REPLIES_TOPIC"),
 			},
+			Events: EventTopics{
+				Orders: v.GetString("ORDER_EVENTS_TOPIC"),
+			},
 			DLQ: DLQTopics{
-				Orders: v.GetString("ORDERS_DLQ_TOPIC"),
+				Orders:       v.GetString("ORDERS_DLQ_TOPIC"),
+				Inventory:    v.GetString("INVENTORY_DLQ_TOPIC"),
+				Payment:      v.GetString("PAYMENT_DLQ_TOPIC"),
+				Notification: v.GetString("NOTIFICATION_DLQ_TOPIC"),
 			},
 		},
 		ConsumerGroups: ConsumerGroupsConfig{
@@ -137,6 +238,45 @@ func Load() (*Config, error) {
 			PaymentService:      v.GetString("PAYMENT_SERVICE_GROUP"),
 			NotificationService: v.GetString("NOTIFICATION_SERVICE_GROUP"),
 		},
+		Saga: SagaConfig{
+			SweepInterval: v.GetDuration("SAGA_SWEEP_INTERVAL"),
+			HTTPAddr:      v.GetString("ORCHESTRATOR_HTTP_ADDR"),
+			Store:         v.GetString("SAGA_STORE"),
+		},
+		Inventory: InventoryConfig{
+			HoldTTL:      v.GetDuration("INVENTORY_HOLD_TTL"),
+			ReapInterval: v.GetDuration("INVENTORY_REAP_INTERVAL"),
+		},
+		Payment: PaymentConfig{
+			GatewayTimeout: v.GetDuration("PAYMENT_GATEWAY_TIMEOUT"),
+			FakeRules:      v.GetString("PAYMENT_FAKE_RULES"),
+		},
+		Notification: NotificationConfig{
+			Channels:     parseList(v.GetString("NOTIFICATION_CHANNELS")),
+			Timeout:      v.GetDuration("NOTIFICATION_TIMEOUT"),
+			SMTPAddr:     v.GetString("SMTP_ADDR"),
+			SMTPFrom:     v.GetString("SMTP_FROM"),
+			SMTPUsername: v.GetString("SMTP_USERNAME"),
+			SMTPPassword: v.GetString("SMTP_PASSWORD"),
+			EmailDomain:  v.GetString("NOTIFICATION_EMAIL_DOMAIN"),
+			WebhookURL:   v.GetString("NOTIFICATION_WEBHOOK_URL"),
+		},
+		Orders: OrdersConfig{
+			HTTPAddr:        v.GetString("ORDERS_HTTP_ADDR"),
+			BaseCurrency:    v.GetString("ORDERS_BASE_CURRENCY"),
+			DefaultCurrency: v.GetString("ORDERS_DEFAULT_CURRENCY"),
+			FXRatesFile:     v.GetString("FX_RATES_FILE"),
+			FXCacheTTL:      v.GetDuration("FX_CACHE_TTL"),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: v.GetDuration("OUTBOX_POLL_INTERVAL"),
+			BatchSize:    v.GetInt("OUTBOX_BATCH_SIZE"),
+			Retention:    v.GetDuration("OUTBOX_RETENTION"),
+		},
+		Inbox: InboxConfig{
+			TTL:   v.GetDuration("INBOX_TTL"),
+			Lease: v.GetDuration("INBOX_LEASE"),
+		},
 		Region: v.GetString("REGION"),
 	}
 
@@ -163,6 +303,22 @@ func (c *Config) Validate() error {
 		c.Kafka.MaxRequestRetries = 10
 	}
 
+	if c.Kafka.HandlerAttempts == 0 {
+		c.Kafka.HandlerAttempts = 3
+	}
+
+	if c.Kafka.RetryBackoff == 0 {
+		c.Kafka.RetryBackoff = 500 * time.Millisecond
+	}
+
+	if c.Kafka.MaxInFlight == 0 {
+		c.Kafka.MaxInFlight = 16
+	}
+
+	if c.Kafka.Transactional && c.Kafka.TransactionalID == "" {
+		return fmt.Errorf("KAFKA_TRANSACTIONAL_ID is required when KAFKA_TRANSACTIONAL is enabled")
+	}
+
 	// Validate Postgres config
 	if c.Postgres.User == "" {
 		return fmt.Errorf("POSTGRES_USER is required")
@@ -213,10 +369,23 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("NOTIFICATION_REPLIES_TOPIC is required")
 	}
 
+	if c.Topics.Events.Orders == "" {
+		c.Topics.Events.Orders = "order.events"
+	}
+
 	// Validate DLQ topics
 	if c.Topics.DLQ.Orders == "" {
 		return fmt.Errorf("ORDERS_DLQ_TOPIC is required")
 	}
+	if c.Topics.DLQ.Inventory == "" {
+		c.Topics.DLQ.Inventory = "inventory.dlq"
+	}
+	if c.Topics.DLQ.Payment == "" {
+		c.Topics.DLQ.Payment = "payment.dlq"
+	}
+	if c.Topics.DLQ.Notification == "" {
+		c.Topics.DLQ.Notification = "notification.dlq"
+	}
 
 	// Validate consumer groups
 	if c.ConsumerGroups.SagaOrchestrator == "" {
@@ -232,21 +401,144 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("NOTIFICATION_SERVICE_GROUP is required")
 	}
 
+	// Saga defaults
+	if c.Saga.SweepInterval == 0 {
+		c.Saga.SweepInterval = 5 * time.Second
+	}
+
+	if c.Saga.HTTPAddr == "" {
+		c.Saga.HTTPAddr = ":8081"
+	}
+
+	switch c.Saga.Store {
+	case "":
+		c.Saga.Store = "postgres"
+	case "postgres", "redis":
+	default:
+		return fmt.Errorf("unknown saga store %q in SAGA_STORE", c.Saga.Store)
+	}
+
+	// Inventory defaults
+	if c.Inventory.HoldTTL == 0 {
+		c.Inventory.HoldTTL = 15 * time.Minute
+	}
+
+	if c.Inventory.ReapInterval == 0 {
+		c.Inventory.ReapInterval = 30 * time.Second
+	}
+
+	// Payment defaults
+	if c.Payment.GatewayTimeout == 0 {
+		c.Payment.GatewayTimeout = 10 * time.Second
+	}
+
+	// Notification defaults
+	if len(c.Notification.Channels) == 0 {
+		c.Notification.Channels = []string{"log"}
+	}
+
+	if c.Notification.Timeout == 0 {
+		c.Notification.Timeout = 10 * time.Second
+	}
+
+	for _, channel := range c.Notification.Channels {
+		switch channel {
+		case "log":
+		case "email":
+			if c.Notification.SMTPAddr == "" || c.Notification.SMTPFrom == "" {
+				return fmt.Errorf("SMTP_ADDR and SMTP_FROM are required for the email channel")
+			}
+		case "webhook":
+			if c.Notification.WebhookURL == "" {
+				return fmt.Errorf("NOTIFICATION_WEBHOOK_URL is required for the webhook channel")
+			}
+		default:
+			return fmt.Errorf("unknown notification channel %q in NOTIFICATION_CHANNELS", channel)
+		}
+	}
+
+	// Orders defaults
+	if c.Orders.HTTPAddr == "" {
+		c.Orders.HTTPAddr = ":8082"
+	}
+
+	// Outbox defaults
+	if c.Outbox.PollInterval == 0 {
+		c.Outbox.PollInterval = 500 * time.Millisecond
+	}
+
+	if c.Outbox.BatchSize == 0 {
+		c.Outbox.BatchSize = 100
+	}
+
+	if c.Outbox.Retention == 0 {
+		c.Outbox.Retention = 24 * time.Hour
+	}
+
+	// Inbox defaults
+	if c.Inbox.TTL == 0 {
+		c.Inbox.TTL = 7 * 24 * time.Hour
+	}
+
+	if c.Inbox.Lease == 0 {
+		c.Inbox.Lease = time.Minute
+	}
+
 	// Validate region
 	if c.Region == "" {
 		return fmt.Errorf("REGION is required")
 	}
 
+	// Currency defaults, the default currency follows the region
+	if c.Orders.BaseCurrency == "" {
+		c.Orders.BaseCurrency = "USD"
+	}
+
+	// Without a rates file only the base currency can be priced, so the region picks the
+	// default only when there are rates to convert with
+	if c.Orders.DefaultCurrency == "" {
+		c.Orders.DefaultCurrency = c.Orders.BaseCurrency
+
+		if currency, ok := regionCurrencies[strings.ToUpper(c.Region)]; ok && c.Orders.FXRatesFile != "" {
+			c.Orders.DefaultCurrency = currency
+		}
+	} else if c.Orders.DefaultCurrency != c.Orders.BaseCurrency && c.Orders.FXRatesFile == "" {
+		return fmt.Errorf("FX_RATES_FILE is required to price orders in %s with %s prices", c.Orders.DefaultCurrency, c.Orders.BaseCurrency)
+	}
+
+	if c.Orders.FXCacheTTL == 0 {
+		c.Orders.FXCacheTTL = time.Hour
+	}
+
 	return nil
 }
 
+// regionCurrencies is the currency orders default to in each region
+var regionCurrencies = map[string]string{
+	"AU": "AUD",
+	"BR": "BRL",
+	"CA": "CAD",
+	"CH": "CHF",
+	"EU": "EUR",
+	"GB": "GBP",
+	"JP": "JPY",
+	"MX": "MXN",
+	"UK": "GBP",
+	"US": "USD",
+}
+
 // parseBrokers splits comma-separated broker addresses
 func parseBrokers(brokers string) []string {
-	if brokers == "" {
+	return parseList(brokers)
+}
+
+// parseList splits a comma-separated list, dropping blank entries
+func parseList(list string) []string {
+	if list == "" {
 		return []string{}
 	}
 
-	parts := strings.Split(brokers, ",")
+	parts := strings.Split(list, ",")
 	result := make([]string, 0, len(parts))
 
 	for _, part := range parts {
@@ -259,6 +551,26 @@ func parseBrokers(brokers string) []string {
 	return result
 }
 
+// parseDurations splits comma-separated durations such as "5s,1m,10m"
+func parseDurations(durations string) ([]time.Duration, error) {
+	var result []time.Duration
+
+	for _, part := range parseList(durations) {
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if d <= 0 {
+			return nil, fmt.Errorf("duration %s must be positive", part)
+		}
+
+		result = append(result, d)
+	}
+
+	return result, nil
+}
+
 // GetPostgresConnectionString returns a formatted PostgreSQL connection string
 func (c *Config) GetPostgresConnectionString() string {
 	return fmt.Sprintf(
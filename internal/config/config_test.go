@@ -3,14 +3,15 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
 	// Set up test environment variables
 	envVars := map[string]string{
 		"KAFKA_BROKERS":               "localhost:9092",
-		"KAFKA_MAX_REQ_RETRIES":       "5",
-		"KAFKA_MAX_RECORD_RETRIES":    "10",
+		"MAX_REQ_RETRIES":             "5",
+		"MAX_RECORD_RETRIES":          "10",
 		"POSTGRES_USER":               "test_user",
 		"POSTGRES_PASSWORD":           "test_pass",
 		"POSTGRES_DB":                 "test_db",
@@ -30,6 +31,8 @@ func TestLoad(t *testing.T) {
 		"INVENTORY_SERVICE_GROUP":     "inventory-service",
 		"PAYMENT_SERVICE_GROUP":       "payment-service",
 		"NOTIFICATION_SERVICE_GROUP":  "notification-service",
+		"SAGA_SWEEP_INTERVAL":         "10s",
+		"KAFKA_RETRY_TIERS":           "5s, 1m",
 		"REGION":                      "US",
 	}
 
@@ -57,6 +60,12 @@ func TestLoad(t *testing.T) {
 	if cfg.Kafka.MaxRecordRetries != 10 {
 		t.Errorf("Expected Kafka max record retries 10, got %d", cfg.Kafka.MaxRecordRetries)
 	}
+	if len(cfg.Kafka.RetryTiers) != 2 || cfg.Kafka.RetryTiers[0] != 5*time.Second || cfg.Kafka.RetryTiers[1] != time.Minute {
+		t.Errorf("Expected Kafka retry tiers [5s 1m], got %v", cfg.Kafka.RetryTiers)
+	}
+	if cfg.Kafka.MaxInFlight != 16 {
+		t.Errorf("Expected default Kafka max in-flight 16, got %d", cfg.Kafka.MaxInFlight)
+	}
 
 	// Validate Postgres config
 	if cfg.Postgres.User != "test_user" {
@@ -83,6 +92,43 @@ func TestLoad(t *testing.T) {
 		t.Errorf("Expected Redis port 6379, got %d", cfg.Redis.Port)
 	}
 
+	// Validate saga config
+	if cfg.Saga.SweepInterval != 10*time.Second {
+		t.Errorf("Expected saga sweep interval 10s, got %s", cfg.Saga.SweepInterval)
+	}
+	if cfg.Saga.HTTPAddr != ":8081" {
+		t.Errorf("Expected default orchestrator HTTP address ':8081', got '%s'", cfg.Saga.HTTPAddr)
+	}
+
+	if cfg.Saga.Store != "postgres" {
+		t.Errorf("Expected default saga store 'postgres', got '%s'", cfg.Saga.Store)
+	}
+
+	// Validate event topic defaults
+	if cfg.Topics.Events.Orders != "order.events" {
+		t.Errorf("Expected default order events topic 'order.events', got '%s'", cfg.Topics.Events.Orders)
+	}
+
+	// Validate outbox defaults
+	if cfg.Outbox.PollInterval != 500*time.Millisecond || cfg.Outbox.BatchSize != 100 || cfg.Outbox.Retention != 24*time.Hour {
+		t.Errorf("Expected outbox defaults 500ms/100/24h, got %+v", cfg.Outbox)
+	}
+
+	// Validate inbox defaults
+	if cfg.Inbox.TTL != 7*24*time.Hour || cfg.Inbox.Lease != time.Minute {
+		t.Errorf("Expected inbox defaults 168h/1m, got %+v", cfg.Inbox)
+	}
+
+	// Validate currency defaults
+	if cfg.Orders.BaseCurrency != "USD" || cfg.Orders.DefaultCurrency != "USD" || cfg.Orders.FXCacheTTL != time.Hour {
+		t.Errorf("Expected currency defaults USD/USD/1h, got %+v", cfg.Orders)
+	}
+
+	// Validate notification defaults
+	if len(cfg.Notification.Channels) != 1 || cfg.Notification.Channels[0] != "log" {
+		t.Errorf("Expected default notification channels [log], got %v", cfg.Notification.Channels)
+	}
+
 	// Validate region
 	if cfg.Region != "US" {
 		t.Errorf("Expected region 'US', got '%s'", cfg.Region)
@@ -140,46 +186,8 @@ func TestValidate(t *testing.T) {
 		errorMsg    string
 	}{
 		{
-			name: "valid config",
-			config: &Config{
-				Kafka: KafkaConfig{
-					Brokers: []string{"localhost:9092"},
-				},
-				Postgres: PostgresConfig{
-					User:     "user",
-					Password: "pass",
-					DB:       "db",
-					Host:     "localhost",
-					Port:     5432,
-				},
-				Redis: RedisConfig{
-					Host: "localhost",
-					Port: 6379,
-				},
-				Topics: TopicsConfig{
-					Commands: CommandTopics{
-						Orders:       "orders",
-						Inventory:    "inventory.commands",
-						Payment:      "payment.commands",
-						Notification: "notification.commands",
-					},
-					Replies: ReplyTopics{
-						Inventory:    "inventory.replies",
-						Payment:      "payment.replies",
-						Notification: "notification.replies",
-					},
-					DLQ: DLQTopics{
-						Orders: "orders.dlq",
-					},
-				},
-				ConsumerGroups: ConsumerGroupsConfig{
-					SagaOrchestrator:    "saga-orchestrator",
-					InventoryService:    "inventory-service",
-					PaymentService:      "payment-service",
-					NotificationService: "notification-service",
-				},
-				Region: "US",
-			},
+			name:        "valid config",
+			config:      validConfig(),
 			expectError: false,
 		},
 		{
@@ -192,6 +200,17 @@ func TestValidate(t *testing.T) {
 			expectError: true,
 			errorMsg:    "KAFKA_BROKERS is required",
 		},
+		{
+			name: "transactional without ID",
+			config: &Config{
+				Kafka: KafkaConfig{
+					Brokers:       []string{"localhost:9092"},
+					Transactional: true,
+				},
+			},
+			expectError: true,
+			errorMsg:    "KAFKA_TRANSACTIONAL_ID is required when KAFKA_TRANSACTIONAL is enabled",
+		},
 		{
 			name: "missing postgres user",
 			config: &Config{
@@ -225,6 +244,91 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestValidateCurrencies(t *testing.T) {
+	tests := []struct {
+		name            string
+		region          string
+		defaultCurrency string
+		ratesFile       string
+		expected        string
+		expectError     bool
+	}{
+		{name: "region currency with rates", region: "BR", ratesFile: "rates.json", expected: "BRL"},
+		{name: "region currency without rates", region: "BR", expected: "USD"},
+		{name: "unknown region", region: "ZZ", ratesFile: "rates.json", expected: "USD"},
+		{name: "explicit currency with rates", region: "US", defaultCurrency: "EUR", ratesFile: "rates.json", expected: "EUR"},
+		{name: "explicit base currency without rates", region: "BR", defaultCurrency: "USD", expected: "USD"},
+		{name: "explicit currency without rates", region: "US", defaultCurrency: "EUR", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Region = tt.region
+			cfg.Orders.DefaultCurrency = tt.defaultCurrency
+			cfg.Orders.FXRatesFile = tt.ratesFile
+
+			err := cfg.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if cfg.Orders.DefaultCurrency != tt.expected {
+				t.Errorf("Expected default currency '%s', got '%s'", tt.expected, cfg.Orders.DefaultCurrency)
+			}
+		})
+	}
+}
+
+// validConfig returns a config with every required setting
+func validConfig() *Config {
+	return &Config{
+		Kafka: KafkaConfig{
+			Brokers: []string{"localhost:9092"},
+		},
+		Postgres: PostgresConfig{
+			User:     "user",
+			Password: "pass",
+			DB:       "db",
+			Host:     "localhost",
+			Port:     5432,
+		},
+		Redis: RedisConfig{
+			Host: "localhost",
+			Port: 6379,
+		},
+		Topics: TopicsConfig{
+			Commands: CommandTopics{
+				Orders:       "orders",
+				Inventory:    "inventory.commands",
+				Payment:      "payment.commands",
+				Notification: "notification.commands",
+			},
+			Replies: ReplyTopics{
+				Inventory:    "inventory.replies",
+				Payment:      "payment.replies",
+				Notification: "notification.replies",
+			},
+			DLQ: DLQTopics{
+				Orders: "orders.dlq",
+			},
+		},
+		ConsumerGroups: ConsumerGroupsConfig{
+			SagaOrchestrator:    "saga-orchestrator",
+			InventoryService:    "inventory-service",
+			PaymentService:      "payment-service",
+			NotificationService: "notification-service",
+		},
+		Region: "US",
+	}
+}
+
 func TestGetPostgresConnectionString(t *testing.T) {
 	cfg := &Config{
 		Postgres: PostgresConfig{
@@ -0,0 +1,150 @@
+package dlq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// HeaderReplayedFrom is added to replayed records and points at the DLQ entry they came from
+const HeaderReplayedFrom = "dlq.replayed_from"
+
+// Entry is a dead-lettered record with its failure details and, when it could be decoded, its event
+type Entry struct {
+	ID                string        `json:"id"`
+	Partition         int32         `json:"partition"`
+	Offset            int64         `json:"offset"`
+	OriginalTopic     string        `json:"original_topic"`
+	OriginalPartition int32         `json:"original_partition"`
+	OriginalOffset    int64         `json:"original_offset"`
+	Error             string        `json:"error"`
+	Attempts          int           `json:"attempts"`
+	FailedAt          time.Time     `json:"failed_at"`
+	Key               string        `json:"key"`
+	Event             *models.Event `json:"event,omitempty"`
+	DecodeError       string        `json:"decode_error,omitempty"`
+	Resolved          bool          `json:"resolved"`
+	ResolvedNote      string        `json:"resolved_note,omitempty"`
+
+	record *kgo.Record
+}
+
+// EntryID identifies a DLQ record by partition and offset, e.g. 0/42
+func EntryID(partition int32, offset int64) string {
+	return fmt.Sprintf("%d/%d", partition, offset)
+}
+
+// newEntry reads the failure headers of record and decodes its event
+func newEntry(record *kgo.Record) Entry {
+	e := Entry{
+		ID:            EntryID(record.Partition, record.Offset),
+		Partition:     record.Partition,
+		Offset:        record.Offset,
+		OriginalTopic: kafka.HeaderValue(record, kafka.HeaderDLQTopic),
+		Error:         kafka.HeaderValue(record, kafka.HeaderDLQError),
+		Key:           string(record.Key),
+		record:        record,
+	}
+
+	if partition, err := strconv.ParseInt(kafka.HeaderValue(record, kafka.HeaderDLQPartition), 10, 32); err == nil {
+		e.OriginalPartition = int32(partition)
+	}
+
+	if offset, err := strconv.ParseInt(kafka.HeaderValue(record, kafka.HeaderDLQOffset), 10, 64); err == nil {
+		e.OriginalOffset = offset
+	}
+
+	if attempts, err := strconv.Atoi(kafka.HeaderValue(record, kafka.HeaderDLQAttempts)); err == nil {
+		e.Attempts = attempts
+	}
+
+	if failedAt, err := time.Parse(time.RFC3339Nano, kafka.HeaderValue(record, kafka.HeaderDLQTimestamp)); err == nil {
+		e.FailedAt = failedAt
+	}
+
+	if ev, err := kafka.DecodeEvent(record); err != nil {
+		e.DecodeError = err.Error()
+	} else {
+		e.Event = &ev
+	}
+
+	return e
+}
+
+// ReplayRecord rebuilds the original record of e for its original topic, without the DLQ headers
+func (e Entry) ReplayRecord() (*kgo.Record, error) {
+	if e.OriginalTopic == "" {
+		return nil, fmt.Errorf("entry %s has no original topic", e.ID)
+	}
+
+	headers := make([]kgo.RecordHeader, 0, len(e.record.Headers)+1)
+	for _, h := range e.record.Headers {
+		if !strings.HasPrefix(h.Key, "dlq.") {
+			headers = append(headers, h)
+		}
+	}
+
+	headers = append(headers, kgo.RecordHeader{Key: HeaderReplayedFrom, Value: []byte(e.record.Topic + "/" + e.ID)})
+
+	return &kgo.Record{
+		Topic:   e.OriginalTopic,
+		Key:     e.record.Key,
+		Value:   e.record.Value,
+		Headers: headers,
+	}, nil
+}
+
+// Filter selects entries. Zero fields match everything, and resolved entries are left out
+// unless IncludeResolved is set
+type Filter struct {
+	SagaID          uuid.UUID
+	OrderID         uuid.UUID
+	EventType       models.EventType
+	IDs             []string
+	IncludeResolved bool
+}
+
+func (f Filter) Match(e Entry) bool {
+	if e.Resolved && !f.IncludeResolved {
+		return false
+	}
+
+	if len(f.IDs) > 0 && !contains(f.IDs, e.ID) {
+		return false
+	}
+
+	if f.SagaID == uuid.Nil && f.OrderID == uuid.Nil && f.EventType == "" {
+		return true
+	}
+
+	// Entries that cannot be decoded only match filters that do not look into the event
+	if e.Event == nil {
+		return false
+	}
+
+	if f.SagaID != uuid.Nil && e.Event.SagaID != f.SagaID {
+		return false
+	}
+
+	if f.OrderID != uuid.Nil && e.Event.OrderID != f.OrderID {
+		return false
+	}
+
+	return f.EventType == "" || e.Event.Event == f.EventType
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// ResolvedTopic names the topic that records which entries of dlqTopic were resolved
+func ResolvedTopic(dlqTopic string) string {
+	return dlqTopic + ".resolved"
+}
+
+// resolution is the value of a marker in the resolved topic, keyed by entry ID
+type resolution struct {
+	ResolvedAt time.Time `json:"resolved_at"`
+	Note       string    `json:"note,omitempty"`
+}
+
+// Store reads a DLQ topic and records resolutions next to it. Kafka topics cannot be edited, so
+// resolving an entry writes a marker to ResolvedTopic instead of removing the record
+type Store struct {
+	brokers []string
+	topic   string
+	idle    time.Duration
+}
+
+// NewStore reads dlqTopic through brokers. A read ends once no record arrived for idle
+func NewStore(brokers []string, dlqTopic string, idle time.Duration) *Store {
+	return &Store{brokers: brokers, topic: dlqTopic, idle: idle}
+}
+
+// Entries returns every entry of the DLQ in partition and offset order, with resolutions applied
+func (s *Store) Entries(ctx context.Context) ([]Entry, error) {
+	resolved := make(map[string]resolution)
+
+	err := s.readAll(ctx, ResolvedTopic(s.topic), func(record *kgo.Record) {
+		var r resolution
+		if err := sonic.Unmarshal(record.Value, &r); err != nil {
+			log.Printf("Skipping malformed resolution %s: %v", record.Key, err)
+			return
+		}
+
+		resolved[string(record.Key)] = r
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+
+	err = s.readAll(ctx, s.topic, func(record *kgo.Record) {
+		e := newEntry(record)
+
+		if r, ok := resolved[e.ID]; ok {
+			e.Resolved = true
+			e.ResolvedNote = r.Note
+		}
+
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Partition != entries[j].Partition {
+			return entries[i].Partition < entries[j].Partition
+		}
+
+		return entries[i].Offset < entries[j].Offset
+	})
+
+	return entries, nil
+}
+
+// Resolve marks entries as resolved with an optional note
+func (s *Store) Resolve(ctx context.Context, entries []Entry, note string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(s.brokers...))
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	now := time.Now().UTC()
+	records := make([]*kgo.Record, 0, len(entries))
+
+	for _, e := range entries {
+		value, err := sonic.Marshal(resolution{ResolvedAt: now, Note: note})
+		if err != nil {
+			return err
+		}
+
+		records = append(records, &kgo.Record{Topic: ResolvedTopic(s.topic), Key: []byte(e.ID), Value: value})
+	}
+
+	return client.ProduceSync(ctx, records...).FirstErr()
+}
+
+// readAll hands every record of topic to fn, from the start until the topic has been idle
+func (s *Store) readAll(ctx context.Context, topic string, fn func(*kgo.Record)) error {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(s.brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+	)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, s.idle)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var fetchErr error
+
+		fetches.EachError(func(t string, p int32, err error) {
+			if !errors.Is(err, context.DeadlineExceeded) && fetchErr == nil {
+				fetchErr = err
+			}
+		})
+
+		if fetchErr != nil {
+			return fetchErr
+		}
+
+		if fetches.NumRecords() == 0 {
+			return nil
+		}
+
+		fetches.EachRecord(fn)
+	}
+}
@@ -0,0 +1,196 @@
+package dlq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const testTopic = "orders.dlq"
+
+// newTestStore starts an in-memory Kafka cluster holding the DLQ and its resolved topic
+func newTestStore(t *testing.T) (*Store, []string) {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic, ResolvedTopic(testTopic)))
+	if err != nil {
+		t.Fatalf("kfake.NewCluster() failed: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	brokers := cluster.ListenAddrs()
+
+	return NewStore(brokers, testTopic, 200*time.Millisecond), brokers
+}
+
+func deadLetter(t *testing.T, brokers []string, ev models.Event, cause string) {
+	t.Helper()
+
+	value, err := sonic.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer client.Close()
+
+	record := &kgo.Record{
+		Topic: testTopic,
+		Key:   []byte(ev.SagaID.String()),
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "trace", Value: []byte("abc")},
+			{Key: kafka.HeaderDLQTopic, Value: []byte("payment.replies")},
+			{Key: kafka.HeaderDLQPartition, Value: []byte("0")},
+			{Key: kafka.HeaderDLQOffset, Value: []byte("7")},
+			{Key: kafka.HeaderDLQError, Value: []byte(cause)},
+			{Key: kafka.HeaderDLQAttempts, Value: []byte("3")},
+			{Key: kafka.HeaderDLQTimestamp, Value: []byte("2025-01-02T03:04:05Z")},
+		},
+	}
+
+	if err := client.ProduceSync(context.Background(), record).FirstErr(); err != nil {
+		t.Fatalf("ProduceSync() failed: %v", err)
+	}
+}
+
+func TestStoreEntriesAndResolve(t *testing.T) {
+	store, brokers := newTestStore(t)
+	ctx := context.Background()
+
+	first := models.Event{Event: models.EventPaymentProcessed, EventID: uuid.New(), SagaID: uuid.New(), OrderID: uuid.New()}
+	second := models.Event{Event: models.EventInventoryReserved, EventID: uuid.New(), SagaID: uuid.New(), OrderID: uuid.New()}
+
+	deadLetter(t, brokers, first, "boom")
+	deadLetter(t, brokers, second, "bang")
+
+	entries, err := store.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() failed: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e.ID != "0/0" || e.OriginalTopic != "payment.replies" || e.OriginalOffset != 7 || e.Attempts != 3 || e.Error != "boom" {
+		t.Errorf("Expected failure headers to be decoded, got %+v", e)
+	}
+
+	if !e.FailedAt.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected failed at 2025-01-02T03:04:05Z, got %v", e.FailedAt)
+	}
+
+	if e.Event == nil || e.Event.SagaID != first.SagaID {
+		t.Fatalf("Expected event of saga %s, got %+v", first.SagaID, e.Event)
+	}
+
+	if err := store.Resolve(ctx, entries[:1], "fixed by hand"); err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	entries, err = store.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() failed: %v", err)
+	}
+
+	if !entries[0].Resolved || entries[0].ResolvedNote != "fixed by hand" {
+		t.Errorf("Expected first entry to be resolved, got %+v", entries[0])
+	}
+
+	if entries[1].Resolved {
+		t.Errorf("Expected second entry to stay unresolved")
+	}
+
+	if (Filter{}).Match(entries[0]) {
+		t.Errorf("Expected resolved entries to be hidden by default")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	ev := &models.Event{Event: models.EventPaymentProcessed, SagaID: uuid.New(), OrderID: uuid.New()}
+	entry := Entry{ID: "0/3", Event: ev}
+	undecodable := Entry{ID: "0/4", DecodeError: "invalid character"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		entry  Entry
+		want   bool
+	}{
+		{"empty filter", Filter{}, entry, true},
+		{"matching saga", Filter{SagaID: ev.SagaID}, entry, true},
+		{"other saga", Filter{SagaID: uuid.New()}, entry, false},
+		{"matching order", Filter{OrderID: ev.OrderID}, entry, true},
+		{"other order", Filter{OrderID: uuid.New()}, entry, false},
+		{"matching type", Filter{EventType: models.EventPaymentProcessed}, entry, true},
+		{"other type", Filter{EventType: models.EventInventoryReserved}, entry, false},
+		{"listed ID", Filter{IDs: []string{"0/1", "0/3"}}, entry, true},
+		{"unlisted ID", Filter{IDs: []string{"0/1"}}, entry, false},
+		{"undecodable with empty filter", Filter{}, undecodable, true},
+		{"undecodable with saga filter", Filter{SagaID: ev.SagaID}, undecodable, false},
+		{"resolved", Filter{}, Entry{ID: "0/5", Resolved: true}, false},
+		{"resolved included", Filter{IncludeResolved: true}, Entry{ID: "0/5", Resolved: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.entry); got != tt.want {
+				t.Errorf("Expected Match() = %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReplayRecordStripsDLQHeaders(t *testing.T) {
+	record := &kgo.Record{
+		Topic:     testTopic,
+		Partition: 1,
+		Offset:    9,
+		Key:       []byte("key"),
+		Value:     []byte("{}"),
+		Headers: []kgo.RecordHeader{
+			{Key: "trace", Value: []byte("abc")},
+			{Key: kafka.HeaderDLQTopic, Value: []byte("payment.replies")},
+			{Key: kafka.HeaderDLQError, Value: []byte("boom")},
+		},
+	}
+
+	replay, err := newEntry(record).ReplayRecord()
+	if err != nil {
+		t.Fatalf("ReplayRecord() failed: %v", err)
+	}
+
+	if replay.Topic != "payment.replies" || string(replay.Key) != "key" || string(replay.Value) != "{}" {
+		t.Errorf("Expected the original record for payment.replies, got %+v", replay)
+	}
+
+	if kafka.HeaderValue(replay, kafka.HeaderDLQError) != "" {
+		t.Errorf("Expected DLQ headers to be stripped")
+	}
+
+	if kafka.HeaderValue(replay, "trace") != "abc" {
+		t.Errorf("Expected other headers to be kept")
+	}
+
+	if got := kafka.HeaderValue(replay, HeaderReplayedFrom); got != "orders.dlq/1/9" {
+		t.Errorf("Expected replayed from orders.dlq/1/9, got %q", got)
+	}
+}
+
+func TestReplayRecordRequiresOriginalTopic(t *testing.T) {
+	if _, err := newEntry(&kgo.Record{Topic: testTopic}).ReplayRecord(); err == nil {
+		t.Errorf("Expected an error for an entry without original topic")
+	}
+}
@@ -0,0 +1,57 @@
+package fx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type cachedRate struct {
+	rate      models.ExchangeRate
+	fetchedAt time.Time
+}
+
+// CachedProvider remembers the rates of another provider for ttl, so a rate API is not asked on
+// every order. Failures are not cached
+type CachedProvider struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	rates map[[2]string]cachedRate
+}
+
+func NewCachedProvider(provider Provider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		rates:    make(map[[2]string]cachedRate),
+	}
+}
+
+func (p *CachedProvider) Rate(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	pair := [2]string{base, quote}
+
+	p.mu.Lock()
+	cached, ok := p.rates[pair]
+	p.mu.Unlock()
+
+	if ok && p.now().Sub(cached.fetchedAt) < p.ttl {
+		return cached.rate, nil
+	}
+
+	rate, err := p.provider.Rate(ctx, base, quote)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	p.mu.Lock()
+	p.rates[pair] = cachedRate{rate: rate, fetchedAt: p.now()}
+	p.mu.Unlock()
+
+	return rate, nil
+}
@@ -0,0 +1,152 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+func TestStaticProviderRate(t *testing.T) {
+	provider := NewStaticProvider("USD", map[string]*big.Rat{"EUR": big.NewRat(8, 10), "JPY": big.NewRat(150, 1)}, time.Time{})
+
+	tests := []struct {
+		name       string
+		base       string
+		quote      string
+		expectRate string
+	}{
+		{name: "quoted", base: "USD", quote: "EUR", expectRate: "0.8"},
+		{name: "inverse", base: "EUR", quote: "USD", expectRate: "1.25"},
+		{name: "crossed", base: "EUR", quote: "JPY", expectRate: "187.5"},
+		{name: "same currency", base: "EUR", quote: "EUR", expectRate: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := provider.Rate(context.Background(), tt.base, tt.quote)
+			if err != nil {
+				t.Fatalf("Rate() failed: %v", err)
+			}
+
+			if rate.Base != tt.base || rate.Quote != tt.quote || rate.Rate != tt.expectRate {
+				t.Errorf("Expected %s/%s at %s, got %+v", tt.base, tt.quote, tt.expectRate, rate)
+			}
+		})
+	}
+
+	if _, err := provider.Rate(context.Background(), "USD", "BRL"); !errors.Is(err, ErrUnsupportedPair) {
+		t.Errorf("Expected ErrUnsupportedPair, got %v", err)
+	}
+}
+
+func TestLoadStaticProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		expectErr bool
+	}{
+		{name: "valid", file: `{"base":"USD","as_of":"2026-10-01T00:00:00Z","rates":{"EUR":"0.92"}}`},
+		{name: "malformed", file: `{"base":`, expectErr: true},
+		{name: "unknown base", file: `{"base":"XYZ","rates":{}}`, expectErr: true},
+		{name: "unknown currency", file: `{"base":"USD","rates":{"XYZ":"1.5"}}`, expectErr: true},
+		{name: "invalid rate", file: `{"base":"USD","rates":{"EUR":"-0.92"}}`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rates.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatalf("Failed to write rates file: %v", err)
+			}
+
+			provider, err := LoadStaticProvider(path)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadStaticProvider() failed: %v", err)
+			}
+
+			rate, err := provider.Rate(context.Background(), "USD", "EUR")
+			if err != nil {
+				t.Fatalf("Rate() failed: %v", err)
+			}
+			if rate.Rate != "0.92" || !rate.AsOf.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Unexpected rate %+v", rate)
+			}
+		})
+	}
+}
+
+// countingProvider quotes a fixed rate and counts how often it was asked
+type countingProvider struct {
+	calls int
+	err   error
+}
+
+func (p *countingProvider) Rate(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	p.calls++
+
+	if p.err != nil {
+		return models.ExchangeRate{}, p.err
+	}
+
+	return models.ExchangeRate{Base: base, Quote: quote, Rate: "0.92"}, nil
+}
+
+func TestCachedProviderExpiresRates(t *testing.T) {
+	upstream := &countingProvider{}
+	provider := NewCachedProvider(upstream, time.Minute)
+
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	provider.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := provider.Rate(context.Background(), "USD", "EUR"); err != nil {
+			t.Fatalf("Rate() failed: %v", err)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Expected the rate to be cached, got %d calls", upstream.calls)
+	}
+
+	if _, err := provider.Rate(context.Background(), "USD", "JPY"); err != nil {
+		t.Fatalf("Rate() failed: %v", err)
+	}
+	if upstream.calls != 2 {
+		t.Errorf("Expected each pair to be cached on its own, got %d calls", upstream.calls)
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, err := provider.Rate(context.Background(), "USD", "EUR"); err != nil {
+		t.Fatalf("Rate() failed: %v", err)
+	}
+	if upstream.calls != 3 {
+		t.Errorf("Expected an expired rate to be fetched again, got %d calls", upstream.calls)
+	}
+}
+
+func TestCachedProviderDoesNotCacheFailures(t *testing.T) {
+	upstream := &countingProvider{err: errors.New("rate API down")}
+	provider := NewCachedProvider(upstream, time.Minute)
+
+	for range 2 {
+		if _, err := provider.Rate(context.Background(), "USD", "EUR"); err == nil {
+			t.Fatalf("Expected the provider error to be returned")
+		}
+	}
+
+	if upstream.calls != 2 {
+		t.Errorf("Expected every failed lookup to reach the provider, got %d calls", upstream.calls)
+	}
+}
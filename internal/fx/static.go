@@ -0,0 +1,104 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+var ErrUnsupportedPair = errors.New("no exchange rate for currency pair")
+
+// Provider returns the current rate to convert amounts from base into quote
+type Provider interface {
+	Rate(ctx context.Context, base, quote string) (models.ExchangeRate, error)
+}
+
+// StaticProvider quotes fixed rates against one currency, e.g. from a file updated by a cron job.
+// Rates between two other currencies are crossed through it
+type StaticProvider struct {
+	base  string
+	rates map[string]*big.Rat
+	asOf  time.Time
+}
+
+// NewStaticProvider quotes one unit of base as rates[quote] units of quote
+func NewStaticProvider(base string, rates map[string]*big.Rat, asOf time.Time) *StaticProvider {
+	return &StaticProvider{base: base, rates: rates, asOf: asOf}
+}
+
+// rateFile is the format LoadStaticProvider reads, with rates as decimal strings:
+//
+//	{"base": "USD", "as_of": "2026-10-01T00:00:00Z", "rates": {"EUR": "0.92", "BRL": "5.1"}}
+type rateFile struct {
+	Base  string            `json:"base"`
+	AsOf  time.Time         `json:"as_of"`
+	Rates map[string]string `json:"rates"`
+}
+
+// LoadStaticProvider reads the rates of a StaticProvider from a JSON file
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file rateFile
+	if err := sonic.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode rates file %s: %w", path, err)
+	}
+
+	if _, err := models.CurrencyExponent(file.Base); err != nil {
+		return nil, fmt.Errorf("rates file %s: %w", path, err)
+	}
+
+	rates := make(map[string]*big.Rat, len(file.Rates))
+
+	for currency, value := range file.Rates {
+		if _, err := models.CurrencyExponent(currency); err != nil {
+			return nil, fmt.Errorf("rates file %s: %w", path, err)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("rates file %s: invalid %s rate %q", path, currency, value)
+		}
+
+		rates[currency] = rate
+	}
+
+	return NewStaticProvider(file.Base, rates, file.AsOf), nil
+}
+
+func (p *StaticProvider) Rate(ctx context.Context, base, quote string) (models.ExchangeRate, error) {
+	from, err := p.perBase(base)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	to, err := p.perBase(quote)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	return models.NewExchangeRate(base, quote, new(big.Rat).Quo(to, from), p.asOf)
+}
+
+// perBase returns how many units of currency one unit of the provider's base is worth
+func (p *StaticProvider) perBase(currency string) (*big.Rat, error) {
+	if currency == p.base {
+		return big.NewRat(1, 1), nil
+	}
+
+	rate, ok := p.rates[currency]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no rate against %s", ErrUnsupportedPair, currency, p.base)
+	}
+
+	return rate, nil
+}
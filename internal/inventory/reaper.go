@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// reapBatchSize bounds how many holds are expired in one transaction
+const reapBatchSize = 100
+
+// Reaper returns the stock of holds whose saga never confirmed them, so a crashed orchestrator
+// cannot lock stock up forever. Every expired hold is announced with INVENTORY_HOLD_EXPIRED
+type Reaper struct {
+	store     StockStore
+	publisher EventPublisher
+	topic     string
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func NewReaper(store StockStore, publisher EventPublisher, topic string, interval time.Duration) *Reaper {
+	return &Reaper{
+		store:     store,
+		publisher: publisher,
+		topic:     topic,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Run reaps every interval until ctx is done
+func (r *Reaper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := r.Reap(ctx); err != nil {
+				log.Printf("Inventory reap failed: %v", err)
+			}
+		}
+	}
+}
+
+// Reap expires holds in batches until none are left and returns how many were expired
+func (r *Reaper) Reap(ctx context.Context) (int, error) {
+	total := 0
+
+	for {
+		expired, err := r.store.ExpireHolds(ctx, r.now(), reapBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		for _, hold := range expired {
+			r.announce(ctx, hold)
+		}
+
+		total += len(expired)
+
+		if len(expired) < reapBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// announce publishes the expiry notice. The stock is already back at this point, so a failed
+// publish is only logged
+func (r *Reaper) announce(ctx context.Context, hold Reservation) {
+	ev, err := models.NewEvent(models.EventInventoryHoldExpired, hold.SagaID, hold.OrderID, models.InventoryHoldExpiredEvent{Items: hold.Items})
+	if err != nil {
+		log.Printf("Failed to build hold expiry notice for saga %s: %v", hold.SagaID, err)
+		return
+	}
+
+	if err := r.publisher.PublishEvent(ctx, r.topic, []byte(hold.SagaID.String()), ev); err != nil {
+		log.Printf("Failed to announce expired hold of saga %s: %v", hold.SagaID, err)
+		return
+	}
+
+	log.Printf("Hold of saga %s expired at %s, stock returned", hold.SagaID, hold.ExpiresAt.Format(time.RFC3339))
+}
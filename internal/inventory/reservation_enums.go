@@ -0,0 +1,11 @@
+package inventory
+
+// ReservationStatus represents the lifecycle of a stock hold taken for a saga.
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "HELD"
+	ReservationConfirmed ReservationStatus = "CONFIRMED"
+	ReservationReleased  ReservationStatus = "RELEASED"
+	ReservationExpired   ReservationStatus = "EXPIRED"
+)
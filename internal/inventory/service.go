@@ -0,0 +1,113 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// EventPublisher is the part of kafka.Producer the service needs to send replies
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// Service handles inventory commands and replies to the saga orchestrator
+type Service struct {
+	store      StockStore
+	publisher  EventPublisher
+	replyTopic string
+	holdTTL    time.Duration
+}
+
+func NewService(store StockStore, publisher EventPublisher, replyTopic string, holdTTL time.Duration) *Service {
+	return &Service{
+		store:      store,
+		publisher:  publisher,
+		replyTopic: replyTopic,
+		holdTTL:    holdTTL,
+	}
+}
+
+// Routes returns the router for the reserve, release and confirm commands. Stock problems are answered
+// with a failure reply, while infrastructure errors are returned so the record can be retried.
+// Confirmations are sent once the saga is over, so they get no reply and a hold that cannot be
+// confirmed anymore is dead-lettered
+func (s *Service) Routes() *kafka.Router {
+	r := kafka.NewCommandRouter()
+
+	kafka.Route(r, models.EventReserveInventory, s.reserve)
+	// The hold knows what was reserved, the items in the release command are informative only
+	r.Handle(models.EventReleaseInventory, s.release)
+	r.Handle(models.EventConfirmInventory, s.confirm)
+
+	return r
+}
+
+func (s *Service) reserve(ctx context.Context, ev models.Event, cmd models.ReserveInventoryCommand) error {
+	err := s.store.Reserve(ctx, ev.SagaID, ev.OrderID, cmd.Items, s.holdTTL)
+
+	return s.reply(ctx, ev, err, models.EventInventoryReserved, models.EventInventoryFailed)
+}
+
+func (s *Service) release(ctx context.Context, ev models.Event) error {
+	err := s.store.Release(ctx, ev.SagaID)
+
+	return s.reply(ctx, ev, err, models.EventInventoryReleased, models.EventInventoryReleaseFailed)
+}
+
+func (s *Service) confirm(ctx context.Context, ev models.Event) error {
+	err := s.store.Confirm(ctx, ev.SagaID)
+	if err != nil && !isBusinessError(err) {
+		return err
+	}
+
+	// The saga already completed, so a hold that is gone means its stock went back to the pool
+	// and may have been sold twice. Nobody is waiting on a reply, the DLQ is where it gets seen
+	if err != nil {
+		return kafka.Fatal(fmt.Errorf("stock of completed saga %s may be oversold: %w", ev.SagaID, err))
+	}
+
+	log.Printf("Inventory of saga %s confirmed", ev.SagaID)
+
+	return nil
+}
+
+func (s *Service) reply(ctx context.Context, cmd models.Event, result error, success, failure models.EventType) error {
+	if result != nil && !isBusinessError(result) {
+		return result
+	}
+
+	eventType := success
+	reply := models.InventoryReply{Success: true, Message: "ok"}
+
+	if result != nil {
+		eventType = failure
+		reply = models.InventoryReply{Success: false, Message: result.Error()}
+	}
+
+	ev, err := models.NewEvent(eventType, cmd.SagaID, cmd.OrderID, reply)
+	if err != nil {
+		return err
+	}
+
+	if err := s.publisher.PublishEvent(ctx, s.replyTopic, []byte(cmd.SagaID.String()), ev); err != nil {
+		return err
+	}
+
+	log.Printf("%s for saga %s: %s", eventType, cmd.SagaID, reply.Message)
+
+	return nil
+}
+
+func isBusinessError(err error) bool {
+	return errors.Is(err, ErrInsufficientStock) ||
+		errors.Is(err, ErrUnknownItem) ||
+		errors.Is(err, ErrInvalidQuantity) ||
+		errors.Is(err, ErrReservationClosed) ||
+		errors.Is(err, ErrUnknownReservation)
+}
@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type fakeStockStore struct {
+	reserveErr error
+	confirmErr error
+	released   []uuid.UUID
+	confirmed  []uuid.UUID
+	expired    []Reservation
+}
+
+func (f *fakeStockStore) Reserve(ctx context.Context, sagaID, orderID uuid.UUID, items []models.InventoryItem, ttl time.Duration) error {
+	return f.reserveErr
+}
+
+func (f *fakeStockStore) Release(ctx context.Context, sagaID uuid.UUID) error {
+	f.released = append(f.released, sagaID)
+	return nil
+}
+
+func (f *fakeStockStore) Confirm(ctx context.Context, sagaID uuid.UUID) error {
+	f.confirmed = append(f.confirmed, sagaID)
+	return f.confirmErr
+}
+
+func (f *fakeStockStore) ExpireHolds(ctx context.Context, now time.Time, limit int) ([]Reservation, error) {
+	expired := f.expired
+	f.expired = nil
+	return expired, nil
+}
+
+type fakePublisher struct {
+	topic  string
+	events []models.Event
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	p.topic = topic
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func command(t *testing.T, eventType models.EventType, payload any) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(eventType, uuid.New(), uuid.New(), payload)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func TestServiceRepliesToReserve(t *testing.T) {
+	items := []models.InventoryItem{{ItemID: uuid.New(), Quantity: 1}}
+
+	tests := []struct {
+		name        string
+		reserveErr  error
+		expectEvent models.EventType
+		expectErr   bool
+	}{
+		{name: "reserved", expectEvent: models.EventInventoryReserved},
+		{name: "shortage", reserveErr: ErrInsufficientStock, expectEvent: models.EventInventoryFailed},
+		{name: "database down", reserveErr: errors.New("connection refused"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &fakePublisher{}
+			handle := NewService(&fakeStockStore{reserveErr: tt.reserveErr}, publisher, "inventory.replies", time.Minute).Routes().HandleEvent
+
+			cmd := command(t, models.EventReserveInventory, models.ReserveInventoryCommand{Items: items})
+			err := handle(context.Background(), cmd)
+
+			if tt.expectErr {
+				if err == nil || len(publisher.events) != 0 {
+					t.Fatalf("Expected error and no reply, got %v and %d replies", err, len(publisher.events))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("handle() failed: %v", err)
+			}
+			if len(publisher.events) != 1 || publisher.topic != "inventory.replies" {
+				t.Fatalf("Expected one reply on inventory.replies, got %d on %s", len(publisher.events), publisher.topic)
+			}
+
+			reply := publisher.events[0]
+			if reply.Event != tt.expectEvent || reply.SagaID != cmd.SagaID || reply.OrderID != cmd.OrderID {
+				t.Errorf("Unexpected reply %s for saga %s", reply.Event, reply.SagaID)
+			}
+
+			var payload models.InventoryReply
+			if err := sonic.Unmarshal(reply.Payload, &payload); err != nil {
+				t.Fatalf("Failed to decode reply: %v", err)
+			}
+			if payload.Success != (tt.reserveErr == nil) {
+				t.Errorf("Expected success %v, got %v", tt.reserveErr == nil, payload.Success)
+			}
+		})
+	}
+}
+
+func TestServiceReleasesInventory(t *testing.T) {
+	store := &fakeStockStore{}
+	publisher := &fakePublisher{}
+	handle := NewService(store, publisher, "inventory.replies", time.Minute).Routes().HandleEvent
+
+	cmd := command(t, models.EventReleaseInventory, models.ReleaseInventoryCommand{Items: []models.InventoryItem{{ItemID: uuid.New(), Quantity: 3}}})
+	if err := handle(context.Background(), cmd); err != nil {
+		t.Fatalf("handle() failed: %v", err)
+	}
+
+	if len(store.released) != 1 || store.released[0] != cmd.SagaID {
+		t.Errorf("Expected the hold of saga %s to be released, got %v", cmd.SagaID, store.released)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].Event != models.EventInventoryReleased {
+		t.Errorf("Expected INVENTORY_RELEASED reply, got %+v", publisher.events)
+	}
+}
+
+func TestServiceConfirmsWithoutReply(t *testing.T) {
+	store := &fakeStockStore{}
+	publisher := &fakePublisher{}
+	handle := NewService(store, publisher, "inventory.replies", time.Minute).Routes().HandleEvent
+
+	cmd := command(t, models.EventConfirmInventory, models.ConfirmInventoryCommand{})
+	if err := handle(context.Background(), cmd); err != nil {
+		t.Fatalf("handle() failed: %v", err)
+	}
+
+	if len(store.confirmed) != 1 || store.confirmed[0] != cmd.SagaID {
+		t.Errorf("Expected the hold of saga %s to be confirmed, got %v", cmd.SagaID, store.confirmed)
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no reply to a confirmation, got %d", len(publisher.events))
+	}
+}
+
+func TestServiceDeadLettersClosedConfirmation(t *testing.T) {
+	store := &fakeStockStore{confirmErr: ErrReservationClosed}
+	publisher := &fakePublisher{}
+	handle := NewService(store, publisher, "inventory.replies", time.Minute).Routes().HandleEvent
+
+	err := handle(context.Background(), command(t, models.EventConfirmInventory, models.ConfirmInventoryCommand{}))
+	if !errors.Is(err, ErrReservationClosed) {
+		t.Fatalf("Expected ErrReservationClosed, got %v", err)
+	}
+	if kafka.IsRetryable(err) {
+		t.Errorf("Expected the closed hold to be dead-lettered without retries")
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no reply to a confirmation, got %d", len(publisher.events))
+	}
+}
+
+func TestReaperAnnouncesExpiredHolds(t *testing.T) {
+	hold := Reservation{SagaID: uuid.New(), OrderID: uuid.New(), Items: []models.InventoryItem{{ItemID: uuid.New(), Quantity: 1}}}
+	store := &fakeStockStore{expired: []Reservation{hold}}
+	publisher := &fakePublisher{}
+
+	reaped, err := NewReaper(store, publisher, "inventory.replies", time.Second).Reap(context.Background())
+	if err != nil {
+		t.Fatalf("Reap() failed: %v", err)
+	}
+
+	if reaped != 1 || len(publisher.events) != 1 {
+		t.Fatalf("Expected one expired hold announced, got %d reaped and %d events", reaped, len(publisher.events))
+	}
+
+	ev := publisher.events[0]
+	if ev.Event != models.EventInventoryHoldExpired || ev.SagaID != hold.SagaID || ev.OrderID != hold.OrderID {
+		t.Errorf("Unexpected notice %s for saga %s", ev.Event, ev.SagaID)
+	}
+}
@@ -0,0 +1,316 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+var (
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrUnknownItem        = errors.New("unknown item")
+	ErrInvalidQuantity    = errors.New("quantity must be positive")
+	ErrReservationClosed  = errors.New("reservation was already released or expired")
+	ErrUnknownReservation = errors.New("no reservation for saga")
+)
+
+// Reservation is a stock hold taken for one saga
+type Reservation struct {
+	SagaID    uuid.UUID
+	OrderID   uuid.UUID
+	Items     []models.InventoryItem
+	Status    ReservationStatus
+	ExpiresAt time.Time
+}
+
+// StockStore manages stock holds. A hold takes the stock out of items right away and is either
+// confirmed when the order completes, released by compensation, or expired by the reaper
+type StockStore interface {
+	// Reserve takes stock for every item and records a hold for sagaID that expires after ttl
+	Reserve(ctx context.Context, sagaID, orderID uuid.UUID, items []models.InventoryItem, ttl time.Duration) error
+	// Release returns the held stock of sagaID. Releasing twice, or a saga without a hold, is a no-op
+	Release(ctx context.Context, sagaID uuid.UUID) error
+	// Confirm makes the hold of sagaID permanent so it no longer expires
+	Confirm(ctx context.Context, sagaID uuid.UUID) error
+	// ExpireHolds returns the stock of up to limit holds that expired before now and marks them EXPIRED
+	ExpireHolds(ctx context.Context, now time.Time, limit int) ([]Reservation, error)
+}
+
+// PostgresStore keeps stock in the items table and holds in the reservations table. Every call
+// runs in one transaction, so a shortage on any item rolls back the whole reservation
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, sagaID, orderID uuid.UUID, items []models.InventoryItem, ttl time.Duration) error {
+	merged, err := mergeItems(items)
+	if err != nil {
+		return err
+	}
+
+	itemsJSON, err := sonic.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	return postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		// The hold row doubles as an idempotency key, a redelivered command finds it and stops here
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO reservations (saga_id, order_id, items, status, expires_at)
+			 VALUES ($1, $2, $3, $4, now() + $5 * interval '1 millisecond')
+			 ON CONFLICT (saga_id) DO NOTHING`,
+			sagaID, orderID, itemsJSON, ReservationHeld, ttl.Milliseconds(),
+		)
+		if err != nil {
+			return err
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return existingHold(ctx, tx, sagaID)
+		}
+
+		for _, item := range merged {
+			// The conditional update takes the row lock and checks the stock in one statement
+			res, err := tx.ExecContext(ctx,
+				`UPDATE items SET stock = stock - $1 WHERE id = $2 AND stock >= $1`,
+				item.Quantity, item.ItemID,
+			)
+			if err != nil {
+				return err
+			}
+
+			if err := expectOneRow(ctx, tx, res, item.ItemID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *PostgresStore) Release(ctx context.Context, sagaID uuid.UUID) error {
+	return postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var (
+			itemsJSON []byte
+			status    ReservationStatus
+		)
+
+		err := tx.QueryRowContext(ctx,
+			`SELECT items, status FROM reservations WHERE saga_id = $1 FOR UPDATE`,
+			sagaID,
+		).Scan(&itemsJSON, &status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if status == ReservationReleased || status == ReservationExpired {
+			return nil
+		}
+
+		var items []models.InventoryItem
+		if err := sonic.Unmarshal(itemsJSON, &items); err != nil {
+			return fmt.Errorf("failed to decode reservation items of saga %s: %w", sagaID, err)
+		}
+
+		if err := restock(ctx, tx, items); err != nil {
+			return err
+		}
+
+		return setStatus(ctx, tx, sagaID, ReservationReleased)
+	})
+}
+
+func (s *PostgresStore) Confirm(ctx context.Context, sagaID uuid.UUID) error {
+	return postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE reservations SET status = $1, updated_at = now() WHERE saga_id = $2 AND status = $3`,
+			ReservationConfirmed, sagaID, ReservationHeld,
+		)
+		if err != nil {
+			return err
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return existingHold(ctx, tx, sagaID)
+		}
+
+		return nil
+	})
+}
+
+func (s *PostgresStore) ExpireHolds(ctx context.Context, now time.Time, limit int) ([]Reservation, error) {
+	var expired []Reservation
+
+	err := postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		// SKIP LOCKED lets several reapers share the work without waiting on each other
+		rows, err := tx.QueryContext(ctx,
+			`SELECT saga_id, order_id, items, expires_at FROM reservations
+			 WHERE status = $1 AND expires_at <= $2
+			 ORDER BY expires_at
+			 LIMIT $3
+			 FOR UPDATE SKIP LOCKED`,
+			ReservationHeld, now, limit,
+		)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var (
+				r         = Reservation{Status: ReservationExpired}
+				itemsJSON []byte
+			)
+
+			if err := rows.Scan(&r.SagaID, &r.OrderID, &itemsJSON, &r.ExpiresAt); err != nil {
+				rows.Close()
+				return err
+			}
+
+			if err := sonic.Unmarshal(itemsJSON, &r.Items); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to decode reservation items of saga %s: %w", r.SagaID, err)
+			}
+
+			expired = append(expired, r)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range expired {
+			if err := restock(ctx, tx, r.Items); err != nil {
+				return err
+			}
+
+			if err := setStatus(ctx, tx, r.SagaID, ReservationExpired); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// existingHold decides what an already present hold means for a reserve or confirm: an active
+// hold is fine, a released or expired one cannot be used anymore
+func existingHold(ctx context.Context, tx *sql.Tx, sagaID uuid.UUID) error {
+	var status ReservationStatus
+
+	err := tx.QueryRowContext(ctx, `SELECT status FROM reservations WHERE saga_id = $1`, sagaID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w %s", ErrUnknownReservation, sagaID)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case ReservationHeld, ReservationConfirmed:
+		return nil
+	default:
+		return fmt.Errorf("%w: saga %s is %s", ErrReservationClosed, sagaID, status)
+	}
+}
+
+func setStatus(ctx context.Context, tx *sql.Tx, sagaID uuid.UUID, status ReservationStatus) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE reservations SET status = $1, updated_at = now() WHERE saga_id = $2`,
+		status, sagaID,
+	)
+
+	return err
+}
+
+func restock(ctx context.Context, tx *sql.Tx, items []models.InventoryItem) error {
+	for _, item := range items {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE items SET stock = stock + $1 WHERE id = $2`,
+			item.Quantity, item.ItemID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := expectOneRow(ctx, tx, res, item.ItemID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expectOneRow tells a missing item apart from one without enough stock when an update matched nothing
+func expectOneRow(ctx context.Context, tx *sql.Tx, res sql.Result, itemID uuid.UUID) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 1 {
+		return nil
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM items WHERE id = $1)`, itemID).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownItem, itemID)
+	}
+
+	return fmt.Errorf("%w: %s", ErrInsufficientStock, itemID)
+}
+
+// mergeItems sums quantities per item and sorts by ID, so concurrent commands lock rows in the
+// same order and cannot deadlock
+func mergeItems(items []models.InventoryItem) ([]models.InventoryItem, error) {
+	quantities := make(map[uuid.UUID]int, len(items))
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %s has %d", ErrInvalidQuantity, item.ItemID, item.Quantity)
+		}
+
+		quantities[item.ItemID] += item.Quantity
+	}
+
+	merged := make([]models.InventoryItem, 0, len(quantities))
+	for itemID, quantity := range quantities {
+		merged = append(merged, models.InventoryItem{ItemID: itemID, Quantity: quantity})
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return bytes.Compare(merged[i].ItemID[:], merged[j].ItemID[:]) < 0
+	})
+
+	return merged, nil
+}
@@ -0,0 +1,180 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+const (
+	insertHold     = `INSERT INTO reservations`
+	decrementStock = `UPDATE items SET stock = stock - \$1 WHERE id = \$2 AND stock >= \$1`
+	incrementStock = `UPDATE items SET stock = stock \+ \$1 WHERE id = \$2`
+)
+
+func newMockStore(t *testing.T) (*PostgresStore, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations: %v", err)
+		}
+		db.Close()
+	})
+
+	return NewPostgresStore(db), mock
+}
+
+func TestReserveRollsBackOnShortage(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	sagaID, orderID := uuid.New(), uuid.New()
+	first := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	second := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertHold).
+		WithArgs(sagaID, orderID, sqlmock.AnyArg(), ReservationHeld, int64(60000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(decrementStock).
+		WithArgs(3, first).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(decrementStock).
+		WithArgs(1, second).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(second).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	// Items come in unsorted and split across lines, they are merged and locked in ID order
+	err := store.Reserve(context.Background(), sagaID, orderID, []models.InventoryItem{
+		{ItemID: second, Quantity: 1},
+		{ItemID: first, Quantity: 1},
+		{ItemID: first, Quantity: 2},
+	}, time.Minute)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+}
+
+func TestReserveIsIdempotentPerSaga(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	sagaID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertHold).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT status FROM reservations`).
+		WithArgs(sagaID).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(ReservationHeld))
+	mock.ExpectCommit()
+
+	err := store.Reserve(context.Background(), sagaID, uuid.New(), []models.InventoryItem{{ItemID: uuid.New(), Quantity: 1}}, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected duplicate reserve to succeed without touching stock, got %v", err)
+	}
+}
+
+func TestReleaseReturnsHeldStock(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	sagaID, itemID := uuid.New(), uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT items, status FROM reservations`).
+		WithArgs(sagaID).
+		WillReturnRows(sqlmock.NewRows([]string{"items", "status"}).
+			AddRow([]byte(`[{"item_id":"`+itemID.String()+`","quantity":2}]`), ReservationHeld))
+	mock.ExpectExec(incrementStock).
+		WithArgs(2, itemID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE reservations SET status`).
+		WithArgs(ReservationReleased, sagaID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.Release(context.Background(), sagaID); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+}
+
+func TestReleaseSkipsExpiredHold(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	sagaID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT items, status FROM reservations`).
+		WithArgs(sagaID).
+		WillReturnRows(sqlmock.NewRows([]string{"items", "status"}).AddRow([]byte(`[]`), ReservationExpired))
+	mock.ExpectCommit()
+
+	if err := store.Release(context.Background(), sagaID); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+}
+
+func TestConfirmExpiredHold(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	sagaID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE reservations SET status`).
+		WithArgs(ReservationConfirmed, sagaID, ReservationHeld).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT status FROM reservations`).
+		WithArgs(sagaID).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(ReservationExpired))
+	mock.ExpectRollback()
+
+	if err := store.Confirm(context.Background(), sagaID); !errors.Is(err, ErrReservationClosed) {
+		t.Fatalf("Expected ErrReservationClosed, got %v", err)
+	}
+}
+
+func TestExpireHoldsRestocks(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	now := time.Now()
+	sagaID, orderID, itemID := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT saga_id, order_id, items, expires_at FROM reservations`).
+		WithArgs(ReservationHeld, now, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"saga_id", "order_id", "items", "expires_at"}).
+			AddRow(sagaID, orderID, []byte(`[{"item_id":"`+itemID.String()+`","quantity":4}]`), now.Add(-time.Minute)))
+	mock.ExpectExec(incrementStock).
+		WithArgs(4, itemID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE reservations SET status`).
+		WithArgs(ReservationExpired, sagaID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	expired, err := store.ExpireHolds(context.Background(), now, 10)
+	if err != nil {
+		t.Fatalf("ExpireHolds() failed: %v", err)
+	}
+
+	if len(expired) != 1 || expired[0].SagaID != sagaID || expired[0].Items[0].Quantity != 4 {
+		t.Errorf("Unexpected expired holds %+v", expired)
+	}
+}
+
+func TestReserveRejectsInvalidQuantity(t *testing.T) {
+	err := NewPostgresStore(nil).Reserve(context.Background(), uuid.New(), uuid.New(), []models.InventoryItem{{ItemID: uuid.New(), Quantity: 0}}, time.Minute)
+	if !errors.Is(err, ErrInvalidQuantity) {
+		t.Fatalf("Expected ErrInvalidQuantity, got %v", err)
+	}
+}
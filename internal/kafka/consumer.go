@@ -3,88 +3,334 @@ package kafka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 // I  know two clients is not ideal but the separation of concerns is just while I get used to all this stuff
 
 type Consumer struct {
-	Client *kgo.Client
-	cfg    *config.Config
+	Client   *kgo.Client
+	cfg      *config.Config
+	topics   []string
+	dlqTopic string
+	tiers    []retryTier
+	session  transactSession
+	workers  *partitionWorkers
+	// inFlight holds a slot for every record being handled, capping them at Kafka.MaxInFlight
+	inFlight chan struct{}
+}
+
+// retryTier consumes the retry topics of one delay with its own client and group, so waiting
+// for a delay only holds back records of the same tier
+type retryTier struct {
+	delay   time.Duration
+	client  *kgo.Client
+	workers *partitionWorkers
 }
 
 type RecordHandler func(ctx context.Context, record *kgo.Record) error
 
-func NewConsumer(cfg *config.Config, groupID string, topics []string) (*Consumer, error) {
-	client, err := kgo.NewClient(
+// EventHandler handles one decoded event envelope
+type EventHandler func(ctx context.Context, ev models.Event) error
+
+// HandleEvents decodes the event envelope of each record and hands it to handle. Records that
+// cannot be decoded are fatal
+func HandleEvents(handle EventHandler) RecordHandler {
+	return func(ctx context.Context, record *kgo.Record) error {
+		ev, err := DecodeEvent(record)
+		if err != nil {
+			return err
+		}
+
+		return handle(ctx, ev)
+	}
+}
+
+// NewConsumer creates a group consumer for topics. Records the handler keeps failing on move
+// through the retry topics of Kafka.RetryTiers and are then sent to dlqTopic. An empty dlqTopic
+// makes Consume stop on them instead
+func NewConsumer(cfg *config.Config, groupID string, topics []string, dlqTopic string) (*Consumer, error) {
+	workers := newPartitionWorkers()
+
+	client, err := newGroupClient(cfg, groupID, topics, workers)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		Client:   client,
+		cfg:      cfg,
+		topics:   topics,
+		dlqTopic: dlqTopic,
+		workers:  workers,
+		inFlight: make(chan struct{}, max(cfg.Kafka.MaxInFlight, 1)),
+	}
+
+	for _, delay := range cfg.Kafka.RetryTiers {
+		retryTopics := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			retryTopics = append(retryTopics, RetryTopic(topic, delay))
+		}
+
+		tierWorkers := newPartitionWorkers()
+
+		tierClient, err := newGroupClient(cfg, fmt.Sprintf("%s.retry.%s", groupID, delayLabel(delay)), retryTopics, tierWorkers)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		c.tiers = append(c.tiers, retryTier{delay: delay, client: tierClient, workers: tierWorkers})
+	}
+
+	return c, nil
+}
+
+func newGroupClient(cfg *config.Config, groupID string, topics []string, workers *partitionWorkers) (*kgo.Client, error) {
+	return kgo.NewClient(
 		kgo.SeedBrokers(cfg.Kafka.Brokers...),
 		kgo.WithLogger(kgo.BasicLogger(log.Writer(), kgo.LogLevelDebug, nil)),
 		kgo.ConsumerGroup(groupID),
 		kgo.ConsumeTopics(topics...),
-		kgo.DisableAutoCommit(),
+		// Only records that were handled are marked, so neither autocommits nor the commits on
+		// revoke and shutdown ever skip a record still in flight
+		kgo.AutoCommitMarks(),
+		// Rebalances wait until the polled records are handed to their workers, so a worker is
+		// never started for a partition that was just revoked
+		kgo.BlockRebalanceOnPoll(),
+		kgo.OnPartitionsRevoked(workers.revoked),
+		kgo.OnPartitionsLost(workers.lost),
+		// Records of aborted transactions, see NewTransactionalConsumer, must never be handled
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
 	)
+}
 
-	if err != nil {
-		return nil, err
+// Close closes the main client and the clients of the retry tiers
+func (c *Consumer) Close() {
+	if c.session != nil {
+		c.session.Close()
+		return
 	}
 
-	return &Consumer{
-		Client: client,
-		cfg:    cfg,
-	}, nil
+	c.Client.Close()
+
+	for _, tier := range c.tiers {
+		tier.client.Close()
+	}
 }
 
+// Consume runs handler on the consumed topics and on every retry tier until ctx is cancelled or
+// a record can neither be retried nor dead-lettered
 func (c *Consumer) Consume(ctx context.Context, handler RecordHandler) error {
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Shutdown consumer...")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
 
-			defer cancel()
+	run := func(client *kgo.Client, workers *partitionWorkers, tier int) {
+		defer wg.Done()
 
-			if err := c.Client.CommitUncommittedOffsets(shutdownCtx); err != nil {
-				log.Printf("Failed to commit offsets during shutdown: %v", err)
-			}
+		if err := c.consume(ctx, client, workers, handler, tier); err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+	}
+
+	wg.Add(1 + len(c.tiers))
+
+	go run(c.Client, c.workers, -1)
+
+	for i, tier := range c.tiers {
+		go run(tier.client, tier.workers, i)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// consume polls client and hands the records of each partition to its worker in workers. tier
+// is the index of the retry tier the client belongs to, -1 for the main topics. It returns once
+// ctx is cancelled or a worker fails, after stopping the workers and committing what they handled
+func (c *Consumer) consume(ctx context.Context, client *kgo.Client, workers *partitionWorkers, handler RecordHandler, tier int) error {
+	pollCtx, stopPolling := context.WithCancelCause(ctx)
+	defer stopPolling(nil)
+
+	run := func(ctx context.Context, record *kgo.Record) error {
+		return c.processInFlight(ctx, handler, record, tier)
+	}
+
+	err := c.poll(pollCtx, client, workers, run, stopPolling)
+	if ctx.Err() != nil {
+		log.Println("Shutdown consumer...")
+	} else if cause := context.Cause(pollCtx); cause != nil {
+		// Polling was stopped by a failed worker
+		err = cause
+	}
+
+	workers.stopAll(client)
+
+	// Only the records up to the first unfinished one of each partition are marked, so
+	// committing them never skips a record even when processing was interrupted
+	if commitErr := commitMarked(client); commitErr != nil {
+		log.Printf("Failed to commit offsets: %v", commitErr)
+	}
+
+	return err
+}
 
+// poll hands polled records to workers until ctx is cancelled, either from outside or by fail
+// when a worker gives up on a record
+func (c *Consumer) poll(ctx context.Context, client *kgo.Client, workers *partitionWorkers, run recordRunner, fail context.CancelCauseFunc) error {
+	defer client.AllowRebalance()
+
+	for {
+		fetches := client.PollFetches(ctx)
+
+		if ctx.Err() != nil {
 			return ctx.Err()
-		default:
-			var processErr error
+		}
 
-			fetches := c.Client.PollFetches(ctx)
+		if fetches.IsClientClosed() {
+			return errors.New("client closed")
+		}
 
-			if fetches.IsClientClosed() {
-				return errors.New("client closed")
-			}
+		if err := fetches.Err(); err != nil {
+			log.Printf("fetch records error: %v", err)
+			return err
+		}
 
-			if err := fetches.Err(); err != nil {
-				log.Printf("fetch records error: %v", err)
-				return err
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			if len(p.Records) > 0 {
+				workers.dispatch(ctx, client, p, run, fail)
 			}
+		})
 
-			fetches.EachRecord(func(record *kgo.Record) {
-				if processErr != nil {
-					return
-				}
+		client.AllowRebalance()
+	}
+}
 
-				if err := handler(ctx, record); err != nil {
-					log.Printf("error handling record: %v", err)
-					processErr = err
-					return
-				}
-			})
+// commitMarked commits the marked offsets of client. It does not take the consume ctx, which may
+// already be cancelled while the offsets of finished records still have to be committed
+func commitMarked(client *kgo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return client.CommitMarkedOffsets(ctx)
+}
+
+// processInFlight processes record once its tier delay has passed and an in-flight slot is free
+func (c *Consumer) processInFlight(ctx context.Context, handler RecordHandler, record *kgo.Record, tier int) error {
+	if tier >= 0 {
+		if err := c.waitForTier(ctx, record, c.tiers[tier].delay); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case c.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	defer func() { <-c.inFlight }()
+
+	return c.process(ctx, handler, record, tier)
+}
+
+// waitForTier holds a retry record back until its tier delay has passed since it was published
+func (c *Consumer) waitForTier(ctx context.Context, record *kgo.Record, delay time.Duration) error {
+	wait := time.Until(record.Timestamp.Add(delay))
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// process runs handler on record, retrying with a growing backoff. A record that still fails
+// after Kafka.HandlerAttempts moves to the next retry tier, or to the DLQ after the last one.
+// Fatal errors go to the DLQ straight away
+func (c *Consumer) process(ctx context.Context, handler RecordHandler, record *kgo.Record, tier int) error {
+	o := recordOrigin(record)
+
+	for attempt := 1; ; attempt++ {
+		err := handler(ctx, record)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		o.attempts++
+
+		log.Printf("Failed to handle record %s/%d@%d (attempt %d): %v", record.Topic, record.Partition, record.Offset, o.attempts, err)
+
+		if !IsRetryable(err) {
+			return c.deadLetter(ctx, record, err, o)
+		}
 
-			if processErr != nil {
-				//TODO: add to DLQ
-				return processErr
+		if attempt >= c.cfg.Kafka.HandlerAttempts {
+			if tier+1 < len(c.tiers) {
+				return c.retryLater(ctx, record, c.tiers[tier+1].delay, o)
 			}
 
-			c.Client.CommitUncommittedOffsets(ctx)
+			return c.deadLetter(ctx, record, err, o)
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * c.cfg.Kafka.RetryBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
+
+func (c *Consumer) retryLater(ctx context.Context, record *kgo.Record, delay time.Duration, o origin) error {
+	retryTopic := RetryTopic(o.topic, delay)
+
+	if err := c.Client.ProduceSync(ctx, newRetryRecord(record, retryTopic, o, time.Now())).FirstErr(); err != nil {
+		return fmt.Errorf("failed to send record %s/%d@%d to retry topic %s: %w", record.Topic, record.Partition, record.Offset, retryTopic, err)
+	}
+
+	log.Printf("Sent record %s/%d@%d to %s after %d attempts", record.Topic, record.Partition, record.Offset, retryTopic, o.attempts)
+
+	return nil
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, record *kgo.Record, cause error, o origin) error {
+	if c.dlqTopic == "" {
+		return fmt.Errorf("no DLQ configured for %s: %w", record.Topic, cause)
+	}
+
+	dlqRecord := newDLQRecord(record, c.dlqTopic, cause, o, time.Now())
+
+	if err := c.Client.ProduceSync(ctx, dlqRecord).FirstErr(); err != nil {
+		//TODO: emit metrics
+		return fmt.Errorf("failed to send record %s/%d@%d to DLQ %s: %w", record.Topic, record.Partition, record.Offset, c.dlqTopic, err)
+	}
+
+	log.Printf("Sent record %s/%d@%d to DLQ %s after %d attempts", record.Topic, record.Partition, record.Offset, c.dlqTopic, o.attempts)
+
+	return nil
+}
@@ -0,0 +1,539 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newTestCluster starts an in-memory Kafka cluster with the given topics
+func newTestCluster(t *testing.T, topics ...string) *config.Config {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, topics...))
+	if err != nil {
+		t.Fatalf("kfake.NewCluster() failed: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	return &config.Config{Kafka: config.KafkaConfig{
+		Brokers:         cluster.ListenAddrs(),
+		HandlerAttempts: 2,
+		RetryBackoff:    time.Millisecond,
+	}}
+}
+
+func produce(t *testing.T, cfg *config.Config, records ...*kgo.Record) {
+	t.Helper()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(cfg.Kafka.Brokers...))
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		t.Fatalf("ProduceSync() failed: %v", err)
+	}
+}
+
+// consumeOne reads the first record of topic
+func consumeOne(t *testing.T, cfg *config.Config, topic string) *kgo.Record {
+	t.Helper()
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cfg.Kafka.Brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fetches := client.PollRecords(ctx, 1)
+	if err := fetches.Err(); err != nil {
+		t.Fatalf("PollRecords(%s) failed: %v", topic, err)
+	}
+
+	records := fetches.Records()
+	if len(records) != 1 {
+		t.Fatalf("Expected a record on %s, got %d", topic, len(records))
+	}
+
+	return records[0]
+}
+
+func TestConsumeSendsFailingRecordsToDLQ(t *testing.T) {
+	cfg := newTestCluster(t, "commands", "commands.dlq")
+
+	produce(t, cfg,
+		&kgo.Record{Topic: "commands", Key: []byte("saga-1"), Value: []byte("poison"), Headers: []kgo.RecordHeader{{Key: "metadata", Value: []byte("m")}}},
+		&kgo.Record{Topic: "commands", Key: []byte("saga-2"), Value: []byte("good")},
+	)
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "commands.dlq")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attempts := 0
+
+	err = consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+		if string(record.Value) == "poison" {
+			attempts++
+			return errors.New("cannot decode")
+		}
+
+		cancel()
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption to continue past the poison record until cancelled, got %v", err)
+	}
+
+	if attempts != cfg.Kafka.HandlerAttempts {
+		t.Errorf("Expected %d attempts on the poison record, got %d", cfg.Kafka.HandlerAttempts, attempts)
+	}
+
+	dead := consumeOne(t, cfg, "commands.dlq")
+
+	if string(dead.Key) != "saga-1" || string(dead.Value) != "poison" || HeaderValue(dead, "metadata") != "m" {
+		t.Errorf("Expected the original record to be kept, got key %q value %q", dead.Key, dead.Value)
+	}
+
+	expected := map[string]string{
+		HeaderDLQTopic:     "commands",
+		HeaderDLQPartition: "0",
+		HeaderDLQOffset:    "0",
+		HeaderDLQError:     "cannot decode",
+		HeaderDLQAttempts:  strconv.Itoa(cfg.Kafka.HandlerAttempts),
+	}
+	for key, value := range expected {
+		if got := HeaderValue(dead, key); got != value {
+			t.Errorf("Expected header %s %q, got %q", key, value, got)
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, HeaderValue(dead, HeaderDLQTimestamp)); err != nil {
+		t.Errorf("Expected an RFC 3339 failure timestamp: %v", err)
+	}
+
+	committed := consumer.Client.CommittedOffsets()
+	if offset := committed["commands"][0]; offset.Offset != 2 {
+		t.Errorf("Expected offset 2 to be committed, got %d", offset.Offset)
+	}
+}
+
+func TestRetryTopic(t *testing.T) {
+	tests := []struct {
+		delay    time.Duration
+		expected string
+	}{
+		{5 * time.Second, "inventory.commands.retry.5s"},
+		{time.Minute, "inventory.commands.retry.1m"},
+		{10 * time.Minute, "inventory.commands.retry.10m"},
+		{2 * time.Hour, "inventory.commands.retry.2h"},
+		{1500 * time.Millisecond, "inventory.commands.retry.1500ms"},
+	}
+
+	for _, tt := range tests {
+		if got := RetryTopic("inventory.commands", tt.delay); got != tt.expected {
+			t.Errorf("Expected %s for %s, got %s", tt.expected, tt.delay, got)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cause := errors.New("connection reset")
+
+	if !IsRetryable(cause) || !IsRetryable(Retryable(cause)) {
+		t.Errorf("Expected plain and retryable errors to be retried")
+	}
+	if IsRetryable(Fatal(cause)) || IsRetryable(fmt.Errorf("wrapped: %w", Fatal(cause))) {
+		t.Errorf("Expected fatal errors not to be retried")
+	}
+	if !errors.Is(Fatal(cause), cause) {
+		t.Errorf("Expected the cause to be unwrapped")
+	}
+}
+
+func TestConsumeMovesRecordsThroughRetryTiers(t *testing.T) {
+	tiers := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+	cfg := newTestCluster(t, "commands", "commands.dlq", RetryTopic("commands", tiers[0]), RetryTopic("commands", tiers[1]))
+	cfg.Kafka.HandlerAttempts = 1
+	cfg.Kafka.RetryTiers = tiers
+
+	produce(t, cfg, &kgo.Record{Topic: "commands", Key: []byte("saga-1"), Value: []byte("blip")})
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "commands.dlq")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var seen []*kgo.Record
+
+	err = consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+		seen = append(seen, record)
+
+		if len(seen) <= len(tiers) {
+			return Retryable(errors.New("postgres unavailable"))
+		}
+
+		cancel()
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption until cancelled, got %v", err)
+	}
+
+	if len(seen) != 3 {
+		t.Fatalf("Expected the record to be handled 3 times, got %d", len(seen))
+	}
+
+	for i, tier := range tiers {
+		retry := seen[i+1]
+
+		if retry.Topic != RetryTopic("commands", tier) {
+			t.Errorf("Expected attempt %d from %s, got %s", i+2, RetryTopic("commands", tier), retry.Topic)
+		}
+		if HeaderValue(retry, HeaderRetryTopic) != "commands" || HeaderValue(retry, HeaderRetryAttempts) != strconv.Itoa(i+1) {
+			t.Errorf("Unexpected retry headers %+v", retry.Headers)
+		}
+	}
+
+	// Retries wait for their tier delay counted from when they were republished
+	if gap := seen[2].Timestamp.Sub(seen[1].Timestamp); gap < tiers[0] {
+		t.Errorf("Expected the second retry at least %s after the first, got %s", tiers[0], gap)
+	}
+}
+
+func TestConsumeDeadLettersFatalErrorsWithoutRetrying(t *testing.T) {
+	tiers := []time.Duration{50 * time.Millisecond}
+	cfg := newTestCluster(t, "commands", "commands.dlq", RetryTopic("commands", tiers[0]))
+	cfg.Kafka.RetryTiers = tiers
+
+	produce(t, cfg,
+		&kgo.Record{Topic: "commands", Value: []byte("poison")},
+		&kgo.Record{Topic: "commands", Value: []byte("good")},
+	)
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "commands.dlq")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attempts := 0
+
+	err = consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+		if string(record.Value) == "poison" {
+			attempts++
+			return Fatal(errors.New("malformed event"))
+		}
+
+		cancel()
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption until cancelled, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt on a fatal error, got %d", attempts)
+	}
+
+	if dead := consumeOne(t, cfg, "commands.dlq"); HeaderValue(dead, HeaderDLQAttempts) != "1" || HeaderValue(dead, HeaderDLQTopic) != "commands" {
+		t.Errorf("Unexpected DLQ headers %+v", dead.Headers)
+	}
+}
+
+// newPartitionedCluster starts an in-memory Kafka cluster with a two-partition commands topic
+// and produces records to the partitions given by their keys
+func newPartitionedCluster(t *testing.T, records map[int32][]string) *config.Config {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "commands"))
+	if err != nil {
+		t.Fatalf("kfake.NewCluster() failed: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	cfg := &config.Config{Kafka: config.KafkaConfig{
+		Brokers:         cluster.ListenAddrs(),
+		HandlerAttempts: 1,
+		RetryBackoff:    time.Millisecond,
+		MaxInFlight:     2,
+	}}
+
+	for partition, values := range records {
+		produceTo(t, cfg, partition, values...)
+	}
+
+	return cfg
+}
+
+// produceTo produces values to partition of the commands topic
+func produceTo(t *testing.T, cfg *config.Config, partition int32, values ...string) {
+	t.Helper()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(cfg.Kafka.Brokers...), kgo.RecordPartitioner(kgo.ManualPartitioner()))
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, value := range values {
+		record := &kgo.Record{Topic: "commands", Partition: partition, Value: []byte(value)}
+
+		if err := client.ProduceSync(context.Background(), record).FirstErr(); err != nil {
+			t.Fatalf("ProduceSync() failed: %v", err)
+		}
+	}
+}
+
+func TestConsumeHandlesPartitionsInParallel(t *testing.T) {
+	cfg := newPartitionedCluster(t, map[int32][]string{0: {"slow"}, 1: {"fast"}})
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fastDone := make(chan struct{})
+
+	var mu sync.Mutex
+	handled := map[string]bool{}
+
+	err = consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+		// The slow record only finishes once the other partition got past it
+		if string(record.Value) == "slow" {
+			select {
+			case <-fastDone:
+			case <-time.After(5 * time.Second):
+				return Fatal(errors.New("partition 1 was held back by partition 0"))
+			}
+		} else {
+			close(fastDone)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if handled[string(record.Value)] = true; len(handled) == 2 {
+			cancel()
+		}
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected both partitions to be handled until cancelled, got %v", err)
+	}
+
+	committed := consumer.Client.CommittedOffsets()
+	for partition := int32(0); partition < 2; partition++ {
+		if offset := committed["commands"][partition]; offset.Offset != 1 {
+			t.Errorf("Expected offset 1 to be committed on partition %d, got %d", partition, offset.Offset)
+		}
+	}
+}
+
+func TestConsumeKeepsPollingPastBlockedPartition(t *testing.T) {
+	cfg := newPartitionedCluster(t, map[int32][]string{0: {"blocked"}, 1: {"b1"}})
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	unblock := make(chan struct{})
+	handled := make(chan string, 10)
+
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+			if string(record.Value) == "blocked" {
+				select {
+				case <-unblock:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			handled <- string(record.Value)
+
+			return nil
+		})
+	}()
+
+	// Partition 1 advances through records produced while partition 0 is stuck, which takes polls
+	// after the one that returned the blocked record
+	for i := 1; i <= 3; i++ {
+		select {
+		case value := <-handled:
+			if expected := "b" + strconv.Itoa(i); value != expected {
+				t.Fatalf("Expected %s to be handled, got %s", expected, value)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Partition 1 stopped advancing behind the blocked partition 0 before b%d", i)
+		}
+
+		if i < 3 {
+			produceTo(t, cfg, 1, "b"+strconv.Itoa(i+1))
+		}
+	}
+
+	close(unblock)
+
+	select {
+	case value := <-handled:
+		if value != "blocked" {
+			t.Fatalf("Expected the blocked record to finish, got %s", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the blocked record to finish once unblocked")
+	}
+
+	cancel()
+
+	if err := <-consumed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption to run until cancelled, got %v", err)
+	}
+
+	committed := consumer.Client.CommittedOffsets()
+	expected := map[int32]int64{0: 1, 1: 3}
+	for partition, offset := range expected {
+		if got := committed["commands"][partition]; got.Offset != offset {
+			t.Errorf("Expected offset %d to be committed on partition %d, got %d", offset, partition, got.Offset)
+		}
+	}
+}
+
+func TestConsumeCommitsContiguousRecordsPerPartition(t *testing.T) {
+	cfg := newPartitionedCluster(t, map[int32][]string{
+		0: {"a1", "poison", "a3"},
+		1: {"b1", "b2"},
+	})
+
+	consumer, err := NewConsumer(cfg, "test-group", []string{"commands"}, "")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var handled []string
+
+	err = consumer.Consume(ctx, func(ctx context.Context, record *kgo.Record) error {
+		if string(record.Value) == "poison" {
+			return Fatal(errors.New("malformed event"))
+		}
+
+		mu.Lock()
+		handled = append(handled, string(record.Value))
+		mu.Unlock()
+
+		return nil
+	})
+	if err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption to stop on the poison record without a DLQ, got %v", err)
+	}
+
+	for _, value := range handled {
+		if value == "a3" {
+			t.Errorf("Expected the record after the poison one not to be handled")
+		}
+	}
+
+	committed := consumer.Client.CommittedOffsets()
+	if offset := committed["commands"][0]; offset.Offset != 1 {
+		t.Errorf("Expected offset 1 to be committed on partition 0, got %d", offset.Offset)
+	}
+	// Partition 1 may or may not have been handled before the failure, but never partly out of order
+	if offset := committed["commands"][1]; offset.Offset > 2 {
+		t.Errorf("Expected at most offset 2 to be committed on partition 1, got %d", offset.Offset)
+	}
+}
+
+func TestPartitionWorkersStopWhenPartitionsAreLost(t *testing.T) {
+	cfg := newTestCluster(t, "commands")
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(cfg.Kafka.Brokers...))
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer client.Close()
+
+	workers := newPartitionWorkers()
+	started := make(chan struct{})
+	abandoned := make(chan error, 1)
+
+	run := func(ctx context.Context, record *kgo.Record) error {
+		close(started)
+		<-ctx.Done()
+		abandoned <- ctx.Err()
+
+		return ctx.Err()
+	}
+
+	fail := func(err error) { t.Errorf("Expected a stopped worker not to fail, got %v", err) }
+
+	p := kgo.FetchTopicPartition{Topic: "commands", FetchPartition: kgo.FetchPartition{Partition: 0, Records: []*kgo.Record{{Topic: "commands"}}}}
+	workers.dispatch(context.Background(), client, p, run, fail)
+
+	<-started
+
+	workers.lost(context.Background(), client, map[string][]int32{"commands": {0}})
+
+	select {
+	case err := <-abandoned:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the record to be abandoned, got %v", err)
+		}
+	default:
+		t.Fatalf("Expected the worker to have stopped when the partition was lost")
+	}
+
+	if len(workers.workers["commands"]) != 0 {
+		t.Errorf("Expected no workers left, got %d", len(workers.workers["commands"]))
+	}
+	if paused := client.PauseFetchPartitions(nil); len(paused["commands"]) != 0 {
+		t.Errorf("Expected the lost partition to be resumed, got %v", paused)
+	}
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers added to records sent to a dead-letter topic. The original key, value and headers
+// are kept as they were
+const (
+	HeaderDLQTopic     = "dlq.original.topic"
+	HeaderDLQPartition = "dlq.original.partition"
+	HeaderDLQOffset    = "dlq.original.offset"
+	HeaderDLQError     = "dlq.error"
+	HeaderDLQAttempts  = "dlq.attempts"
+	HeaderDLQTimestamp = "dlq.timestamp"
+)
+
+// newDLQRecord copies record for dlqTopic and describes where it came from and why it failed.
+// Retry headers are replaced by the origin they describe
+func newDLQRecord(record *kgo.Record, dlqTopic string, cause error, o origin, failedAt time.Time) *kgo.Record {
+	headers := withoutHeaders(record.Headers, HeaderRetryTopic, HeaderRetryPartition, HeaderRetryOffset, HeaderRetryAttempts)
+	headers = append(headers,
+		kgo.RecordHeader{Key: HeaderDLQTopic, Value: []byte(o.topic)},
+		kgo.RecordHeader{Key: HeaderDLQPartition, Value: []byte(strconv.FormatInt(int64(o.partition), 10))},
+		kgo.RecordHeader{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(o.offset, 10))},
+		kgo.RecordHeader{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kgo.RecordHeader{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(o.attempts))},
+		kgo.RecordHeader{Key: HeaderDLQTimestamp, Value: []byte(failedAt.UTC().Format(time.RFC3339Nano))},
+	)
+
+	return &kgo.Record{
+		Topic:   dlqTopic,
+		Key:     record.Key,
+		Value:   record.Value,
+		Headers: headers,
+	}
+}
+
+// HeaderValue returns the value of the last header named key, or "" if there is none
+func HeaderValue(record *kgo.Record, key string) string {
+	for i := len(record.Headers) - 1; i >= 0; i-- {
+		if record.Headers[i].Key == key {
+			return string(record.Headers[i].Value)
+		}
+	}
+
+	return ""
+}
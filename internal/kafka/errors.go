@@ -0,0 +1,45 @@
+package kafka
+
+import "errors"
+
+// HandlerError tells the consumer whether a record that failed is worth trying again
+type HandlerError struct {
+	Err       error
+	Retryable bool
+}
+
+func (e *HandlerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable marks err as temporary, the record goes through the retry tiers before the DLQ
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &HandlerError{Err: err, Retryable: true}
+}
+
+// Fatal marks err as permanent, the record is sent to the DLQ without being retried
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &HandlerError{Err: err, Retryable: false}
+}
+
+// IsRetryable reports whether err should be retried. Errors not marked either way are retried
+func IsRetryable(err error) bool {
+	var handlerErr *HandlerError
+	if errors.As(err, &handlerErr) {
+		return handlerErr.Retryable
+	}
+
+	return true
+}
@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Wire format of events: the record value is the full models.Event envelope as JSON, so consumers
+// only need the value to rebuild it. The envelope fields are repeated as headers, which tools can
+// filter and route on without decoding the value. DecodeEvent only reads the value
+const (
+	HeaderEventType = "event-type"
+	HeaderEventID   = "event-id"
+	HeaderSagaID    = "saga-id"
+	HeaderOrderID   = "order-id"
+	// HeaderTimestamp holds the event timestamp in Unix milliseconds
+	HeaderTimestamp = "timestamp"
+)
+
+// newEventRecord builds the record PublishEvent sends for ev
+func newEventRecord(topic string, key []byte, ev models.Event) (*kgo.Record, error) {
+	value, err := sonic.Marshal(ev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event %s: %w", ev.EventID, err)
+	}
+
+	return &kgo.Record{
+		Topic: topic,
+		Key:   key,
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: HeaderEventType, Value: []byte(ev.Event)},
+			{Key: HeaderEventID, Value: []byte(ev.EventID.String())},
+			{Key: HeaderSagaID, Value: []byte(ev.SagaID.String())},
+			{Key: HeaderOrderID, Value: []byte(ev.OrderID.String())},
+			{Key: HeaderTimestamp, Value: []byte(strconv.FormatInt(ev.Timestamp, 10))},
+		},
+	}, nil
+}
+
+// DecodeEvent rebuilds the event envelope of a record sent by PublishEvent. Records that cannot
+// be decoded will never succeed, so the error is Fatal
+func DecodeEvent(record *kgo.Record) (models.Event, error) {
+	var ev models.Event
+
+	if err := sonic.Unmarshal(record.Value, &ev); err != nil {
+		return models.Event{}, Fatal(fmt.Errorf("failed to decode event from %s: %w", record.Topic, err))
+	}
+
+	return ev, nil
+}
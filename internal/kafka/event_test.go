@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newTestEvent(t *testing.T) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(models.EventReserveInventory, uuid.New(), uuid.New(), models.ReserveInventoryCommand{
+		Items: []models.InventoryItem{{ItemID: uuid.New(), Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func assertSameEvent(t *testing.T, expected, got models.Event) {
+	t.Helper()
+
+	if got.Event != expected.Event || got.EventID != expected.EventID || got.SagaID != expected.SagaID ||
+		got.OrderID != expected.OrderID || got.Timestamp != expected.Timestamp {
+		t.Errorf("Expected envelope %+v, got %+v", expected, got)
+	}
+	if !bytes.Equal(got.Payload, expected.Payload) {
+		t.Errorf("Expected payload %s, got %s", expected.Payload, got.Payload)
+	}
+}
+
+func TestEventRecordRoundTrip(t *testing.T) {
+	ev := newTestEvent(t)
+
+	record, err := newEventRecord("inventory.commands", []byte(ev.SagaID.String()), ev)
+	if err != nil {
+		t.Fatalf("newEventRecord() failed: %v", err)
+	}
+
+	expected := map[string]string{
+		HeaderEventType: string(ev.Event),
+		HeaderEventID:   ev.EventID.String(),
+		HeaderSagaID:    ev.SagaID.String(),
+		HeaderOrderID:   ev.OrderID.String(),
+	}
+	for key, value := range expected {
+		if got := HeaderValue(record, key); got != value {
+			t.Errorf("Expected header %s %q, got %q", key, value, got)
+		}
+	}
+
+	decoded, err := DecodeEvent(record)
+	if err != nil {
+		t.Fatalf("DecodeEvent() failed: %v", err)
+	}
+
+	assertSameEvent(t, ev, decoded)
+}
+
+func TestDecodeEventRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "not JSON", value: []byte("poison")},
+		{name: "payload only", value: []byte(`[1, 2]`)},
+		{name: "invalid event ID", value: []byte(`{"event":"RESERVE_INVENTORY","event_id":"nope"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeEvent(&kgo.Record{Topic: "inventory.commands", Value: tt.value})
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if IsRetryable(err) {
+				t.Errorf("Expected a fatal error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPublishEventRoundTripThroughKafka(t *testing.T) {
+	cfg := newTestCluster(t, "inventory.commands")
+	ev := newTestEvent(t)
+
+	producer, err := NewProducer(cfg)
+	if err != nil {
+		t.Fatalf("NewProducer() failed: %v", err)
+	}
+	defer producer.Client.Close()
+
+	if err := producer.PublishEvent(context.Background(), "inventory.commands", []byte(ev.SagaID.String()), ev); err != nil {
+		t.Fatalf("PublishEvent() failed: %v", err)
+	}
+
+	record := consumeOne(t, cfg, "inventory.commands")
+
+	decoded, err := DecodeEvent(record)
+	if err != nil {
+		t.Fatalf("DecodeEvent() failed: %v", err)
+	}
+
+	assertSameEvent(t, ev, decoded)
+
+	if HeaderValue(record, HeaderEventType) != string(models.EventReserveInventory) {
+		t.Errorf("Expected the event type header to survive the broker, got %+v", record.Headers)
+	}
+}
@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// ErrInFlight is returned when another consumer is still processing the same event after the
+// inbox waited out its lease. It is retryable, by the time the record comes back the other
+// consumer has either finished or given up
+var ErrInFlight = errors.New("event is being processed by another consumer")
+
+// inFlightBackoff is the first wait before an event in flight is claimed again. It doubles up to
+// the lease
+const inFlightBackoff = 100 * time.Millisecond
+
+// EventPublisher is the part of Producer the inbox wraps to record replies
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// Reply is an event published while a command was handled
+type Reply struct {
+	Topic string       `json:"topic"`
+	Key   []byte       `json:"key"`
+	Event models.Event `json:"event"`
+}
+
+// InboxEntry is what the inbox knows about an event that was claimed before
+type InboxEntry struct {
+	Done    bool    `json:"done"`
+	Replies []Reply `json:"replies,omitempty"`
+}
+
+// InboxStore records processed event IDs
+type InboxStore interface {
+	// Claim marks eventID as being processed for lease and returns nil. If the event was claimed
+	// or processed before, nothing changes and the recorded entry is returned instead
+	Claim(ctx context.Context, eventID uuid.UUID, lease time.Duration) (*InboxEntry, error)
+	// Complete records eventID as processed with its replies, kept for ttl
+	Complete(ctx context.Context, eventID uuid.UUID, replies []Reply, ttl time.Duration) error
+	// Release drops the claim on eventID so the event can be processed again
+	Release(ctx context.Context, eventID uuid.UUID) error
+}
+
+// Inbox makes command handlers idempotent per event ID. Services publish their replies through
+// it, and the replies sent while handling an event are recorded with the event's ID. A duplicate
+// skips the handler and sends the recorded replies again, so the orchestrator still gets an answer
+type Inbox struct {
+	store     InboxStore
+	publisher EventPublisher
+	ttl       time.Duration
+	lease     time.Duration
+}
+
+// NewInbox remembers processed events for ttl. A claim that is not completed within lease, e.g.
+// because the consumer crashed, expires so the event can be processed again
+func NewInbox(store InboxStore, publisher EventPublisher, ttl, lease time.Duration) *Inbox {
+	return &Inbox{
+		store:     store,
+		publisher: publisher,
+		ttl:       ttl,
+		lease:     lease,
+	}
+}
+
+type capturedRepliesKey struct{}
+
+// capturedReplies collects the replies published while one event is handled
+type capturedReplies struct {
+	mu      sync.Mutex
+	replies []Reply
+}
+
+// PublishEvent publishes ev and, when called while the inbox handles an event, records it as one
+// of that event's replies
+func (i *Inbox) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	if err := i.publisher.PublishEvent(ctx, topic, key, ev); err != nil {
+		return err
+	}
+
+	if captured, ok := ctx.Value(capturedRepliesKey{}).(*capturedReplies); ok {
+		captured.mu.Lock()
+		captured.replies = append(captured.replies, Reply{Topic: topic, Key: key, Event: ev})
+		captured.mu.Unlock()
+	}
+
+	return nil
+}
+
+// claim claims eventID, waiting while another consumer holds it. That claim is completed,
+// released or expired within the lease, so the wait is too. Retrying in the consumer instead
+// would use up the handler attempts long before and send a mere duplicate to the DLQ
+func (i *Inbox) claim(ctx context.Context, eventID uuid.UUID) (*InboxEntry, error) {
+	deadline := time.Now().Add(i.lease)
+	backoff := inFlightBackoff
+
+	for {
+		entry, err := i.store.Claim(ctx, eventID, i.lease)
+		if err != nil || entry == nil || entry.Done {
+			return entry, err
+		}
+
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return entry, nil
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		backoff = min(2*backoff, i.lease)
+	}
+}
+
+// Wrap returns an EventHandler running handle through the inbox
+func (i *Inbox) Wrap(handle EventHandler) EventHandler {
+	return func(ctx context.Context, ev models.Event) error {
+		return i.Handle(ctx, ev, handle)
+	}
+}
+
+// Handle runs handle for ev unless ev.EventID was processed before, in which case the recorded
+// replies are published again. Events without an ID cannot be deduplicated and are always handled
+func (i *Inbox) Handle(ctx context.Context, ev models.Event, handle EventHandler) error {
+	if ev.EventID == uuid.Nil {
+		return handle(ctx, ev)
+	}
+
+	entry, err := i.claim(ctx, ev.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to claim event %s: %w", ev.EventID, err)
+	}
+
+	if entry != nil {
+		if !entry.Done {
+			return Retryable(fmt.Errorf("%w: %s", ErrInFlight, ev.EventID))
+		}
+
+		log.Printf("Skipping duplicate %s %s, sending its %d recorded replies again", ev.Event, ev.EventID, len(entry.Replies))
+
+		for _, reply := range entry.Replies {
+			if err := i.publisher.PublishEvent(ctx, reply.Topic, reply.Key, reply.Event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	captured := &capturedReplies{}
+
+	if err := i.handleClaimed(ctx, ev, handle, captured); err != nil {
+		// A failed attempt did not happen as far as the inbox is concerned, the retry starts over
+		i.release(ctx, ev.EventID)
+
+		return err
+	}
+
+	if err := i.store.Complete(ctx, ev.EventID, captured.replies, i.ttl); err != nil {
+		// The work is done and its replies are out, a redelivery before the lease expires is still
+		// skipped, so only log
+		log.Printf("Failed to record event %s as processed: %v", ev.EventID, err)
+	}
+
+	return nil
+}
+
+// handleClaimed runs handle for a claimed event. A panicking handler gives up its claim before the
+// panic goes on to Recover, otherwise the event would be reported in flight until the lease expires
+func (i *Inbox) handleClaimed(ctx context.Context, ev models.Event, handle EventHandler, captured *capturedReplies) error {
+	defer func() {
+		if p := recover(); p != nil {
+			i.release(ctx, ev.EventID)
+			panic(p)
+		}
+	}()
+
+	return handle(context.WithValue(ctx, capturedRepliesKey{}, captured), ev)
+}
+
+func (i *Inbox) release(ctx context.Context, eventID uuid.UUID) {
+	if err := i.store.Release(ctx, eventID); err != nil {
+		log.Printf("Failed to release claim on event %s: %v", eventID, err)
+	}
+}
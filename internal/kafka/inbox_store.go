@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const inboxKeyPrefix = "inbox:"
+
+// RedisInboxStore keeps inbox entries as JSON strings that expire with the lease or the TTL
+type RedisInboxStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisInboxStore keeps the entries of one service under prefix, e.g. "inventory", so services
+// consuming the same event do not see each other's claims
+func NewRedisInboxStore(client *redis.Client, prefix string) *RedisInboxStore {
+	return &RedisInboxStore{client: client, prefix: inboxKeyPrefix + prefix + ":"}
+}
+
+func (s *RedisInboxStore) key(eventID uuid.UUID) string {
+	return s.prefix + eventID.String()
+}
+
+func (s *RedisInboxStore) Claim(ctx context.Context, eventID uuid.UUID, lease time.Duration) (*InboxEntry, error) {
+	claim, err := sonic.Marshal(InboxEntry{})
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := s.client.SetNX(ctx, s.key(eventID), claim, lease).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed {
+		return nil, nil
+	}
+
+	data, err := s.client.Get(ctx, s.key(eventID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The claim expired between SETNX and GET, whoever held it gave up
+		return &InboxEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry InboxEntry
+	if err := sonic.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode inbox entry of event %s: %w", eventID, err)
+	}
+
+	return &entry, nil
+}
+
+func (s *RedisInboxStore) Complete(ctx context.Context, eventID uuid.UUID, replies []Reply, ttl time.Duration) error {
+	data, err := sonic.Marshal(InboxEntry{Done: true, Replies: replies})
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.key(eventID), data, ttl).Err()
+}
+
+func (s *RedisInboxStore) Release(ctx context.Context, eventID uuid.UUID) error {
+	return s.client.Del(ctx, s.key(eventID)).Err()
+}
@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingPublisher struct {
+	events []models.Event
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func newTestInbox(t *testing.T) (*Inbox, *recordingPublisher, *RedisInboxStore) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisInboxStore(client, "inventory")
+	publisher := &recordingPublisher{}
+
+	return NewInbox(store, publisher, time.Hour, time.Minute), publisher, store
+}
+
+func TestInboxSkipsDuplicatesAndSendsRecordedReplies(t *testing.T) {
+	inbox, publisher, _ := newTestInbox(t)
+	ctx := context.Background()
+
+	cmd := models.Event{Event: models.EventReserveInventory, EventID: uuid.New(), SagaID: uuid.New()}
+	calls := 0
+
+	handle := func(ctx context.Context, ev models.Event) error {
+		calls++
+
+		reply := models.Event{Event: models.EventInventoryReserved, EventID: uuid.New(), SagaID: ev.SagaID}
+
+		return inbox.PublishEvent(ctx, "inventory.replies", []byte(ev.SagaID.String()), reply)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := inbox.Handle(ctx, cmd, handle); err != nil {
+			t.Fatalf("Handle() #%d failed: %v", i+1, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, got %d", calls)
+	}
+
+	if len(publisher.events) != 3 {
+		t.Fatalf("Expected the reply to be sent for every delivery, got %d", len(publisher.events))
+	}
+
+	for _, ev := range publisher.events[1:] {
+		if ev.EventID != publisher.events[0].EventID {
+			t.Errorf("Expected the recorded reply %s to be sent again, got %s", publisher.events[0].EventID, ev.EventID)
+		}
+	}
+}
+
+func TestInboxReleasesClaimWhenHandlerFails(t *testing.T) {
+	inbox, _, _ := newTestInbox(t)
+	ctx := context.Background()
+
+	cmd := models.Event{Event: models.EventProcessPayment, EventID: uuid.New()}
+	calls := 0
+
+	handle := func(ctx context.Context, ev models.Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("gateway timeout")
+		}
+
+		return nil
+	}
+
+	if err := inbox.Handle(ctx, cmd, handle); err == nil {
+		t.Fatalf("Expected the handler error to be returned")
+	}
+
+	if err := inbox.Handle(ctx, cmd, handle); err != nil {
+		t.Fatalf("Handle() retry failed: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected the retry to run the handler again, got %d calls", calls)
+	}
+}
+
+func TestInboxReleasesClaimWhenHandlerPanics(t *testing.T) {
+	inbox, _, _ := newTestInbox(t)
+	ctx := context.Background()
+
+	cmd := models.Event{Event: models.EventProcessPayment, EventID: uuid.New()}
+	calls := 0
+
+	handle := Recover()(inbox.Wrap(func(ctx context.Context, ev models.Event) error {
+		calls++
+		if calls == 1 {
+			panic("nil gateway response")
+		}
+
+		return nil
+	}))
+
+	if err := handle(ctx, cmd); err == nil || IsRetryable(err) {
+		t.Fatalf("Expected the panic to become a fatal error, got %v", err)
+	}
+
+	// Without the release this would be ErrInFlight until the lease expires
+	if err := handle(ctx, cmd); err != nil {
+		t.Fatalf("Handle() after the panic failed: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected the replay to run the handler again, got %d calls", calls)
+	}
+}
+
+func TestInboxRetriesEventInFlight(t *testing.T) {
+	_, publisher, store := newTestInbox(t)
+	inbox := NewInbox(store, publisher, time.Hour, 50*time.Millisecond)
+	ctx := context.Background()
+
+	cmd := models.Event{Event: models.EventRefundPayment, EventID: uuid.New()}
+
+	if entry, err := store.Claim(ctx, cmd.EventID, time.Minute); err != nil || entry != nil {
+		t.Fatalf("Expected the first claim to succeed, got %+v, %v", entry, err)
+	}
+
+	start := time.Now()
+	err := inbox.Handle(ctx, cmd, func(ctx context.Context, ev models.Event) error {
+		t.Errorf("Expected the handler not to run while the event is in flight")
+		return nil
+	})
+
+	if !errors.Is(err, ErrInFlight) || !IsRetryable(err) {
+		t.Errorf("Expected a retryable ErrInFlight, got %v", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Expected the inbox to wait out the lease before giving up, waited %s", waited)
+	}
+}
+
+func TestInboxWaitsForEventInFlight(t *testing.T) {
+	_, publisher, store := newTestInbox(t)
+	inbox := NewInbox(store, publisher, time.Hour, 5*time.Second)
+	ctx := context.Background()
+
+	cmd := models.Event{Event: models.EventRefundPayment, EventID: uuid.New()}
+	reply := Reply{Topic: "payment.replies", Event: models.Event{Event: models.EventPaymentRefunded, EventID: uuid.New()}}
+
+	if entry, err := store.Claim(ctx, cmd.EventID, time.Minute); err != nil || entry != nil {
+		t.Fatalf("Expected the first claim to succeed, got %+v, %v", entry, err)
+	}
+
+	// The first copy finishes while the duplicate waits
+	done := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done <- store.Complete(ctx, cmd.EventID, []Reply{reply}, time.Hour)
+	}()
+
+	err := inbox.Handle(ctx, cmd, func(ctx context.Context, ev models.Event) error {
+		t.Errorf("Expected the handler not to run for a duplicate")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Handle() failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Complete() failed: %v", err)
+	}
+
+	if len(publisher.events) != 1 || publisher.events[0].EventID != reply.Event.EventID {
+		t.Errorf("Expected the recorded reply to be sent again, got %+v", publisher.events)
+	}
+}
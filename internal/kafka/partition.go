@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// recordRunner handles one record of a partition, see Consumer.processInFlight
+type recordRunner func(ctx context.Context, record *kgo.Record) error
+
+// partitionWorkers runs a long-lived worker for every partition a group client consumes, so a
+// slow record only holds back the records behind it on the same partition, and so with the same
+// saga key. The poll loop hands the records of a partition to its worker and pauses fetching
+// the partition until the worker is through them, so polling never waits on a busy partition
+// and the other partitions keep advancing
+type partitionWorkers struct {
+	mu      sync.Mutex
+	workers map[string]map[int32]*partitionWorker
+}
+
+type partitionWorker struct {
+	records chan []*kgo.Record
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func newPartitionWorkers() *partitionWorkers {
+	return &partitionWorkers{workers: make(map[string]map[int32]*partitionWorker)}
+}
+
+// dispatch hands the records of p to its worker, starting one when p has none yet. A worker that
+// fails on a record stops and calls fail with the error
+func (w *partitionWorkers) dispatch(ctx context.Context, client *kgo.Client, p kgo.FetchTopicPartition, run recordRunner, fail context.CancelCauseFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	worker, ok := w.workers[p.Topic][p.Partition]
+	if !ok {
+		worker = w.start(ctx, client, p.Topic, p.Partition, run, fail)
+	}
+
+	// Resumed by the worker once it handled the records, until then polls skip the partition so
+	// its worker never has more than one batch queued
+	client.PauseFetchPartitions(map[string][]int32{p.Topic: {p.Partition}})
+
+	worker.records <- p.Records
+}
+
+// start runs the worker of topic and partition. It handles the records of every batch in order
+// and marks each one for commit as soon as it is done
+func (w *partitionWorkers) start(ctx context.Context, client *kgo.Client, topic string, partition int32, run recordRunner, fail context.CancelCauseFunc) *partitionWorker {
+	ctx, cancel := context.WithCancel(ctx)
+
+	worker := &partitionWorker{
+		records: make(chan []*kgo.Record, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(worker.done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case records := <-worker.records:
+				for _, record := range records {
+					if err := run(ctx, record); err != nil {
+						if ctx.Err() == nil {
+							fail(err)
+						}
+
+						return
+					}
+
+					client.MarkCommitRecords(record)
+				}
+
+				client.ResumeFetchPartitions(map[string][]int32{topic: {partition}})
+			}
+		}
+	}()
+
+	if w.workers[topic] == nil {
+		w.workers[topic] = make(map[int32]*partitionWorker)
+	}
+
+	w.workers[topic][partition] = worker
+
+	return worker
+}
+
+// stop stops the workers of partitions and waits for them. A stopped worker abandons the record
+// it is on, which is not marked and so is consumed again by whoever owns the partition next
+func (w *partitionWorkers) stop(client *kgo.Client, partitions map[string][]int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			if worker, ok := w.workers[topic][partition]; ok {
+				worker.cancel()
+				<-worker.done
+
+				delete(w.workers[topic], partition)
+			}
+		}
+	}
+
+	// Pauses outlive assignments, a partition assigned again later must be fetched again
+	client.ResumeFetchPartitions(partitions)
+}
+
+// stopAll stops every worker, e.g. once consumption ends
+func (w *partitionWorkers) stopAll(client *kgo.Client) {
+	partitions := make(map[string][]int32)
+
+	w.mu.Lock()
+	for topic, workers := range w.workers {
+		for partition := range workers {
+			partitions[topic] = append(partitions[topic], partition)
+		}
+	}
+	w.mu.Unlock()
+
+	w.stop(client, partitions)
+}
+
+// revoked stops the workers of revoked partitions and commits what they handled, so the next
+// owner starts right after it
+func (w *partitionWorkers) revoked(ctx context.Context, client *kgo.Client, partitions map[string][]int32) {
+	w.stop(client, partitions)
+
+	if err := commitMarked(client); err != nil {
+		log.Printf("Failed to commit offsets of revoked partitions: %v", err)
+	}
+}
+
+// lost stops the workers of lost partitions. Their offsets can no longer be committed
+func (w *partitionWorkers) lost(ctx context.Context, client *kgo.Client, partitions map[string][]int32) {
+	w.stop(client, partitions)
+}
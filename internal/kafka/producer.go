@@ -4,8 +4,6 @@ import (
 	"context"
 	"log"
 
-	"github.com/bytedance/sonic"
-	"github.com/google/uuid"
 	"github.com/mateusmlo/altimit-ecomm/internal/config"
 	"github.com/mateusmlo/altimit-ecomm/internal/models"
 	"github.com/twmb/franz-go/pkg/kgo"
@@ -16,18 +14,6 @@ type Producer struct {
 	cfg    *config.Config
 }
 
-type RecordMetadata struct {
-	eventType models.EventType
-	eventID   uuid.UUID
-	sagaID    uuid.UUID
-	orderID   uuid.UUID
-	timestamp int64
-}
-
-func (rm *RecordMetadata) MarshalBinary() ([]byte, error) {
-	return sonic.Marshal(rm)
-}
-
 func NewProducer(cfg *config.Config) (*Producer, error) {
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers(cfg.Kafka.Brokers...),
@@ -46,36 +32,11 @@ func NewProducer(cfg *config.Config) (*Producer, error) {
 }
 
 func (p *Producer) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
-	msgPayload, err := ev.Payload.MarshalJSON()
-	if err != nil {
-		return err
-	}
-
-	rm := RecordMetadata{
-		eventType: ev.Event,
-		eventID:   ev.EventID,
-		sagaID:    ev.SagaID,
-		orderID:   ev.OrderID,
-		timestamp: ev.Timestamp,
-	}
-
-	rmBytes, err := rm.MarshalBinary()
+	msg, err := newEventRecord(topic, key, ev)
 	if err != nil {
 		return err
 	}
 
-	msg := &kgo.Record{
-		Topic: topic,
-		Key:   key,
-		Value: msgPayload,
-		Headers: []kgo.RecordHeader{
-			{
-				Key:   "metadata",
-				Value: rmBytes,
-			},
-		},
-	}
-
 	if err := p.Client.ProduceSync(ctx, msg).FirstErr(); err != nil {
 		log.Printf("Failed to publish event %s after retries: %v", ev.EventID, err)
 		//TODO: emit metrics
@@ -86,3 +47,15 @@ func (p *Producer) PublishEvent(ctx context.Context, topic string, key []byte, e
 
 	return nil
 }
+
+// PublishRecord sends record as it is, for tools that move existing records between topics
+func (p *Producer) PublishRecord(ctx context.Context, record *kgo.Record) error {
+	if err := p.Client.ProduceSync(ctx, record).FirstErr(); err != nil {
+		log.Printf("Failed to publish record to topic %s after retries: %v", record.Topic, err)
+		return err
+	}
+
+	log.Printf("Published record to topic %s", record.Topic)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Headers carried by records in retry topics, so the DLQ still knows where a record started
+const (
+	HeaderRetryTopic     = "retry.original.topic"
+	HeaderRetryPartition = "retry.original.partition"
+	HeaderRetryOffset    = "retry.original.offset"
+	HeaderRetryAttempts  = "retry.attempts"
+)
+
+// RetryTopic names the retry topic of topic for delay, e.g. inventory.commands.retry.5s
+func RetryTopic(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topic, delayLabel(delay))
+}
+
+func delayLabel(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// origin is where a record was first consumed and how often it has been attempted since
+type origin struct {
+	topic     string
+	partition int32
+	offset    int64
+	attempts  int
+}
+
+// recordOrigin reads the origin from the retry headers, a record without them is its own origin
+func recordOrigin(record *kgo.Record) origin {
+	o := origin{topic: record.Topic, partition: record.Partition, offset: record.Offset}
+
+	topic := HeaderValue(record, HeaderRetryTopic)
+	if topic == "" {
+		return o
+	}
+
+	o.topic = topic
+
+	if partition, err := strconv.ParseInt(HeaderValue(record, HeaderRetryPartition), 10, 32); err == nil {
+		o.partition = int32(partition)
+	}
+
+	if offset, err := strconv.ParseInt(HeaderValue(record, HeaderRetryOffset), 10, 64); err == nil {
+		o.offset = offset
+	}
+
+	if attempts, err := strconv.Atoi(HeaderValue(record, HeaderRetryAttempts)); err == nil {
+		o.attempts = attempts
+	}
+
+	return o
+}
+
+// newRetryRecord copies record into retryTopic. The timestamp is set to now, the retry tier
+// waits for its delay counted from it
+func newRetryRecord(record *kgo.Record, retryTopic string, o origin, now time.Time) *kgo.Record {
+	headers := withoutHeaders(record.Headers, HeaderRetryTopic, HeaderRetryPartition, HeaderRetryOffset, HeaderRetryAttempts)
+	headers = append(headers,
+		kgo.RecordHeader{Key: HeaderRetryTopic, Value: []byte(o.topic)},
+		kgo.RecordHeader{Key: HeaderRetryPartition, Value: []byte(strconv.FormatInt(int64(o.partition), 10))},
+		kgo.RecordHeader{Key: HeaderRetryOffset, Value: []byte(strconv.FormatInt(o.offset, 10))},
+		kgo.RecordHeader{Key: HeaderRetryAttempts, Value: []byte(strconv.Itoa(o.attempts))},
+	)
+
+	return &kgo.Record{
+		Topic:     retryTopic,
+		Key:       record.Key,
+		Value:     record.Value,
+		Headers:   headers,
+		Timestamp: now,
+	}
+}
+
+func withoutHeaders(headers []kgo.RecordHeader, keys ...string) []kgo.RecordHeader {
+	result := make([]kgo.RecordHeader, 0, len(headers))
+
+	for _, h := range headers {
+		drop := false
+		for _, key := range keys {
+			if h.Key == key {
+				drop = true
+				break
+			}
+		}
+
+		if !drop {
+			result = append(result, h)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// ErrUnknownEvent is returned by RejectUnknown for events no route was registered for
+var ErrUnknownEvent = errors.New("no route for event type")
+
+// Middleware wraps an EventHandler, e.g. to log, time or deduplicate the events it handles
+type Middleware func(next EventHandler) EventHandler
+
+// Router dispatches events to the handler registered for their type. Events without a route go
+// to the fallback, which ignores them unless another one is set
+type Router struct {
+	routes     map[models.EventType]EventHandler
+	fallback   EventHandler
+	middleware []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes:   make(map[models.EventType]EventHandler),
+		fallback: IgnoreUnknown,
+	}
+}
+
+// NewCommandRouter returns a router for a service's command topic. Unknown commands go to the
+// DLQ, from where they can be replayed once a consumer knows them
+func NewCommandRouter() *Router {
+	r := NewRouter()
+	r.Fallback(RejectUnknown)
+
+	return r
+}
+
+// Handle routes events of eventType to handler. A later route for the same type replaces it
+func (r *Router) Handle(eventType models.EventType, handler EventHandler) {
+	r.routes[eventType] = handler
+}
+
+// Route routes events of eventType to handle with their payload decoded into T, which must be the
+// payload registered for eventType. Payloads that cannot be decoded are fatal
+func Route[T any](r *Router, eventType models.EventType, handle func(ctx context.Context, ev models.Event, payload T) error) {
+	r.Handle(eventType, func(ctx context.Context, ev models.Event) error {
+		payload, err := models.DecodePayload[T](ev)
+		if err != nil {
+			return Fatal(fmt.Errorf("failed to decode %s payload: %w", ev.Event, err))
+		}
+
+		return handle(ctx, ev, payload)
+	})
+}
+
+// Fallback handles events of types without a route, see IgnoreUnknown and RejectUnknown
+func (r *Router) Fallback(handler EventHandler) {
+	r.fallback = handler
+}
+
+// Use adds middleware around every route and the fallback. The first middleware is the outermost
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// HandleEvent runs ev through the middleware and its route, so the router can be used as an EventHandler
+func (r *Router) HandleEvent(ctx context.Context, ev models.Event) error {
+	handler := r.dispatch
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+
+	return handler(ctx, ev)
+}
+
+// HandleRecord decodes the event envelope from record and routes it, so it can be used as a RecordHandler
+func (r *Router) HandleRecord(ctx context.Context, record *kgo.Record) error {
+	ev, err := DecodeEvent(record)
+	if err != nil {
+		return err
+	}
+
+	return r.HandleEvent(ctx, ev)
+}
+
+func (r *Router) dispatch(ctx context.Context, ev models.Event) error {
+	if handler, ok := r.routes[ev.Event]; ok {
+		return handler(ctx, ev)
+	}
+
+	return r.fallback(ctx, ev)
+}
+
+// IgnoreUnknown is a fallback that logs and skips the event
+func IgnoreUnknown(_ context.Context, ev models.Event) error {
+	log.Printf("Ignoring event %s of unexpected type %s", ev.EventID, ev.Event)
+	return nil
+}
+
+// RejectUnknown is a fallback that fails the event as fatal, so it goes to the DLQ
+func RejectUnknown(_ context.Context, ev models.Event) error {
+	return Fatal(fmt.Errorf("%w: %s (event %s)", ErrUnknownEvent, ev.Event, ev.EventID))
+}
+
+// Logging logs every event with its outcome and how long it took
+func Logging() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev models.Event) error {
+			start := time.Now()
+			err := next(ctx, ev)
+
+			if err != nil {
+				log.Printf("Failed to handle %s %s of saga %s after %s: %v", ev.Event, ev.EventID, ev.SagaID, time.Since(start), err)
+			} else {
+				log.Printf("Handled %s %s of saga %s in %s", ev.Event, ev.EventID, ev.SagaID, time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+// Recover turns a panicking handler into a fatal error, so the event goes to the DLQ instead of
+// taking the consumer down
+func Recover() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev models.Event) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("Handler panicked on %s %s: %v\n%s", ev.Event, ev.EventID, p, debug.Stack())
+					err = Fatal(fmt.Errorf("handler panicked on %s: %v", ev.Event, p))
+				}
+			}()
+
+			return next(ctx, ev)
+		}
+	}
+}
+
+// Timing reports how long each event took to observe, e.g. to feed a latency histogram
+func Timing(observe func(eventType models.EventType, elapsed time.Duration, err error)) Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev models.Event) error {
+			start := time.Now()
+			err := next(ctx, ev)
+
+			observe(ev.Event, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+// Dedup skips events inbox has seen before, see Inbox.Wrap
+func Dedup(inbox *Inbox) Middleware {
+	return inbox.Wrap
+}
@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+func newRoutedEvent(t *testing.T, eventType models.EventType, payload any) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(eventType, uuid.New(), uuid.New(), payload)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func TestRouterDispatchesByEventType(t *testing.T) {
+	router := NewRouter()
+
+	var got []string
+
+	Route(router, models.EventProcessPayment, func(ctx context.Context, ev models.Event, cmd models.ProcessPaymentCommand) error {
+		got = append(got, "charge "+cmd.CustomerID)
+		return nil
+	})
+	router.Handle(models.EventReleaseInventory, func(ctx context.Context, ev models.Event) error {
+		got = append(got, "release")
+		return nil
+	})
+
+	events := []models.Event{
+		newRoutedEvent(t, models.EventProcessPayment, models.ProcessPaymentCommand{CustomerID: "c-1", Amount: models.Money{Amount: 1000, Currency: "USD"}}),
+		newRoutedEvent(t, models.EventReleaseInventory, models.ReleaseInventoryCommand{}),
+		newRoutedEvent(t, models.EventRefundPayment, models.RefundPaymentCommand{}),
+	}
+
+	for _, ev := range events {
+		if err := router.HandleEvent(context.Background(), ev); err != nil {
+			t.Errorf("HandleEvent(%s) failed: %v", ev.Event, err)
+		}
+	}
+
+	if strings.Join(got, ",") != "charge c-1,release" {
+		t.Errorf("Expected the charge and release routes to run, got %v", got)
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		router    func() *Router
+		fallback  EventHandler
+		expectErr bool
+	}{
+		{name: "ignore by default"},
+		{name: "ignore", fallback: IgnoreUnknown},
+		{name: "reject", fallback: RejectUnknown, expectErr: true},
+		{name: "command router rejects", router: NewCommandRouter, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter()
+			if tt.router != nil {
+				router = tt.router()
+			}
+			if tt.fallback != nil {
+				router.Fallback(tt.fallback)
+			}
+
+			err := router.HandleEvent(context.Background(), newRoutedEvent(t, models.EventRefundPayment, models.RefundPaymentCommand{}))
+
+			if !tt.expectErr && err != nil {
+				t.Errorf("Expected the event to be ignored, got %v", err)
+			}
+			if tt.expectErr && (!errors.Is(err, ErrUnknownEvent) || IsRetryable(err)) {
+				t.Errorf("Expected a fatal ErrUnknownEvent, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRouteRejectsMismatchedPayloads(t *testing.T) {
+	router := NewRouter()
+	called := false
+
+	Route(router, models.EventProcessPayment, func(ctx context.Context, ev models.Event, cmd models.ProcessPaymentCommand) error {
+		called = true
+		return nil
+	})
+
+	ev := newRoutedEvent(t, models.EventProcessPayment, models.ProcessPaymentCommand{})
+	ev.Payload = []byte(`{"payment_id":"pay-1"}`)
+
+	if err := router.HandleEvent(context.Background(), ev); err == nil || IsRetryable(err) {
+		t.Errorf("Expected a fatal decode error, got %v", err)
+	}
+	if called {
+		t.Errorf("Expected the handler not to run")
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	router := NewRouter()
+
+	var order []string
+
+	trace := func(name string) Middleware {
+		return func(next EventHandler) EventHandler {
+			return func(ctx context.Context, ev models.Event) error {
+				order = append(order, name)
+				return next(ctx, ev)
+			}
+		}
+	}
+
+	var observed models.EventType
+
+	router.Use(Recover(), trace("outer"), trace("inner"), Timing(func(eventType models.EventType, elapsed time.Duration, err error) {
+		observed = eventType
+	}))
+	router.Handle(models.EventReleaseInventory, func(ctx context.Context, ev models.Event) error {
+		order = append(order, "handler")
+		panic("nil map")
+	})
+
+	err := router.HandleEvent(context.Background(), newRoutedEvent(t, models.EventReleaseInventory, models.ReleaseInventoryCommand{}))
+	if err == nil || IsRetryable(err) {
+		t.Errorf("Expected the panic to be recovered as a fatal error, got %v", err)
+	}
+
+	if strings.Join(order, ",") != "outer,inner,handler" {
+		t.Errorf("Expected middleware to run in the order it was added, got %v", order)
+	}
+	if observed != "" {
+		t.Errorf("Expected timing to be skipped by the panic, got %s", observed)
+	}
+}
+
+func TestRouterDedup(t *testing.T) {
+	inbox, publisher, _ := newTestInbox(t)
+	router := NewRouter()
+	router.Use(Dedup(inbox))
+
+	calls := 0
+
+	router.Handle(models.EventReleaseInventory, func(ctx context.Context, ev models.Event) error {
+		calls++
+
+		reply := newRoutedEvent(t, models.EventInventoryReleased, models.InventoryReply{Success: true})
+
+		return inbox.PublishEvent(ctx, "inventory.replies", []byte(ev.SagaID.String()), reply)
+	})
+
+	ev := newRoutedEvent(t, models.EventReleaseInventory, models.ReleaseInventoryCommand{})
+
+	for i := 0; i < 2; i++ {
+		if err := router.HandleEvent(context.Background(), ev); err != nil {
+			t.Fatalf("HandleEvent() #%d failed: %v", i+1, err)
+		}
+	}
+
+	if calls != 1 || len(publisher.events) != 2 {
+		t.Errorf("Expected one handler call and the reply sent twice, got %d calls and %d replies", calls, len(publisher.events))
+	}
+}
@@ -0,0 +1,261 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// TransformHandler handles a record and returns the records to produce for it, instead of
+// producing them itself
+type TransformHandler func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error)
+
+// transactSession is the part of kgo.GroupTransactSession ConsumeTransform uses
+type transactSession interface {
+	PollFetches(ctx context.Context) kgo.Fetches
+	Begin() error
+	ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults
+	End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error)
+	Close()
+}
+
+// endTimeout bounds how long ending a transaction may take, even when consumption was cancelled
+const endTimeout = 10 * time.Second
+
+// NewTransactionalConsumer creates a group consumer for ConsumeTransform. transactionalID must be
+// unique per running instance and stable across its restarts: a restarted instance fences off
+// its predecessor and aborts whatever transaction it left open
+func NewTransactionalConsumer(cfg *config.Config, groupID, transactionalID string, topics []string, dlqTopic string) (*Consumer, error) {
+	session, err := kgo.NewGroupTransactSession(
+		kgo.SeedBrokers(cfg.Kafka.Brokers...),
+		kgo.WithLogger(kgo.BasicLogger(log.Writer(), kgo.LogLevelDebug, nil)),
+		kgo.ConsumerGroup(groupID),
+		kgo.ConsumeTopics(topics...),
+		kgo.TransactionalID(transactionalID),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		Client:   session.Client(),
+		cfg:      cfg,
+		topics:   topics,
+		dlqTopic: dlqTopic,
+		session:  session,
+	}, nil
+}
+
+// NewCommandConsumer creates the consumer a service reads its commands with: transactional when
+// Kafka.Transactional is set, using the configured ID scoped to groupID, and a plain one otherwise
+func NewCommandConsumer(cfg *config.Config, groupID string, topics []string, dlqTopic string) (*Consumer, error) {
+	if cfg.Kafka.Transactional {
+		return NewTransactionalConsumer(cfg, groupID, cfg.Kafka.TransactionalID+"."+groupID, topics, dlqTopic)
+	}
+
+	return NewConsumer(cfg, groupID, topics, dlqTopic)
+}
+
+// Publisher returns what handlers run by ConsumeEvents must publish through: producer for a
+// plain consumer, a RecordCollector for a transactional one
+func (c *Consumer) Publisher(producer EventPublisher) EventPublisher {
+	if c.session != nil {
+		return RecordCollector{}
+	}
+
+	return producer
+}
+
+// ConsumeEvents runs handle on every event, with ConsumeTransform on a transactional consumer
+// and Consume otherwise
+func (c *Consumer) ConsumeEvents(ctx context.Context, handle EventHandler) error {
+	if c.session != nil {
+		return c.ConsumeTransform(ctx, TransformEvents(handle))
+	}
+
+	return c.Consume(ctx, HandleEvents(handle))
+}
+
+// ConsumeTransform runs handler on every record and produces the records it returns in the same
+// Kafka transaction that commits the consumed offsets. A reply therefore becomes visible to
+// read-committed consumers exactly when its command counts as consumed, and a batch whose
+// transaction is aborted, e.g. by a rebalance, is consumed again without duplicating replies.
+// Records that keep failing are dead-lettered in the same transaction. Retry tiers are not used
+func (c *Consumer) ConsumeTransform(ctx context.Context, handler TransformHandler) error {
+	if c.session == nil {
+		return errors.New("ConsumeTransform needs a consumer created by NewTransactionalConsumer")
+	}
+
+	for {
+		fetches := c.session.PollFetches(ctx)
+
+		if ctx.Err() != nil {
+			log.Println("Shutdown transactional consumer...")
+			return ctx.Err()
+		}
+
+		if fetches.IsClientClosed() {
+			return errors.New("client closed")
+		}
+
+		if err := fetches.Err(); err != nil {
+			log.Printf("fetch records error: %v", err)
+			return err
+		}
+
+		if fetches.Empty() {
+			continue
+		}
+
+		if err := c.transact(ctx, fetches, handler); err != nil {
+			return err
+		}
+	}
+}
+
+// transact handles one batch in a transaction
+func (c *Consumer) transact(ctx context.Context, fetches kgo.Fetches, handler TransformHandler) error {
+	if err := c.session.Begin(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var (
+		out        []*kgo.Record
+		processErr error
+	)
+
+	fetches.EachRecord(func(record *kgo.Record) {
+		if processErr != nil {
+			return
+		}
+
+		var records []*kgo.Record
+		records, processErr = c.transform(ctx, handler, record)
+		out = append(out, records...)
+	})
+
+	if processErr == nil && len(out) > 0 {
+		processErr = c.session.ProduceSync(ctx, out...).FirstErr()
+	}
+
+	end := kgo.TryCommit
+	if processErr != nil {
+		end = kgo.TryAbort
+	}
+
+	endCtx, cancel := context.WithTimeout(context.Background(), endTimeout)
+	defer cancel()
+
+	committed, err := c.session.End(endCtx, end)
+
+	// An aborted batch rewinds to the committed offsets, nothing of it was applied
+	if processErr != nil {
+		return processErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to end transaction: %w", err)
+	}
+
+	if !committed {
+		log.Printf("Transaction of %d records aborted by a rebalance, they will be consumed again", fetches.NumRecords())
+	}
+
+	return nil
+}
+
+// transform runs handler on record, retrying with a growing backoff like process does. A record
+// that fails fatally, or still fails after Kafka.HandlerAttempts, is replaced by its DLQ record
+func (c *Consumer) transform(ctx context.Context, handler TransformHandler, record *kgo.Record) ([]*kgo.Record, error) {
+	o := recordOrigin(record)
+
+	for attempt := 1; ; attempt++ {
+		records, err := handler(ctx, record)
+		if err == nil {
+			return records, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		o.attempts++
+
+		log.Printf("Failed to handle record %s/%d@%d (attempt %d): %v", record.Topic, record.Partition, record.Offset, o.attempts, err)
+
+		if !IsRetryable(err) || attempt >= c.cfg.Kafka.HandlerAttempts {
+			if c.dlqTopic == "" {
+				return nil, fmt.Errorf("no DLQ configured for %s: %w", record.Topic, err)
+			}
+
+			log.Printf("Dead-lettering record %s/%d@%d to %s after %d attempts", record.Topic, record.Partition, record.Offset, c.dlqTopic, o.attempts)
+
+			return []*kgo.Record{newDLQRecord(record, c.dlqTopic, err, o, time.Now())}, nil
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * c.cfg.Kafka.RetryBackoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type collectedRecordsKey struct{}
+
+// collectedRecords gathers the records published while one record is transformed
+type collectedRecords struct {
+	mu      sync.Mutex
+	records []*kgo.Record
+}
+
+// TransformEvents adapts an EventHandler to ConsumeTransform. Events the handler publishes through
+// a RecordCollector are returned as the output records instead of being produced
+func TransformEvents(handle EventHandler) TransformHandler {
+	return func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error) {
+		ev, err := DecodeEvent(record)
+		if err != nil {
+			return nil, err
+		}
+
+		collected := &collectedRecords{}
+
+		if err := handle(context.WithValue(ctx, collectedRecordsKey{}, collected), ev); err != nil {
+			return nil, err
+		}
+
+		return collected.records, nil
+	}
+}
+
+// RecordCollector is the EventPublisher for services run by ConsumeTransform through
+// TransformEvents. It collects records instead of producing them
+type RecordCollector struct{}
+
+func (RecordCollector) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	collected, ok := ctx.Value(collectedRecordsKey{}).(*collectedRecords)
+	if !ok {
+		return errors.New("RecordCollector can only publish while TransformEvents handles an event")
+	}
+
+	record, err := newEventRecord(topic, key, ev)
+	if err != nil {
+		return err
+	}
+
+	collected.mu.Lock()
+	collected.records = append(collected.records, record)
+	collected.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestTransformDeadLettersFailingRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{name: "fatal", err: Fatal(errors.New("cannot decode")), wantAttempts: 1},
+		{name: "retryable", err: errors.New("postgres unavailable"), wantAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer{
+				cfg:      &config.Config{Kafka: config.KafkaConfig{HandlerAttempts: 3, RetryBackoff: time.Millisecond}},
+				dlqTopic: "commands.dlq",
+			}
+
+			attempts := 0
+			record := &kgo.Record{Topic: "commands", Key: []byte("saga-1"), Value: []byte("cmd"), Offset: 4}
+
+			out, err := c.transform(context.Background(), func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error) {
+				attempts++
+				return nil, tt.err
+			}, record)
+			if err != nil {
+				t.Fatalf("transform() failed: %v", err)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+
+			if len(out) != 1 || out[0].Topic != "commands.dlq" || HeaderValue(out[0], HeaderDLQOffset) != "4" {
+				t.Fatalf("Expected the record to be dead-lettered in the transaction, got %+v", out)
+			}
+		})
+	}
+}
+
+func TestTransformEventsReturnsCollectedRecords(t *testing.T) {
+	ev, err := models.NewEvent(models.EventReserveInventory, uuid.New(), uuid.New(), models.ReserveInventoryCommand{})
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	value, err := sonic.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	handler := TransformEvents(func(ctx context.Context, ev models.Event) error {
+		reply, err := models.NewEvent(models.EventInventoryReserved, ev.SagaID, ev.OrderID, models.InventoryReply{Success: true})
+		if err != nil {
+			return err
+		}
+
+		return RecordCollector{}.PublishEvent(ctx, "inventory.replies", []byte(ev.SagaID.String()), reply)
+	})
+
+	out, err := handler(context.Background(), &kgo.Record{Topic: "inventory.commands", Value: value})
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+
+	if len(out) != 1 || out[0].Topic != "inventory.replies" || string(out[0].Key) != ev.SagaID.String() {
+		t.Errorf("Expected one reply record keyed by saga, got %+v", out)
+	}
+
+	if err := (RecordCollector{}).PublishEvent(context.Background(), "inventory.replies", nil, ev); err == nil {
+		t.Errorf("Expected RecordCollector to refuse publishing outside TransformEvents")
+	}
+}
+
+// fakeSession stands in for a kgo.GroupTransactSession, which kfake cannot run. Records produced
+// in a transaction only become visible, and the polled batch only counts as consumed, once the
+// transaction commits. An aborted batch is polled again, like the group rewinding to the
+// committed offsets
+type fakeSession struct {
+	batches   []kgo.Fetches
+	polled    kgo.Fetches
+	inTxn     bool
+	pending   []*kgo.Record
+	committed []*kgo.Record
+	ends      []kgo.TransactionEndTry
+	// produceErr fails the next ProduceSync, e.g. the broker going away mid-transaction
+	produceErr error
+	// rebalance makes the next commit fail like a rebalance during the transaction would
+	rebalance bool
+	// drained is called when a poll finds no batch left
+	drained func()
+}
+
+func newFakeSession(batches ...kgo.Fetches) *fakeSession {
+	return &fakeSession{batches: batches}
+}
+
+func (s *fakeSession) PollFetches(ctx context.Context) kgo.Fetches {
+	if len(s.batches) == 0 {
+		s.drained()
+		<-ctx.Done()
+
+		return nil
+	}
+
+	s.polled, s.batches = s.batches[0], s.batches[1:]
+
+	return s.polled
+}
+
+func (s *fakeSession) Begin() error {
+	if s.inTxn {
+		return errors.New("transaction already open")
+	}
+
+	s.inTxn = true
+
+	return nil
+}
+
+func (s *fakeSession) ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults {
+	results := make(kgo.ProduceResults, 0, len(rs))
+
+	for _, r := range rs {
+		results = append(results, kgo.ProduceResult{Record: r, Err: s.produceErr})
+
+		if s.produceErr == nil {
+			s.pending = append(s.pending, r)
+		}
+	}
+
+	s.produceErr = nil
+
+	return results
+}
+
+func (s *fakeSession) End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error) {
+	s.ends = append(s.ends, commit)
+	s.inTxn = false
+
+	if commit == kgo.TryCommit && !s.rebalance {
+		s.committed = append(s.committed, s.pending...)
+		s.pending = nil
+
+		return true, nil
+	}
+
+	s.rebalance = false
+	s.pending = nil
+	s.batches = append([]kgo.Fetches{s.polled}, s.batches...)
+
+	return false, nil
+}
+
+func (s *fakeSession) Close() {}
+
+// fetchesOf returns one polled batch of records, all on partition 0 of commands
+func fetchesOf(values ...string) kgo.Fetches {
+	records := make([]*kgo.Record, 0, len(values))
+	for i, value := range values {
+		records = append(records, &kgo.Record{Topic: "commands", Key: []byte(value), Value: []byte(value), Offset: int64(i)})
+	}
+
+	return kgo.Fetches{{Topics: []kgo.FetchTopic{{Topic: "commands", Partitions: []kgo.FetchPartition{{Records: records}}}}}}
+}
+
+// consumeTransform runs ConsumeTransform on session until it has no batch left, answering every
+// command with one reply
+func consumeTransform(c *Consumer, session *fakeSession, handled *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session.drained = cancel
+
+	return c.ConsumeTransform(ctx, func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error) {
+		*handled++
+		return []*kgo.Record{{Topic: "replies", Key: record.Key, Value: []byte("reply")}}, nil
+	})
+}
+
+func TestConsumeTransformRedeliversBatchAfterCrash(t *testing.T) {
+	session := newFakeSession(fetchesOf("reserve-1", "reserve-2"))
+	session.produceErr = errors.New("broker connection lost")
+
+	c := &Consumer{cfg: &config.Config{Kafka: config.KafkaConfig{HandlerAttempts: 1}}, session: session}
+	handled := 0
+
+	// The first instance handles both commands, then fails to produce their replies
+	if err := consumeTransform(c, session, &handled); err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the produce failure to stop consumption, got %v", err)
+	}
+
+	if len(session.committed) != 0 {
+		t.Fatalf("Expected nothing to be committed by the failed transaction, got %d records", len(session.committed))
+	}
+
+	// Its replacement gets the batch again, since its offsets were never committed
+	if err := consumeTransform(c, session, &handled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected consumption to run until cancelled, got %v", err)
+	}
+
+	if handled != 4 {
+		t.Errorf("Expected both commands to be handled twice, got %d calls", handled)
+	}
+	if len(session.committed) != 2 {
+		t.Errorf("Expected exactly one committed reply per command, got %d", len(session.committed))
+	}
+	if !slices.Equal(session.ends, []kgo.TransactionEndTry{kgo.TryAbort, kgo.TryCommit}) {
+		t.Errorf("Expected an abort then a commit, got %v", session.ends)
+	}
+}
+
+func TestConsumeTransformRedeliversBatchAfterRebalance(t *testing.T) {
+	session := newFakeSession(fetchesOf("reserve-1"))
+	session.rebalance = true
+
+	c := &Consumer{cfg: &config.Config{Kafka: config.KafkaConfig{HandlerAttempts: 1}}, session: session}
+	handled := 0
+
+	if err := consumeTransform(c, session, &handled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a lost commit to be consumed again rather than stop, got %v", err)
+	}
+
+	if handled != 2 {
+		t.Errorf("Expected the command to be handled again, got %d calls", handled)
+	}
+	if len(session.committed) != 1 {
+		t.Errorf("Expected exactly one committed reply, got %d", len(session.committed))
+	}
+}
+
+func TestConsumeTransformAbortsWithoutDLQ(t *testing.T) {
+	session := newFakeSession(fetchesOf("reserve-1", "poison"))
+
+	c := &Consumer{cfg: &config.Config{Kafka: config.KafkaConfig{HandlerAttempts: 1}}, session: session}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session.drained = cancel
+
+	err := c.ConsumeTransform(ctx, func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error) {
+		if string(record.Value) == "poison" {
+			return nil, Fatal(errors.New("malformed event"))
+		}
+
+		return []*kgo.Record{{Topic: "replies", Key: record.Key, Value: []byte("reply")}}, nil
+	})
+	if err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the poison record to stop consumption, got %v", err)
+	}
+
+	if len(session.committed) != 0 || len(session.pending) != 0 {
+		t.Errorf("Expected the reply of the first command to be aborted with the batch, got %d committed", len(session.committed))
+	}
+	if !slices.Equal(session.ends, []kgo.TransactionEndTry{kgo.TryAbort}) {
+		t.Errorf("Expected the transaction to be aborted, got %v", session.ends)
+	}
+}
+
+// TestConsumeTransformSurvivesCrashBeforeCommit checks the same against a real broker, which
+// the tests above cannot stand in for: Kafka fencing the crashed instance's transactional ID.
+// Run it with KAFKA_TEST_BROKERS=localhost:9092 against docker compose
+func TestConsumeTransformSurvivesCrashBeforeCommit(t *testing.T) {
+	brokers := os.Getenv("KAFKA_TEST_BROKERS")
+	if brokers == "" {
+		t.Skip("KAFKA_TEST_BROKERS not set")
+	}
+
+	suffix := uuid.NewString()
+	commands, replies, group, txnID := "eos.commands."+suffix, "eos.replies."+suffix, "eos-"+suffix, "eos-"+suffix
+
+	cfg := &config.Config{Kafka: config.KafkaConfig{
+		Brokers:         strings.Split(brokers, ","),
+		HandlerAttempts: 1,
+		RetryBackoff:    time.Millisecond,
+	}}
+
+	produce(t, cfg, &kgo.Record{Topic: commands, Key: []byte("saga-1"), Value: []byte("reserve")})
+
+	// The first instance produces its reply and crashes before the transaction, and with it the
+	// offset commit, is ended
+	crashed, err := kgo.NewClient(kgo.SeedBrokers(cfg.Kafka.Brokers...), kgo.TransactionalID(txnID))
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer crashed.Close()
+
+	if err := crashed.BeginTransaction(); err != nil {
+		t.Fatalf("BeginTransaction() failed: %v", err)
+	}
+
+	if err := crashed.ProduceSync(context.Background(), &kgo.Record{Topic: replies, Key: []byte("saga-1"), Value: []byte("reply")}).FirstErr(); err != nil {
+		t.Fatalf("ProduceSync() failed: %v", err)
+	}
+
+	// Its replacement reuses the transactional ID, which aborts the open transaction, and handles
+	// the command again since its offset was never committed
+	consumer, err := NewTransactionalConsumer(cfg, group, txnID, []string{commands}, "")
+	if err != nil {
+		t.Fatalf("NewTransactionalConsumer() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- consumer.ConsumeTransform(ctx, func(ctx context.Context, record *kgo.Record) ([]*kgo.Record, error) {
+			return []*kgo.Record{{Topic: replies, Key: record.Key, Value: []byte("reply")}}, nil
+		})
+	}()
+
+	reader, err := kgo.NewClient(
+		kgo.SeedBrokers(cfg.Kafka.Brokers...),
+		kgo.ConsumeTopics(replies),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+	)
+	if err != nil {
+		t.Fatalf("kgo.NewClient() failed: %v", err)
+	}
+	defer reader.Close()
+
+	// Wait for the first committed reply, then keep reading a little to catch a duplicate
+	seen := 0
+	settle := time.Time{}
+
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); {
+		if !settle.IsZero() && time.Now().After(settle) {
+			break
+		}
+
+		pollCtx, pollCancel := context.WithTimeout(ctx, time.Second)
+		seen += reader.PollFetches(pollCtx).NumRecords()
+		pollCancel()
+
+		if seen > 0 && settle.IsZero() {
+			settle = time.Now().Add(3 * time.Second)
+		}
+	}
+
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConsumeTransform() stopped with %v", err)
+	}
+
+	consumer.Close()
+
+	if seen != 1 {
+		t.Fatalf("Expected exactly one committed reply, got %d", seen)
+	}
+
+	// The command's offset was committed together with the reply, a new member starts after it
+	cfg.Kafka.RetryTiers = nil
+
+	again, err := NewConsumer(cfg, group, []string{commands}, "")
+	if err != nil {
+		t.Fatalf("NewConsumer() failed: %v", err)
+	}
+	defer again.Close()
+
+	againCtx, againCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer againCancel()
+
+	again.Consume(againCtx, func(ctx context.Context, record *kgo.Record) error {
+		t.Errorf("Expected the command not to be consumed again, got offset %d", record.Offset)
+		return nil
+	})
+}
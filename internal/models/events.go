@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 )
@@ -8,20 +10,46 @@ import (
 type EventType string
 
 const (
+	// Order lifecycle (consumed by the saga orchestrator)
+	EventOrderCreated EventType = "ORDER_CREATED"
+	EventCancelOrder  EventType = "CANCEL_ORDER"
+
+	// Order status (published on the order events topic for anyone tracking orders)
+	EventOrderStatusChanged EventType = "ORDER_STATUS_CHANGED"
+
 	// Commands (requests to services)
-	EventReserveInventory EventType = "RESERVE_INVENTORY"
-	EventReleaseInventory EventType = "RELEASE_INVENTORY"
-	EventProcessPayment   EventType = "PROCESS_PAYMENT"
-	EventRefundPayment    EventType = "REFUND_PAYMENT"
-	EventSendNotification EventType = "SEND_NOTIFICATION"
+	EventReserveInventory  EventType = "RESERVE_INVENTORY"
+	EventReleaseInventory  EventType = "RELEASE_INVENTORY"
+	EventConfirmInventory  EventType = "CONFIRM_INVENTORY"
+	EventProcessPayment    EventType = "PROCESS_PAYMENT"
+	EventRefundPayment     EventType = "REFUND_PAYMENT"
+	EventAuthorizePayment  EventType = "AUTHORIZE_PAYMENT"
+	EventCapturePayment    EventType = "CAPTURE_PAYMENT"
+	EventVoidAuthorization EventType = "VOID_AUTHORIZATION"
+	EventSendNotification  EventType = "SEND_NOTIFICATION"
 
 	// Replies (responses from services)
-	EventInventoryReserved  EventType = "INVENTORY_RESERVED"
-	EventInventoryFailed    EventType = "INVENTORY_FAILED"
-	EventPaymentProcessed   EventType = "PAYMENT_PROCESSED"
-	EventPaymentFailed      EventType = "PAYMENT_FAILED"
-	EventNotificationSent   EventType = "NOTIFICATION_SENT"
-	EventNotificationFailed EventType = "NOTIFICATION_FAILED"
+	EventInventoryReserved          EventType = "INVENTORY_RESERVED"
+	EventInventoryFailed            EventType = "INVENTORY_FAILED"
+	EventPaymentProcessed           EventType = "PAYMENT_PROCESSED"
+	EventPaymentFailed              EventType = "PAYMENT_FAILED"
+	EventNotificationSent           EventType = "NOTIFICATION_SENT"
+	EventNotificationFailed         EventType = "NOTIFICATION_FAILED"
+	EventPaymentAuthorized          EventType = "PAYMENT_AUTHORIZED"
+	EventPaymentAuthorizationFailed EventType = "PAYMENT_AUTHORIZATION_FAILED"
+	EventPaymentCaptured            EventType = "PAYMENT_CAPTURED"
+	EventPaymentCaptureFailed       EventType = "PAYMENT_CAPTURE_FAILED"
+
+	// Compensation replies
+	EventInventoryReleased       EventType = "INVENTORY_RELEASED"
+	EventInventoryReleaseFailed  EventType = "INVENTORY_RELEASE_FAILED"
+	EventPaymentRefunded         EventType = "PAYMENT_REFUNDED"
+	EventPaymentRefundFailed     EventType = "PAYMENT_REFUND_FAILED"
+	EventAuthorizationVoided     EventType = "AUTHORIZATION_VOIDED"
+	EventAuthorizationVoidFailed EventType = "AUTHORIZATION_VOID_FAILED"
+
+	// Notices (emitted by services on their own)
+	EventInventoryHoldExpired EventType = "INVENTORY_HOLD_EXPIRED"
 )
 
 type Event struct {
@@ -39,6 +67,31 @@ type InventoryItem struct {
 	Quantity int       `json:"quantity"`
 }
 
+// Order lifecycle payloads
+type OrderCreatedEvent struct {
+	// PublicID is the readable order ID customers are shown, see Order.PublicID
+	PublicID   string          `json:"public_id,omitempty"`
+	CustomerID string          `json:"customer_id"`
+	Items      []InventoryItem `json:"items"`
+	Amount     Money           `json:"amount"`
+	// FXRate is the rate frozen on the order, see Order.FXRate
+	FXRate *ExchangeRate `json:"fx_rate,omitempty"`
+}
+
+// CancelOrderCommand asks the orchestrator to stop the saga in the envelope and undo what it did
+type CancelOrderCommand struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// OrderStatusChangedEvent announces one change of Order.Status
+type OrderStatusChangedEvent struct {
+	PublicID  string      `json:"public_id"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Reason    string      `json:"reason,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
 // Command payloads
 type ReserveInventoryCommand struct {
 	Items []InventoryItem `json:"items"`
@@ -48,20 +101,46 @@ type ReleaseInventoryCommand struct {
 	Items []InventoryItem `json:"items"`
 }
 
+// ConfirmInventoryCommand makes the hold of the saga in the envelope permanent
+type ConfirmInventoryCommand struct{}
+
 type ProcessPaymentCommand struct {
-	Amount     float64 `json:"amount"`
-	CustomerID string  `json:"customer_id"`
+	Amount     Money  `json:"amount"`
+	CustomerID string `json:"customer_id"`
 }
 
 type RefundPaymentCommand struct {
-	PaymentID string  `json:"payment_id"`
-	Amount    float64 `json:"amount"`
+	PaymentID string `json:"payment_id"`
+	Amount    Money  `json:"amount"`
+}
+
+// AuthorizePaymentCommand holds Amount on the customer's payment method without taking it
+type AuthorizePaymentCommand struct {
+	Amount     Money  `json:"amount"`
+	CustomerID string `json:"customer_id"`
+}
+
+// CapturePaymentCommand takes the money of a previous authorization
+type CapturePaymentCommand struct {
+	PaymentID string `json:"payment_id"`
+	Amount    Money  `json:"amount"`
 }
 
+// VoidAuthorizationCommand releases an authorization that was never captured
+type VoidAuthorizationCommand struct {
+	PaymentID string `json:"payment_id"`
+}
+
+// SendNotificationCommand is rendered with the template of Kind. Reason explains cancellations
+// and Message is an optional note appended to the rendered text
 type SendNotificationCommand struct {
-	CustomerID string    `json:"customer_id"`
-	OrderID    uuid.UUID `json:"order_id"`
-	Message    string    `json:"message"`
+	CustomerID string           `json:"customer_id"`
+	OrderID    uuid.UUID        `json:"order_id"`
+	PublicID   string           `json:"public_id,omitempty"`
+	Kind       NotificationKind `json:"kind"`
+	Amount     Money            `json:"amount"`
+	Reason     string           `json:"reason,omitempty"`
+	Message    string           `json:"message,omitempty"`
 }
 
 // Reply payloads
@@ -80,3 +159,8 @@ type NotificationReply struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 }
+
+// Notice payloads
+type InventoryHoldExpiredEvent struct {
+	Items []InventoryItem `json:"items"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// rateDecimals is how many decimals a derived rate keeps, e.g. the inverse of a quoted one
+const rateDecimals = 10
+
+// ExchangeRate converts amounts in Base into Quote: one unit of Base is worth Rate units of Quote.
+// Rate is a decimal string so the exact rate used can be stored with an order and applied again
+type ExchangeRate struct {
+	Base  string    `json:"base"`
+	Quote string    `json:"quote"`
+	Rate  string    `json:"rate"`
+	AsOf  time.Time `json:"as_of"`
+}
+
+// NewExchangeRate freezes rate as a decimal string with at most ten decimals
+func NewExchangeRate(base, quote string, rate *big.Rat, asOf time.Time) (ExchangeRate, error) {
+	if rate.Sign() <= 0 {
+		return ExchangeRate{}, fmt.Errorf("invalid %s/%s rate %s", base, quote, rate.RatString())
+	}
+
+	s := strings.TrimRight(strings.TrimRight(rate.FloatString(rateDecimals), "0"), ".")
+
+	return ExchangeRate{Base: base, Quote: quote, Rate: s, AsOf: asOf}, nil
+}
+
+// Convert turns m, which must be in Base, into Quote, rounding half to even to a minor unit of Quote
+func (r ExchangeRate) Convert(m Money) (Money, error) {
+	if m.Currency != r.Base {
+		return Money{}, fmt.Errorf("%w: cannot convert %s with a %s/%s rate", ErrCurrencyMismatch, m.Currency, r.Base, r.Quote)
+	}
+
+	rate, ok := new(big.Rat).SetString(r.Rate)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid %s/%s rate %q", r.Base, r.Quote, r.Rate)
+	}
+
+	baseExp, err := CurrencyExponent(r.Base)
+	if err != nil {
+		return Money{}, err
+	}
+
+	quoteExp, err := CurrencyExponent(r.Quote)
+	if err != nil {
+		return Money{}, err
+	}
+
+	// Minor units of Base to minor units of Quote
+	factor := new(big.Rat).Mul(rate, new(big.Rat).SetFrac(pow10(quoteExp), pow10(baseExp)))
+
+	converted, err := m.Scale(factor, RoundHalfEven)
+	if err != nil {
+		return Money{}, err
+	}
+
+	converted.Currency = r.Quote
+
+	return converted, nil
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
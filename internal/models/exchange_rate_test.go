@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestNewExchangeRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       *big.Rat
+		expectRate string
+	}{
+		{name: "whole", rate: big.NewRat(150, 1), expectRate: "150"},
+		{name: "decimal", rate: big.NewRat(92, 100), expectRate: "0.92"},
+		{name: "inverse keeps ten decimals", rate: big.NewRat(100, 92), expectRate: "1.0869565217"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := NewExchangeRate("USD", "EUR", tt.rate, time.Time{})
+			if err != nil {
+				t.Fatalf("NewExchangeRate() failed: %v", err)
+			}
+
+			if rate.Rate != tt.expectRate {
+				t.Errorf("Expected rate %s, got %s", tt.expectRate, rate.Rate)
+			}
+		})
+	}
+
+	if _, err := NewExchangeRate("USD", "EUR", new(big.Rat), time.Time{}); err == nil {
+		t.Errorf("Expected a zero rate to be refused")
+	}
+}
+
+func TestExchangeRateConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   ExchangeRate
+		amount Money
+		expect Money
+	}{
+		{name: "rounds half to even", rate: ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.5"}, amount: Money{Amount: 1, Currency: "USD"}, expect: Money{Amount: 0, Currency: "EUR"}},
+		{name: "two decimals", rate: ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.92"}, amount: Money{Amount: 4990, Currency: "USD"}, expect: Money{Amount: 4591, Currency: "EUR"}},
+		{name: "into no minor unit", rate: ExchangeRate{Base: "USD", Quote: "JPY", Rate: "149.87"}, amount: Money{Amount: 1999, Currency: "USD"}, expect: Money{Amount: 2996, Currency: "JPY"}},
+		{name: "from no minor unit", rate: ExchangeRate{Base: "JPY", Quote: "USD", Rate: "0.0066"}, amount: Money{Amount: 1000, Currency: "JPY"}, expect: Money{Amount: 660, Currency: "USD"}},
+		{name: "into three decimals", rate: ExchangeRate{Base: "USD", Quote: "KWD", Rate: "0.3071"}, amount: Money{Amount: 1000, Currency: "USD"}, expect: Money{Amount: 3071, Currency: "KWD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, err := tt.rate.Convert(tt.amount)
+			if err != nil {
+				t.Fatalf("Convert() failed: %v", err)
+			}
+
+			if converted != tt.expect {
+				t.Errorf("Expected %s, got %s", tt.expect, converted)
+			}
+		})
+	}
+
+	rate := ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.92"}
+	if _, err := rate.Convert(Money{Amount: 100, Currency: "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidMoney     = errors.New("invalid money amount")
+	ErrMoneyOverflow    = errors.New("money amount overflows")
+)
+
+// currencyExponents holds the number of minor unit digits of the supported ISO 4217 currencies
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CLP": 0,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"USD": 2,
+}
+
+// Money is an exact amount in the minor units of an ISO 4217 currency, e.g. 1234 USD is 12.34 USD.
+// The zero value has no currency and only serves as "no amount"
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// CurrencyExponent returns the number of minor unit digits of currency
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	return exp, nil
+}
+
+// NewMoney builds an amount of minor units of currency
+func NewMoney(minor int64, currency string) (Money, error) {
+	if _, err := CurrencyExponent(currency); err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// MoneyFromDecimal parses a decimal amount in major units such as "12.34" or "-0.5". Digits past the
+// minor unit of currency are only accepted when they are zeros, so nothing is rounded silently
+func MoneyFromDecimal(amount, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := amount
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, amount)
+	}
+
+	if len(frac) > exp {
+		if strings.Trim(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q has more than %d decimals for %s", ErrInvalidMoney, amount, exp, currency)
+		}
+
+		frac = frac[:exp]
+	}
+
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", exp-len(frac)), "0")
+	if digits == "" {
+		return Money{Currency: currency}, nil
+	}
+
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrMoneyOverflow, amount)
+	}
+
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// ParseMoney parses the String form of an amount, e.g. "12.34 USD"
+func ParseMoney(s string) (Money, error) {
+	amount, currency, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q lacks a currency", ErrInvalidMoney, s)
+	}
+
+	return MoneyFromDecimal(amount, strings.TrimSpace(currency))
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsZero reports whether m is an amount of nothing, in any currency
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether m is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	return nil
+}
+
+// Add returns m + o, which must be in the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrMoneyOverflow, m, o)
+	}
+
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o, which must be in the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrMoneyOverflow, m, o)
+	}
+
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m times n, e.g. the price of n units of an item
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, fmt.Errorf("%w: %s * %d", ErrMoneyOverflow, m, n)
+	}
+
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Scale returns m times factor rounded to a minor unit with mode, e.g. for rates and percentages
+func (m Money) Scale(factor *big.Rat, mode RoundingMode) (Money, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), factor)
+
+	minor, err := roundRat(product, mode)
+	if err != nil {
+		return Money{}, err
+	}
+
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %s * %s", ErrMoneyOverflow, m, factor.RatString())
+	}
+
+	return Money{Amount: minor.Int64(), Currency: m.Currency}, nil
+}
+
+// roundRat rounds r to an integer with mode
+func roundRat(r *big.Rat, mode RoundingMode) (*big.Int, error) {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return quo, nil
+	}
+
+	// Compare twice the remainder with the denominator to find out which side of the half r is on
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(r.Denom())
+
+	awayFromZero := false
+
+	switch mode {
+	case RoundDown:
+	case RoundHalfUp:
+		awayFromZero = cmp >= 0
+	case RoundHalfEven:
+		awayFromZero = cmp > 0 || cmp == 0 && quo.Bit(0) == 1
+	default:
+		return nil, fmt.Errorf("unknown rounding mode %q", mode)
+	}
+
+	if awayFromZero {
+		quo.Add(quo, big.NewInt(int64(r.Sign())))
+	}
+
+	return quo, nil
+}
+
+// Cmp compares m with o, which must be in the same currency, returning -1, 0 or +1
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Rat returns m in major units
+func (m Money) Rat() *big.Rat {
+	exp := currencyExponents[m.Currency]
+
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(exp))
+}
+
+// Decimal formats m in major units without the currency, e.g. "12.34"
+func (m Money) Decimal() string {
+	return m.Rat().FloatString(currencyExponents[m.Currency])
+}
+
+// String formats m as the decimal amount followed by the currency, e.g. "12.34 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type moneyJSON struct {
+	Amount   sonic.NoCopyRawMessage `json:"amount"`
+	Currency string                 `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "12.34", "currency": "USD"}. The amount is a string so
+// decoders never round it through a float. The zero value is null
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.Currency == "" {
+		return []byte("null"), nil
+	}
+
+	return sonic.Marshal(map[string]string{"amount": m.Decimal(), "currency": m.Currency})
+}
+
+// UnmarshalJSON accepts the object MarshalJSON writes, with the amount as a string or number, or
+// the String form such as "12.34 USD". null leaves m unchanged
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := sonic.Unmarshal(data, &s); err != nil {
+			return err
+		}
+
+		parsed, err := ParseMoney(s)
+		if err != nil {
+			return err
+		}
+
+		*m = parsed
+
+		return nil
+	}
+
+	var raw moneyJSON
+	if err := sonic.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMoney, err)
+	}
+
+	// A number is taken by its text, which keeps it exact
+	amount := string(bytes.Trim(raw.Amount, `"`))
+	if strings.ContainsAny(amount, "eE") {
+		return fmt.Errorf("%w: %s uses an exponent", ErrInvalidMoney, amount)
+	}
+
+	parsed, err := MoneyFromDecimal(amount, raw.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+// Scan reads the String form of an amount, e.g. from price::text || ' ' || currency. NULL is
+// the zero value
+func (m *Money) Scan(src any) error {
+	var s string
+
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
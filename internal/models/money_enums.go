@@ -0,0 +1,13 @@
+package models
+
+// RoundingMode decides how an amount that falls between two minor units is rounded.
+type RoundingMode string
+
+const (
+	// RoundHalfEven rounds halves to the even neighbour, so rounding errors cancel out over many amounts.
+	RoundHalfEven RoundingMode = "HALF_EVEN"
+	// RoundHalfUp rounds halves away from zero.
+	RoundHalfUp RoundingMode = "HALF_UP"
+	// RoundDown drops the excess digits, rounding towards zero.
+	RoundDown RoundingMode = "DOWN"
+)
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/bytedance/sonic"
+)
+
+func usd(minor int64) Money {
+	return Money{Amount: minor, Currency: "USD"}
+}
+
+func TestMoneyFromDecimal(t *testing.T) {
+	tests := []struct {
+		amount    string
+		currency  string
+		expected  Money
+		expectErr error
+	}{
+		{amount: "12.34", currency: "USD", expected: usd(1234)},
+		{amount: "12.3", currency: "USD", expected: usd(1230)},
+		{amount: "12", currency: "USD", expected: usd(1200)},
+		{amount: ".5", currency: "USD", expected: usd(50)},
+		{amount: "-0.05", currency: "USD", expected: usd(-5)},
+		{amount: "12.500", currency: "USD", expected: usd(1250)},
+		{amount: "1200.00", currency: "JPY", expected: Money{Amount: 1200, Currency: "JPY"}},
+		{amount: "1.234", currency: "KWD", expected: Money{Amount: 1234, Currency: "KWD"}},
+		{amount: "12.345", currency: "USD", expectErr: ErrInvalidMoney},
+		{amount: "1e3", currency: "USD", expectErr: ErrInvalidMoney},
+		{amount: "", currency: "USD", expectErr: ErrInvalidMoney},
+		{amount: "12", currency: "XXX", expectErr: ErrUnknownCurrency},
+		{amount: "92233720368547758.08", currency: "USD", expectErr: ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := MoneyFromDecimal(tt.amount, tt.currency)
+
+		if tt.expectErr != nil {
+			if !errors.Is(err, tt.expectErr) {
+				t.Errorf("Expected %v for %q %s, got %v", tt.expectErr, tt.amount, tt.currency, err)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.expected {
+			t.Errorf("Expected %s for %q, got %s (%v)", tt.expected, tt.amount, got, err)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	sum, err := usd(1050).Add(usd(-50))
+	if err != nil || sum != usd(1000) {
+		t.Errorf("Expected 10.00 USD, got %s (%v)", sum, err)
+	}
+
+	diff, err := usd(1000).Sub(usd(1))
+	if err != nil || diff != usd(999) {
+		t.Errorf("Expected 9.99 USD, got %s (%v)", diff, err)
+	}
+
+	product, err := usd(4990).Mul(3)
+	if err != nil || product != usd(14970) {
+		t.Errorf("Expected 149.70 USD, got %s (%v)", product, err)
+	}
+
+	if _, err := usd(100).Add(Money{Amount: 100, Currency: "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Expected a currency mismatch, got %v", err)
+	}
+	if _, err := usd(math.MaxInt64).Add(usd(1)); !errors.Is(err, ErrMoneyOverflow) {
+		t.Errorf("Expected an overflow on Add, got %v", err)
+	}
+	if _, err := usd(math.MaxInt64 / 2).Mul(3); !errors.Is(err, ErrMoneyOverflow) {
+		t.Errorf("Expected an overflow on Mul, got %v", err)
+	}
+	if cmp, err := usd(100).Cmp(usd(99)); err != nil || cmp != 1 {
+		t.Errorf("Expected 1.00 USD > 0.99 USD, got %d (%v)", cmp, err)
+	}
+}
+
+func TestMoneyScaleRounding(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		factor   *big.Rat
+		mode     RoundingMode
+		expected int64
+	}{
+		{amount: 5, factor: big.NewRat(1, 2), mode: RoundHalfEven, expected: 2},
+		{amount: 7, factor: big.NewRat(1, 2), mode: RoundHalfEven, expected: 4},
+		{amount: 5, factor: big.NewRat(1, 2), mode: RoundHalfUp, expected: 3},
+		{amount: -5, factor: big.NewRat(1, 2), mode: RoundHalfUp, expected: -3},
+		{amount: 5, factor: big.NewRat(1, 2), mode: RoundDown, expected: 2},
+		{amount: 1000, factor: big.NewRat(1, 3), mode: RoundHalfEven, expected: 333},
+		{amount: 2000, factor: big.NewRat(1, 3), mode: RoundHalfEven, expected: 667},
+		{amount: -2000, factor: big.NewRat(1, 3), mode: RoundDown, expected: -666},
+	}
+
+	for _, tt := range tests {
+		got, err := usd(tt.amount).Scale(tt.factor, tt.mode)
+		if err != nil || got != usd(tt.expected) {
+			t.Errorf("Expected %d * %s rounded %s to be %d, got %d (%v)", tt.amount, tt.factor.RatString(), tt.mode, tt.expected, got.Amount, err)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := sonic.Marshal(usd(1234))
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	if string(data) != `{"amount":"12.34","currency":"USD"}` {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+
+	tests := []struct {
+		json      string
+		expected  Money
+		expectErr bool
+	}{
+		{json: `{"amount":"12.34","currency":"USD"}`, expected: usd(1234)},
+		{json: `{"amount":12.34,"currency":"USD"}`, expected: usd(1234)},
+		{json: `"12.34 USD"`, expected: usd(1234)},
+		{json: `"1200 JPY"`, expected: Money{Amount: 1200, Currency: "JPY"}},
+		{json: `null`, expected: Money{}},
+		{json: `{"amount":1.2e3,"currency":"USD"}`, expectErr: true},
+		{json: `"12.34"`, expectErr: true},
+		{json: `12.34`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := sonic.Unmarshal([]byte(tt.json), &got)
+
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("Expected %s to be rejected, got %s", tt.json, got)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.expected {
+			t.Errorf("Expected %s to decode to %s, got %s (%v)", tt.json, tt.expected, got, err)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+
+	if err := m.Scan([]byte("49.900 USD")); err != nil || m != usd(4990) {
+		t.Errorf("Expected 49.90 USD, got %s (%v)", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != (Money{}) {
+		t.Errorf("Expected NULL to scan to the zero value, got %s (%v)", m, err)
+	}
+	if err := m.Scan(49.9); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Expected floats to be rejected, got %v", err)
+	}
+}
+
+func TestMoneyDatabaseRoundTrip(t *testing.T) {
+	// Stores write Decimal into a NUMERIC column and Currency into its own, and read them back
+	// as amount::text || ' ' || currency, which carries the column's scale
+	tests := []struct {
+		money  Money
+		stored string
+	}{
+		{usd(4990), "49.900"},
+		{usd(-5), "-0.050"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500.000"},
+	}
+
+	for _, tt := range tests {
+		parsed, err := MoneyFromDecimal(tt.money.Decimal(), tt.money.Currency)
+		if err != nil || parsed != tt.money {
+			t.Errorf("Expected %s to write as a plain decimal, got %q", tt.money, tt.money.Decimal())
+		}
+
+		var got Money
+		if err := got.Scan(tt.stored + " " + tt.money.Currency); err != nil || got != tt.money {
+			t.Errorf("Expected %q to scan back to %s, got %s (%v)", tt.stored, tt.money, got, err)
+		}
+	}
+}
+
+func TestOrderTotal(t *testing.T) {
+	order := Order{Items: []OrderItem{{Quantity: 2, Price: usd(4990)}, {Quantity: 1, Price: usd(1)}}}
+
+	if total, err := order.Total(); err != nil || total != usd(9981) {
+		t.Errorf("Expected 99.81 USD, got %s (%v)", total, err)
+	}
+
+	order.Items = append(order.Items, OrderItem{Quantity: 1, Price: Money{Amount: 100, Currency: "EUR"}})
+
+	if _, err := order.Total(); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Expected mixed currencies to fail, got %v", err)
+	}
+}
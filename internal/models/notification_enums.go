@@ -0,0 +1,10 @@
+package models
+
+// NotificationKind selects the message template a notification is rendered with.
+type NotificationKind string
+
+const (
+	NotificationOrderConfirmed NotificationKind = "ORDER_CONFIRMED"
+	NotificationOrderCancelled NotificationKind = "ORDER_CANCELLED"
+	NotificationRefundIssued   NotificationKind = "REFUND_ISSUED"
+)
@@ -1,19 +1,81 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Order struct {
-	ID         uuid.UUID   `json:"id"`
-	PublicID   string      `json:"public_id"`
-	CustomerID string      `json:"customer_id"`
-	Items      []OrderItem `json:"items"`
-	Status     OrderStatus `json:"status"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
+	ID       uuid.UUID `json:"id"`
+	PublicID string    `json:"public_id"`
+	// SagaID is the saga placing the order, commands about the order are sent to it
+	SagaID     uuid.UUID `json:"saga_id"`
+	CustomerID string    `json:"customer_id"`
+	Currency   string    `json:"currency"`
+	// FXRate converted the catalog prices into Currency when the order was placed, nil when
+	// they were already in it
+	FXRate *ExchangeRate `json:"fx_rate,omitempty"`
+	Items  []OrderItem   `json:"items"`
+	Status OrderStatus   `json:"status"`
+	// History lists the status changes of the order, oldest first
+	History   []OrderStatusChange `json:"history,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// orderTransitions lists the statuses each status can move to. COMPLETED, CANCELLED and FAILED
+// are final. FINALIZING orders can still end CANCELLED when the saga's last step fails and it is
+// compensated, but not because the customer asked, see IsCancellable
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderProcessing, OrderCancelled, OrderFailed},
+	OrderProcessing: {OrderFinalizing, OrderCompleted, OrderCancelled, OrderFailed},
+	OrderFinalizing: {OrderCompleted, OrderCancelled, OrderFailed},
+}
+
+// OrderStatusChange is one entry of the status history of an order
+type OrderStatusChange struct {
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Reason    string      `json:"reason,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+// CanTransition reports whether an order in status s can move to to
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	return slices.Contains(orderTransitions[s], to)
+}
+
+// IsFinal reports whether an order in status s can no longer change
+func (s OrderStatus) IsFinal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// IsCancellable reports whether a customer can still cancel an order in status s. A FINALIZING
+// order is being charged, cancelling it would leave the customer charged for nothing
+func (s OrderStatus) IsCancellable() bool {
+	return s == OrderPending || s == OrderProcessing
+}
+
+// Transition moves the order to status to and records the change with reason in its history.
+// Moves the transition table does not allow fail with ErrInvalidTransition
+func (o *Order) Transition(to OrderStatus, reason string) error {
+	if !o.Status.CanTransition(to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, o.Status, to)
+	}
+
+	now := time.Now().UTC()
+
+	o.History = append(o.History, OrderStatusChange{From: o.Status, To: to, Reason: reason, ChangedAt: now})
+	o.Status = to
+	o.UpdatedAt = now
+
+	return nil
 }
 
 type OrderItem struct {
@@ -21,23 +83,36 @@ type OrderItem struct {
 	OrderID  uuid.UUID `json:"order_id"`
 	ItemID   uuid.UUID `json:"item_id"`
 	Quantity int       `json:"quantity"`
-	Price    float64   `json:"price"`
+	Price    Money     `json:"price"`
 }
 
 type Item struct {
 	ID          uuid.UUID `json:"id"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
 	Name        string    `json:"name"`
 	Description string    `json:"description,omitempty"`
 	Stock       int
 }
 
-func (o *Order) Total() float64 {
-	total := 0.0
+// Total sums the prices of the order lines, which must all be in one currency
+func (o *Order) Total() (Money, error) {
+	var total Money
+
+	for i, orderItem := range o.Items {
+		line, err := orderItem.Price.Mul(int64(orderItem.Quantity))
+		if err != nil {
+			return Money{}, err
+		}
+
+		if i == 0 {
+			total = line
+			continue
+		}
 
-	for _, orderItem := range o.Items {
-		total += orderItem.Price * float64(orderItem.Quantity)
+		if total, err = total.Add(line); err != nil {
+			return Money{}, err
+		}
 	}
 
-	return total
+	return total, nil
 }
@@ -6,6 +6,7 @@ type OrderStatus string
 const (
 	OrderPending    OrderStatus = "PENDING"
 	OrderProcessing OrderStatus = "PROCESSING"
+	OrderFinalizing OrderStatus = "FINALIZING"
 	OrderCompleted  OrderStatus = "COMPLETED"
 	OrderCancelled  OrderStatus = "CANCELLED"
 	OrderFailed     OrderStatus = "FAILED"
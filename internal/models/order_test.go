@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderTransition(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      OrderStatus
+		to        OrderStatus
+		expectErr bool
+	}{
+		{name: "start processing", from: OrderPending, to: OrderProcessing},
+		{name: "cancel before processing", from: OrderPending, to: OrderCancelled},
+		{name: "complete", from: OrderProcessing, to: OrderCompleted},
+		{name: "fail", from: OrderProcessing, to: OrderFailed},
+		{name: "finalize", from: OrderProcessing, to: OrderFinalizing},
+		{name: "complete finalized", from: OrderFinalizing, to: OrderCompleted},
+		{name: "compensate finalized", from: OrderFinalizing, to: OrderCancelled},
+		{name: "reopen finalized", from: OrderFinalizing, to: OrderProcessing, expectErr: true},
+		{name: "skip processing", from: OrderPending, to: OrderCompleted, expectErr: true},
+		{name: "reopen completed", from: OrderCompleted, to: OrderPending, expectErr: true},
+		{name: "cancel completed", from: OrderCompleted, to: OrderCancelled, expectErr: true},
+		{name: "revive cancelled", from: OrderCancelled, to: OrderProcessing, expectErr: true},
+		{name: "same status", from: OrderProcessing, to: OrderProcessing, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: tt.from}
+
+			err := order.Transition(tt.to, "because")
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Errorf("Expected ErrInvalidTransition, got %v", err)
+				}
+				if order.Status != tt.from || len(order.History) != 0 {
+					t.Errorf("Expected a refused transition to change nothing, got %s %+v", order.Status, order.History)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Transition() failed: %v", err)
+			}
+
+			if order.Status != tt.to || len(order.History) != 1 {
+				t.Fatalf("Expected status %s with one history entry, got %s %+v", tt.to, order.Status, order.History)
+			}
+
+			change := order.History[0]
+			if change.From != tt.from || change.To != tt.to || change.Reason != "because" || !change.ChangedAt.Equal(order.UpdatedAt) {
+				t.Errorf("Unexpected history entry %+v", change)
+			}
+		})
+	}
+}
+
+func TestOrderStatusIsFinal(t *testing.T) {
+	for status, expect := range map[OrderStatus]bool{
+		OrderPending:    false,
+		OrderProcessing: false,
+		OrderFinalizing: false,
+		OrderCompleted:  true,
+		OrderCancelled:  true,
+		OrderFailed:     true,
+	} {
+		if status.IsFinal() != expect {
+			t.Errorf("Expected %s final to be %v", status, expect)
+		}
+	}
+}
+
+func TestOrderStatusIsCancellable(t *testing.T) {
+	for status, expect := range map[OrderStatus]bool{
+		OrderPending:    true,
+		OrderProcessing: true,
+		OrderFinalizing: false,
+		OrderCompleted:  false,
+		OrderCancelled:  false,
+		OrderFailed:     false,
+	} {
+		if status.IsCancellable() != expect {
+			t.Errorf("Expected %s cancellable to be %v", status, expect)
+		}
+	}
+}
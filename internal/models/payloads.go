@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownEventType  = errors.New("unknown event type")
+	ErrPayloadMismatch   = errors.New("payload does not match event type")
+	ErrIncompletePayload = errors.New("payload is missing required fields")
+)
+
+// payloadTypes maps every event type to the struct its payload holds
+var payloadTypes = map[EventType]reflect.Type{
+	EventOrderCreated:       reflect.TypeFor[OrderCreatedEvent](),
+	EventCancelOrder:        reflect.TypeFor[CancelOrderCommand](),
+	EventOrderStatusChanged: reflect.TypeFor[OrderStatusChangedEvent](),
+
+	EventReserveInventory:  reflect.TypeFor[ReserveInventoryCommand](),
+	EventReleaseInventory:  reflect.TypeFor[ReleaseInventoryCommand](),
+	EventConfirmInventory:  reflect.TypeFor[ConfirmInventoryCommand](),
+	EventProcessPayment:    reflect.TypeFor[ProcessPaymentCommand](),
+	EventRefundPayment:     reflect.TypeFor[RefundPaymentCommand](),
+	EventAuthorizePayment:  reflect.TypeFor[AuthorizePaymentCommand](),
+	EventCapturePayment:    reflect.TypeFor[CapturePaymentCommand](),
+	EventVoidAuthorization: reflect.TypeFor[VoidAuthorizationCommand](),
+	EventSendNotification:  reflect.TypeFor[SendNotificationCommand](),
+
+	EventInventoryReserved:          reflect.TypeFor[InventoryReply](),
+	EventInventoryFailed:            reflect.TypeFor[InventoryReply](),
+	EventPaymentProcessed:           reflect.TypeFor[PaymentReply](),
+	EventPaymentFailed:              reflect.TypeFor[PaymentReply](),
+	EventNotificationSent:           reflect.TypeFor[NotificationReply](),
+	EventNotificationFailed:         reflect.TypeFor[NotificationReply](),
+	EventPaymentAuthorized:          reflect.TypeFor[PaymentReply](),
+	EventPaymentAuthorizationFailed: reflect.TypeFor[PaymentReply](),
+	EventPaymentCaptured:            reflect.TypeFor[PaymentReply](),
+	EventPaymentCaptureFailed:       reflect.TypeFor[PaymentReply](),
+
+	EventInventoryReleased:       reflect.TypeFor[InventoryReply](),
+	EventInventoryReleaseFailed:  reflect.TypeFor[InventoryReply](),
+	EventPaymentRefunded:         reflect.TypeFor[PaymentReply](),
+	EventPaymentRefundFailed:     reflect.TypeFor[PaymentReply](),
+	EventAuthorizationVoided:     reflect.TypeFor[PaymentReply](),
+	EventAuthorizationVoidFailed: reflect.TypeFor[PaymentReply](),
+
+	EventInventoryHoldExpired: reflect.TypeFor[InventoryHoldExpiredEvent](),
+}
+
+// PayloadType returns the struct registered for the payload of eventType
+func PayloadType(eventType EventType) (reflect.Type, error) {
+	t, ok := payloadTypes[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+	}
+
+	return t, nil
+}
+
+// checkPayloadType fails unless t is the payload struct registered for eventType
+func checkPayloadType(eventType EventType, t reflect.Type) error {
+	expected, err := PayloadType(eventType)
+	if err != nil {
+		return err
+	}
+
+	if t != expected {
+		return fmt.Errorf("%w: %s carries %s, got %v", ErrPayloadMismatch, eventType, expected, t)
+	}
+
+	return nil
+}
+
+// NewEvent builds an event envelope with a fresh ID and the current time around payload, which
+// must be the struct registered for eventType
+func NewEvent[T any](eventType EventType, sagaID, orderID uuid.UUID, payload T) (Event, error) {
+	// T is any where the payload is picked at runtime, so its dynamic type is the one to check
+	if err := checkPayloadType(eventType, reflect.TypeOf(payload)); err != nil {
+		return Event{}, err
+	}
+
+	raw, err := sonic.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Event:     eventType,
+		EventID:   uuid.New(),
+		SagaID:    sagaID,
+		OrderID:   orderID,
+		Timestamp: time.Now().UnixMilli(),
+		Payload:   raw,
+	}, nil
+}
+
+// DecodePayload decodes the payload of ev into T, failing if T is not the struct registered for
+// the event type or the payload lacks a field T requires. Fields T does not know are ignored, so
+// a producer can add one before every consumer is deployed with it
+func DecodePayload[T any](ev Event) (T, error) {
+	var payload T
+
+	if err := checkPayloadType(ev.Event, reflect.TypeFor[T]()); err != nil {
+		return payload, err
+	}
+
+	if err := sonic.Unmarshal(ev.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("%w: %s: %w", ErrPayloadMismatch, ev.Event, err)
+	}
+
+	if v, ok := any(payload).(payloadValidator); ok {
+		if err := v.validate(); err != nil {
+			return payload, fmt.Errorf("%w: %s: %w", ErrIncompletePayload, ev.Event, err)
+		}
+	}
+
+	return payload, nil
+}
+
+// payloadValidator is implemented by payloads with fields no handler can do without
+type payloadValidator interface {
+	validate() error
+}
+
+// required fails with the name of field unless it is present
+func required(field string, present bool) error {
+	if present {
+		return nil
+	}
+
+	return fmt.Errorf("missing %s", field)
+}
+
+func (p OrderCreatedEvent) validate() error {
+	return errors.Join(
+		required("customer_id", p.CustomerID != ""),
+		required("items", len(p.Items) > 0),
+		required("amount", p.Amount.Currency != ""),
+	)
+}
+
+func (p OrderStatusChangedEvent) validate() error {
+	return required("to", p.To != "")
+}
+
+func (p ReserveInventoryCommand) validate() error {
+	return required("items", len(p.Items) > 0)
+}
+
+func (p ReleaseInventoryCommand) validate() error {
+	return required("items", len(p.Items) > 0)
+}
+
+func (p ProcessPaymentCommand) validate() error {
+	return errors.Join(
+		required("amount", p.Amount.Currency != ""),
+		required("customer_id", p.CustomerID != ""),
+	)
+}
+
+func (p RefundPaymentCommand) validate() error {
+	return errors.Join(
+		required("payment_id", p.PaymentID != ""),
+		required("amount", p.Amount.Currency != ""),
+	)
+}
+
+func (p AuthorizePaymentCommand) validate() error {
+	return errors.Join(
+		required("amount", p.Amount.Currency != ""),
+		required("customer_id", p.CustomerID != ""),
+	)
+}
+
+func (p CapturePaymentCommand) validate() error {
+	return errors.Join(
+		required("payment_id", p.PaymentID != ""),
+		required("amount", p.Amount.Currency != ""),
+	)
+}
+
+func (p VoidAuthorizationCommand) validate() error {
+	return required("payment_id", p.PaymentID != "")
+}
+
+func (p SendNotificationCommand) validate() error {
+	return errors.Join(
+		required("customer_id", p.CustomerID != ""),
+		required("kind", p.Kind != ""),
+	)
+}
+
+func (p InventoryHoldExpiredEvent) validate() error {
+	return required("items", len(p.Items) > 0)
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewEventChecksPayloadType(t *testing.T) {
+	var dynamic any = PaymentReply{Success: true}
+
+	tests := []struct {
+		name      string
+		newEvent  func() (Event, error)
+		expectErr error
+	}{
+		{
+			name: "registered payload",
+			newEvent: func() (Event, error) {
+				return NewEvent(EventProcessPayment, uuid.New(), uuid.New(), ProcessPaymentCommand{Amount: Money{Amount: 1000, Currency: "USD"}})
+			},
+		},
+		{
+			name: "registered payload behind any",
+			newEvent: func() (Event, error) {
+				return NewEvent(EventPaymentProcessed, uuid.New(), uuid.New(), dynamic)
+			},
+		},
+		{
+			name: "payload of another event",
+			newEvent: func() (Event, error) {
+				return NewEvent(EventProcessPayment, uuid.New(), uuid.New(), RefundPaymentCommand{})
+			},
+			expectErr: ErrPayloadMismatch,
+		},
+		{
+			name: "pointer payload",
+			newEvent: func() (Event, error) {
+				return NewEvent(EventProcessPayment, uuid.New(), uuid.New(), &ProcessPaymentCommand{})
+			},
+			expectErr: ErrPayloadMismatch,
+		},
+		{
+			name: "unknown event type",
+			newEvent: func() (Event, error) {
+				return NewEvent(EventType("ORDER_SHIPPED"), uuid.New(), uuid.New(), struct{}{})
+			},
+			expectErr: ErrUnknownEventType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.newEvent()
+
+			if tt.expectErr == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.expectErr != nil && !errors.Is(err, tt.expectErr) {
+				t.Errorf("Expected %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestDecodePayloadRoundTrip(t *testing.T) {
+	cmd := ReserveInventoryCommand{Items: []InventoryItem{{ItemID: uuid.New(), Quantity: 3}}}
+
+	ev, err := NewEvent(EventReserveInventory, uuid.New(), uuid.New(), cmd)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	decoded, err := DecodePayload[ReserveInventoryCommand](ev)
+	if err != nil {
+		t.Fatalf("DecodePayload() failed: %v", err)
+	}
+
+	if len(decoded.Items) != 1 || decoded.Items[0] != cmd.Items[0] {
+		t.Errorf("Expected items %+v, got %+v", cmd.Items, decoded.Items)
+	}
+}
+
+func TestDecodePayloadRejectsMismatches(t *testing.T) {
+	reply, err := NewEvent(EventPaymentProcessed, uuid.New(), uuid.New(), PaymentReply{Success: true, PaymentID: "pay-1"})
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	if _, err := DecodePayload[InventoryReply](reply); !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("Expected a type mismatch for the wrong target, got %v", err)
+	}
+
+	reply.Event = EventType("ORDER_SHIPPED")
+
+	if _, err := DecodePayload[InventoryReply](reply); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("Expected an unknown event type, got %v", err)
+	}
+}
+
+func TestDecodePayloadIgnoresUnknownFields(t *testing.T) {
+	// A producer deployed ahead of this consumer already sends a field it does not know
+	ev := Event{
+		Event:   EventVoidAuthorization,
+		Payload: []byte(`{"payment_id":"pay-1","reason":"customer cancelled"}`),
+	}
+
+	cmd, err := DecodePayload[VoidAuthorizationCommand](ev)
+	if err != nil {
+		t.Fatalf("DecodePayload() failed: %v", err)
+	}
+
+	if cmd.PaymentID != "pay-1" {
+		t.Errorf("Expected payment ID pay-1, got %q", cmd.PaymentID)
+	}
+}
+
+func TestDecodePayloadRequiresFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   EventType
+		payload string
+		decode  func(Event) error
+	}{
+		{
+			name:    "capture without payment ID",
+			event:   EventCapturePayment,
+			payload: `{"amount":{"amount":"10.00","currency":"USD"}}`,
+			decode:  func(ev Event) error { _, err := DecodePayload[CapturePaymentCommand](ev); return err },
+		},
+		{
+			name:    "reservation without items",
+			event:   EventReserveInventory,
+			payload: `{"items":[]}`,
+			decode:  func(ev Event) error { _, err := DecodePayload[ReserveInventoryCommand](ev); return err },
+		},
+		{
+			name:    "payment reply relabelled as an order",
+			event:   EventOrderCreated,
+			payload: `{"success":true,"payment_id":"pay-1"}`,
+			decode:  func(ev Event) error { _, err := DecodePayload[OrderCreatedEvent](ev); return err },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.decode(Event{Event: tt.event, Payload: []byte(tt.payload)})
+			if !errors.Is(err, ErrIncompletePayload) {
+				t.Errorf("Expected ErrIncompletePayload, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// ErrRejected marks deliveries that will never succeed, like an invalid address or a webhook
+// answering with a client error. Anything else is treated as temporary
+var ErrRejected = errors.New("notification rejected")
+
+// Channel delivers rendered messages to customers
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogChannel writes messages to w, for local runs and as a record of what was sent
+type LogChannel struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogChannel(w io.Writer) *LogChannel {
+	return &LogChannel{w: w}
+}
+
+func (c *LogChannel) Name() string {
+	return "log"
+}
+
+func (c *LogChannel) Send(ctx context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := fmt.Fprintf(c.w, "[%s] to %s, order %s: %s\n%s", msg.Kind, msg.CustomerID, msg.OrderID, msg.Subject, msg.Body)
+
+	return err
+}
+
+// WebhookChannel posts messages as JSON to a URL
+type WebhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookChannel(url string, client *http.Client) *WebhookChannel {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &WebhookChannel{url: url, client: client}
+}
+
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, msg Message) error {
+	body, err := sonic.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: webhook answered %s", ErrRejected, resp.Status)
+	default:
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+}
+
+// EmailChannel sends messages over SMTP. Customer IDs that are not email addresses are mapped
+// to an address in domain
+type EmailChannel struct {
+	addr   string
+	from   string
+	domain string
+	auth   smtp.Auth
+}
+
+// NewEmailChannel creates a channel for the SMTP server at addr (host:port). auth may be nil for
+// servers that accept unauthenticated mail
+func NewEmailChannel(addr, from, domain string, auth smtp.Auth) *EmailChannel {
+	return &EmailChannel{addr: addr, from: from, domain: domain, auth: auth}
+}
+
+func (c *EmailChannel) Name() string {
+	return "email"
+}
+
+func (c *EmailChannel) Send(ctx context.Context, msg Message) error {
+	to, err := c.recipient(msg.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return smtpError(err)
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	if c.auth != nil {
+		if err := client.Auth(c.auth); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	if err := client.Mail(c.from); err != nil {
+		return smtpError(err)
+	}
+
+	if err := client.Rcpt(to); err != nil {
+		return smtpError(err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+
+	if _, err := w.Write(c.compose(to, msg)); err != nil {
+		return smtpError(err)
+	}
+
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+
+	return smtpError(client.Quit())
+}
+
+func (c *EmailChannel) recipient(customerID string) (string, error) {
+	if strings.Contains(customerID, "@") {
+		return customerID, nil
+	}
+
+	if c.domain == "" {
+		return "", fmt.Errorf("%w: no email address for customer %s", ErrRejected, customerID)
+	}
+
+	return customerID + "@" + c.domain, nil
+}
+
+func (c *EmailChannel) compose(to string, msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", c.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return b.Bytes()
+}
+
+// smtpError marks permanent (5xx) SMTP replies as rejected, so a bad address is not retried forever
+func smtpError(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	return err
+}
@@ -0,0 +1,214 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// fakeSMTPServer accepts one mail per connection and hands the envelope and data to mails.
+// Recipients listed in reject are refused with a permanent error
+type fakeSMTPServer struct {
+	listener net.Listener
+	mails    chan fakeMail
+	reject   map[string]bool
+}
+
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTPServer(t *testing.T, reject ...string) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := &fakeSMTPServer{listener: listener, mails: make(chan fakeMail, 10), reject: make(map[string]bool)}
+	for _, addr := range reject {
+		s.reject[addr] = true
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	var mail fakeMail
+
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 fake")
+		case "MAIL":
+			mail.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>")
+			if s.reject[to] {
+				reply("550 no such user")
+				continue
+			}
+			mail.to = append(mail.to, to)
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+
+			mail.data = data.String()
+			s.mails <- mail
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func testMessage() Message {
+	return Message{
+		Kind:       models.NotificationOrderConfirmed,
+		CustomerID: "alice",
+		OrderID:    uuid.New(),
+		Subject:    "Your order is confirmed",
+		Body:       "Hi alice,\nthanks!\n",
+	}
+}
+
+func TestEmailChannelSendsThroughSMTP(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	channel := NewEmailChannel(server.listener.Addr().String(), "shop@example.com", "example.com", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := channel.Send(ctx, testMessage()); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	select {
+	case mail := <-server.mails:
+		if mail.from != "shop@example.com" {
+			t.Errorf("Expected sender shop@example.com, got %s", mail.from)
+		}
+		if len(mail.to) != 1 || mail.to[0] != "alice@example.com" {
+			t.Errorf("Expected recipient alice@example.com, got %v", mail.to)
+		}
+		if !strings.Contains(mail.data, "Subject: Your order is confirmed\r\n") || !strings.Contains(mail.data, "thanks!") {
+			t.Errorf("Unexpected mail data %q", mail.data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the fake server to receive a mail")
+	}
+}
+
+func TestEmailChannelRejectsPermanentFailures(t *testing.T) {
+	server := startFakeSMTPServer(t, "alice@example.com")
+	ctx := context.Background()
+
+	channel := NewEmailChannel(server.listener.Addr().String(), "shop@example.com", "example.com", nil)
+	if err := channel.Send(ctx, testMessage()); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected for a refused recipient, got %v", err)
+	}
+
+	noDomain := NewEmailChannel(server.listener.Addr().String(), "shop@example.com", "", nil)
+	if err := noDomain.Send(ctx, testMessage()); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected without an address, got %v", err)
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		expectErr    bool
+		expectReject bool
+	}{
+		{name: "accepted", status: http.StatusNoContent},
+		{name: "client error", status: http.StatusBadRequest, expectErr: true, expectReject: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, expectErr: true},
+		{name: "server error", status: http.StatusBadGateway, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received Message
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("Failed to decode webhook body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			msg := testMessage()
+			err := NewWebhookChannel(server.URL, server.Client()).Send(context.Background(), msg)
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+			if errors.Is(err, ErrRejected) != tt.expectReject {
+				t.Errorf("Expected rejected %v, got %v", tt.expectReject, err)
+			}
+			if received.OrderID != msg.OrderID || received.Subject != msg.Subject {
+				t.Errorf("Expected the message to be posted, got %+v", received)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// EventPublisher is the part of kafka.Producer the service needs to send replies
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// Service renders notification commands and delivers them through every configured channel
+type Service struct {
+	templates  *Templates
+	channels   []Channel
+	publisher  EventPublisher
+	replyTopic string
+	timeout    time.Duration
+}
+
+func NewService(templates *Templates, channels []Channel, publisher EventPublisher, replyTopic string, timeout time.Duration) *Service {
+	return &Service{
+		templates:  templates,
+		channels:   channels,
+		publisher:  publisher,
+		replyTopic: replyTopic,
+		timeout:    timeout,
+	}
+}
+
+// Routes returns the router for the notification command. Unknown kinds and rejected deliveries are
+// answered with a failure reply, while temporary delivery errors are returned so the record can
+// be retried. A retry delivers through every channel again, so channels are at least once
+func (s *Service) Routes() *kafka.Router {
+	r := kafka.NewCommandRouter()
+
+	kafka.Route(r, models.EventSendNotification, s.send)
+
+	return r
+}
+
+func (s *Service) send(ctx context.Context, ev models.Event, cmd models.SendNotificationCommand) error {
+	msg, err := s.templates.Render(cmd)
+	if err == nil {
+		err = s.deliver(ctx, msg)
+	}
+
+	return s.reply(ctx, ev, err)
+}
+
+func (s *Service) deliver(ctx context.Context, msg Message) error {
+	for _, channel := range s.channels {
+		sendCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := channel.Send(sendCtx, msg)
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("%s channel: %w", channel.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) reply(ctx context.Context, cmd models.Event, result error) error {
+	if result != nil && !isBusinessError(result) {
+		return result
+	}
+
+	eventType := models.EventNotificationSent
+	reply := models.NotificationReply{Success: true, Message: "ok"}
+
+	if result != nil {
+		eventType = models.EventNotificationFailed
+		reply = models.NotificationReply{Success: false, Message: result.Error()}
+	}
+
+	ev, err := models.NewEvent(eventType, cmd.SagaID, cmd.OrderID, reply)
+	if err != nil {
+		return err
+	}
+
+	if err := s.publisher.PublishEvent(ctx, s.replyTopic, []byte(cmd.SagaID.String()), ev); err != nil {
+		return err
+	}
+
+	log.Printf("%s for saga %s: %s", eventType, cmd.SagaID, reply.Message)
+
+	return nil
+}
+
+func isBusinessError(err error) bool {
+	return errors.Is(err, ErrUnknownKind) || errors.Is(err, ErrRejected)
+}
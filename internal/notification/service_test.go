@@ -0,0 +1,172 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type fakePublisher struct {
+	events []models.Event
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+type failingChannel struct {
+	err error
+}
+
+func (c failingChannel) Name() string {
+	return "failing"
+}
+
+func (c failingChannel) Send(ctx context.Context, msg Message) error {
+	return c.err
+}
+
+func mustTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := DefaultTemplates()
+	if err != nil {
+		t.Fatalf("DefaultTemplates() failed: %v", err)
+	}
+
+	return templates
+}
+
+func notify(t *testing.T, cmd models.SendNotificationCommand) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(models.EventSendNotification, uuid.New(), cmd.OrderID, cmd)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func TestTemplatesRenderEveryKind(t *testing.T) {
+	templates := mustTemplates(t)
+	orderID := uuid.New()
+	publicID := "US-7KQ3-9XMD"
+
+	tests := []struct {
+		kind     models.NotificationKind
+		subject  string
+		contains []string
+	}{
+		{models.NotificationOrderConfirmed, "is confirmed", []string{"42.50 USD will be charged", "gift wrapped"}},
+		{models.NotificationOrderCancelled, "was cancelled", []string{"(out of stock)", "payment hold has been released"}},
+		{models.NotificationRefundIssued, "Refund for order", []string{"42.50 USD has been refunded", "(out of stock)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			msg, err := templates.Render(models.SendNotificationCommand{
+				CustomerID: "alice",
+				OrderID:    orderID,
+				PublicID:   publicID,
+				Kind:       tt.kind,
+				Amount:     models.Money{Amount: 4250, Currency: "USD"},
+				Reason:     "out of stock",
+				Message:    "Your items will be gift wrapped",
+			})
+			if err != nil {
+				t.Fatalf("Render() failed: %v", err)
+			}
+
+			if !strings.Contains(msg.Subject, tt.subject) || !strings.Contains(msg.Subject, publicID) {
+				t.Errorf("Unexpected subject %q", msg.Subject)
+			}
+			if !strings.Contains(msg.Body, "order "+publicID) {
+				t.Errorf("Expected body to refer to order %s, got %q", publicID, msg.Body)
+			}
+			if strings.Contains(msg.Subject+msg.Body, orderID.String()) {
+				t.Errorf("Expected the internal order ID to stay out of the message, got %q", msg.Subject+msg.Body)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(msg.Body, s) {
+					t.Errorf("Expected body to contain %q, got %q", s, msg.Body)
+				}
+			}
+		})
+	}
+
+	if _, err := templates.Render(models.SendNotificationCommand{Kind: "BIRTHDAY"}); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Expected ErrUnknownKind, got %v", err)
+	}
+}
+
+func TestServiceDeliversAndReplies(t *testing.T) {
+	var out bytes.Buffer
+	publisher := &fakePublisher{}
+	handle := NewService(mustTemplates(t), []Channel{NewLogChannel(&out)}, publisher, "notification.replies", time.Second).Routes().HandleEvent
+
+	cmd := models.SendNotificationCommand{CustomerID: "alice", OrderID: uuid.New(), Kind: models.NotificationOrderConfirmed, Amount: models.Money{Amount: 1000, Currency: "USD"}}
+	if err := handle(context.Background(), notify(t, cmd)); err != nil {
+		t.Fatalf("handle() failed: %v", err)
+	}
+
+	if !strings.Contains(out.String(), cmd.OrderID.String()) {
+		t.Errorf("Expected the log channel to print the message, got %q", out.String())
+	}
+
+	if len(publisher.events) != 1 || publisher.events[0].Event != models.EventNotificationSent {
+		t.Fatalf("Expected NOTIFICATION_SENT, got %+v", publisher.events)
+	}
+
+	var reply models.NotificationReply
+	if err := sonic.Unmarshal(publisher.events[0].Payload, &reply); err != nil {
+		t.Fatalf("Failed to decode reply: %v", err)
+	}
+	if !reply.Success {
+		t.Errorf("Expected a successful reply, got %+v", reply)
+	}
+}
+
+func TestServiceFailureHandling(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        models.NotificationKind
+		channel     Channel
+		expectReply models.EventType
+	}{
+		{name: "unknown kind", kind: "BIRTHDAY", channel: NewLogChannel(&bytes.Buffer{}), expectReply: models.EventNotificationFailed},
+		{name: "rejected delivery", kind: models.NotificationOrderConfirmed, channel: failingChannel{err: ErrRejected}, expectReply: models.EventNotificationFailed},
+		{name: "temporary delivery error", kind: models.NotificationOrderConfirmed, channel: failingChannel{err: errors.New("connection refused")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &fakePublisher{}
+			handle := NewService(mustTemplates(t), []Channel{tt.channel}, publisher, "notification.replies", time.Second).Routes().HandleEvent
+
+			err := handle(context.Background(), notify(t, models.SendNotificationCommand{CustomerID: "alice", OrderID: uuid.New(), Kind: tt.kind}))
+
+			if tt.expectReply == "" {
+				if err == nil || len(publisher.events) != 0 {
+					t.Fatalf("Expected the error to be returned without a reply, got %v and %d replies", err, len(publisher.events))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("handle() failed: %v", err)
+			}
+			if len(publisher.events) != 1 || publisher.events[0].Event != tt.expectReply {
+				t.Errorf("Expected %s, got %+v", tt.expectReply, publisher.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+var ErrUnknownKind = errors.New("no template for notification kind")
+
+// Message is a rendered notification ready to be delivered
+type Message struct {
+	Kind       models.NotificationKind `json:"kind"`
+	CustomerID string                  `json:"customer_id"`
+	OrderID    uuid.UUID               `json:"order_id"`
+	// PublicID is the order ID the customer knows, the subject and body refer to this one
+	PublicID string `json:"public_id,omitempty"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+// Templates renders notifications with one text/template per kind. Every template file defines
+// a "subject" and a "body" template and is named after its kind, e.g. order_confirmed.tmpl
+type Templates struct {
+	byKind map[models.NotificationKind]*template.Template
+}
+
+// DefaultTemplates returns the templates shipped with the service
+func DefaultTemplates() (*Templates, error) {
+	sub, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTemplates(sub)
+}
+
+// ParseTemplates reads every *.tmpl file at the root of fsys
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{byKind: make(map[models.NotificationKind]*template.Template, len(files))}
+
+	for _, file := range files {
+		tmpl, err := template.New(file).Option("missingkey=error").ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+		}
+
+		for _, name := range []string{"subject", "body"} {
+			if tmpl.Lookup(name) == nil {
+				return nil, fmt.Errorf("template %s does not define %q", file, name)
+			}
+		}
+
+		kind := models.NotificationKind(strings.ToUpper(strings.TrimSuffix(path.Base(file), ".tmpl")))
+		t.byKind[kind] = tmpl
+	}
+
+	return t, nil
+}
+
+// Render builds the message for cmd from the template of its kind
+func (t *Templates) Render(cmd models.SendNotificationCommand) (Message, error) {
+	tmpl, ok := t.byKind[cmd.Kind]
+	if !ok {
+		return Message{}, fmt.Errorf("%w %q", ErrUnknownKind, cmd.Kind)
+	}
+
+	var subject, body bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&subject, "subject", cmd); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %w", cmd.Kind, err)
+	}
+
+	if err := tmpl.ExecuteTemplate(&body, "body", cmd); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s body: %w", cmd.Kind, err)
+	}
+
+	return Message{
+		Kind:       cmd.Kind,
+		CustomerID: cmd.CustomerID,
+		OrderID:    cmd.OrderID,
+		PublicID:   cmd.PublicID,
+		Subject:    strings.TrimSpace(subject.String()),
+		Body:       strings.TrimSpace(body.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,156 @@
+package order
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// orderResponse is an order together with its total
+type orderResponse struct {
+	*models.Order
+	Total models.Money `json:"total"`
+}
+
+func newOrderResponse(order *models.Order) (orderResponse, error) {
+	total, err := order.Total()
+	if err != nil {
+		return orderResponse{}, err
+	}
+
+	return orderResponse{Order: order, Total: total}, nil
+}
+
+// cancelOrderRequest is what a customer may send along with a cancellation
+type cancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// maxRequestBody bounds the size of a placed order
+const maxRequestBody = 1 << 20
+
+// NewHandler exposes the order API over HTTP:
+//
+//	POST /orders              place an order
+//	GET  /orders/{id}         an order with its status and items
+//	POST /orders/{id}/cancel  ask for an order to be cancelled
+//
+// {id} is either the UUID or the public ID of an order
+func NewHandler(s *Service) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		var req PlaceOrderRequest
+
+		if err := sonic.ConfigDefault.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		order, err := s.PlaceOrder(r.Context(), req)
+		switch {
+		case errors.Is(err, ErrInvalidOrder), errors.Is(err, ErrUnknownItem):
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, ErrPriceMismatch):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to place order: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to place order"})
+			return
+		}
+
+		resp, err := newOrderResponse(order)
+		if err != nil {
+			log.Printf("Failed to total order %s: %v", order.PublicID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to place order"})
+			return
+		}
+
+		w.Header().Set("Location", "/orders/"+order.PublicID)
+		writeJSON(w, http.StatusCreated, resp)
+	})
+
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		order, err := s.GetOrder(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, ErrInvalidPublicID):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, ErrOrderNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to get order: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get order"})
+			return
+		}
+
+		resp, err := newOrderResponse(order)
+		if err != nil {
+			log.Printf("Failed to total order %s: %v", order.PublicID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get order"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	mux.HandleFunc("POST /orders/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		// The body, and with it the reason, is optional
+		var req cancelOrderRequest
+
+		err := sonic.ConfigDefault.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+
+		order, err := s.CancelOrder(r.Context(), r.PathValue("id"), req.Reason)
+		switch {
+		case errors.Is(err, ErrInvalidPublicID):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, ErrOrderNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, ErrNotCancellable):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to cancel order: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to cancel order"})
+			return
+		}
+
+		resp, err := newOrderResponse(order)
+		if err != nil {
+			log.Printf("Failed to total order %s: %v", order.PublicID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to cancel order"})
+			return
+		}
+
+		// The saga cancels the order asynchronously, its status shows when it is done
+		writeJSON(w, http.StatusAccepted, resp)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	data, err := sonic.Marshal(body)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,481 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/fx"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+// memoryStore is an in-memory OrderStore over a fixed catalog, keeping queued messages in a slice
+type memoryStore struct {
+	mu       sync.Mutex
+	catalog  map[uuid.UUID]models.Item
+	orders   map[string]*models.Order
+	messages []outbox.Message
+	err      error
+	// collisions is how many more Creates fail with ErrPublicIDTaken
+	collisions int
+}
+
+func newMemoryStore(items ...models.Item) *memoryStore {
+	s := &memoryStore{catalog: make(map[uuid.UUID]models.Item), orders: make(map[string]*models.Order)}
+	for _, item := range items {
+		s.catalog[item.ID] = item
+	}
+
+	return s
+}
+
+func (s *memoryStore) Items(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]models.Item, error) {
+	result := make(map[uuid.UUID]models.Item)
+	for _, id := range ids {
+		if item, ok := s.catalog[id]; ok {
+			result[id] = item
+		}
+	}
+
+	return result, nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, order *models.Order, messages ...outbox.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.collisions > 0 {
+		s.collisions--
+		return ErrPublicIDTaken
+	}
+
+	if _, ok := s.orders[order.PublicID]; ok {
+		return ErrPublicIDTaken
+	}
+
+	copied := *order
+	s.orders[order.PublicID] = &copied
+	s.messages = append(s.messages, messages...)
+
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, order := range s.orders {
+		if order.ID == orderID {
+			copied := *order
+			return &copied, nil
+		}
+	}
+
+	return nil, ErrOrderNotFound
+}
+
+func (s *memoryStore) GetByPublicID(ctx context.Context, publicID string) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[publicID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	copied := *order
+
+	return &copied, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, orderID uuid.UUID, update func(order *models.Order) ([]outbox.Message, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, order := range s.orders {
+		if order.ID != orderID {
+			continue
+		}
+
+		// Like the postgres store, update sees the order without its history
+		locked := *order
+		locked.History = nil
+
+		messages, err := update(&locked)
+		if err != nil {
+			return err
+		}
+
+		order.Status, order.UpdatedAt = locked.Status, locked.UpdatedAt
+		order.History = append(order.History, locked.History...)
+		s.messages = append(s.messages, messages...)
+
+		return nil
+	}
+
+	return ErrOrderNotFound
+}
+
+func serve(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	return rec
+}
+
+var ratesAsOf = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestService places US orders priced in USD by default and quotes USD against EUR and JPY
+func newTestService(store OrderStore) *Service {
+	rates := fx.NewStaticProvider("USD", map[string]*big.Rat{"EUR": big.NewRat(92, 100), "JPY": big.NewRat(150, 1)}, ratesAsOf)
+
+	return NewService(store, "orders", &PublicIDGenerator{prefix: "US"}, rates, "USD", "USD")
+}
+
+var keyboard = models.Item{ID: uuid.MustParse("00000000-0000-0000-0000-00000000000a"), Name: "Keyboard", Price: models.Money{Amount: 4990, Currency: "USD"}, Stock: 10}
+
+func TestPlaceAndGetOrder(t *testing.T) {
+	store := newMemoryStore(keyboard)
+	handler := NewHandler(newTestService(store))
+
+	rec := serve(t, handler, http.MethodPost, "/orders",
+		`{"customer_id":"alice","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":2,"price":"49.90 USD"}]}`)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created orderResponse
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if created.Status != models.OrderPending || created.PublicID == "" || created.Total != (models.Money{Amount: 9980, Currency: "USD"}) {
+		t.Errorf("Unexpected order %+v", created)
+	}
+	if rec.Header().Get("Location") != "/orders/"+created.PublicID {
+		t.Errorf("Expected Location of the new order, got %q", rec.Header().Get("Location"))
+	}
+
+	if len(store.messages) != 1 || store.messages[0].Topic != "orders" || store.messages[0].Event.Event != models.EventOrderCreated {
+		t.Fatalf("Expected ORDER_CREATED queued for orders, got %+v", store.messages)
+	}
+
+	queued := store.messages[0]
+	if string(queued.Key) != queued.Event.SagaID.String() {
+		t.Errorf("Expected the message to be keyed by saga ID, got %q", queued.Key)
+	}
+
+	var event models.OrderCreatedEvent
+	if err := sonic.Unmarshal(queued.Event.Payload, &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if queued.Event.OrderID != created.ID || event.PublicID != created.PublicID || event.Amount != (models.Money{Amount: 9980, Currency: "USD"}) || len(event.Items) != 1 || event.Items[0].Quantity != 2 {
+		t.Errorf("Unexpected ORDER_CREATED %+v", event)
+	}
+
+	rec = serve(t, handler, http.MethodGet, "/orders/"+created.PublicID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var fetched orderResponse
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &fetched); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if fetched.ID != created.ID || len(fetched.Items) != 1 || fetched.Items[0].Price != (models.Money{Amount: 4990, Currency: "USD"}) {
+		t.Errorf("Unexpected order %+v", fetched)
+	}
+
+	// Customers may read the ID back in lower case and without dashes
+	rec = serve(t, handler, http.MethodGet, "/orders/"+strings.ToLower(strings.ReplaceAll(created.PublicID, "-", "")), "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a loosely typed public ID, got %d", rec.Code)
+	}
+
+	rec = serve(t, handler, http.MethodGet, "/orders/"+created.ID.String(), "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 looking the order up by UUID, got %d", rec.Code)
+	}
+
+	missing := (&PublicIDGenerator{prefix: "US"}).Generate()
+	if rec := serve(t, handler, http.MethodGet, "/orders/"+missing, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown order, got %d", rec.Code)
+	}
+
+	if rec := serve(t, handler, http.MethodGet, "/orders/"+uuid.NewString(), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown UUID, got %d", rec.Code)
+	}
+
+	if rec := serve(t, handler, http.MethodGet, "/orders/NOPE", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed public ID, got %d", rec.Code)
+	}
+}
+
+func TestPlaceOrderValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectStatus int
+	}{
+		{name: "malformed", body: `{"customer_id":`, expectStatus: http.StatusBadRequest},
+		{name: "no customer", body: `{"items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":1}]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "no items", body: `{"customer_id":"alice","items":[]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "zero quantity", body: `{"customer_id":"alice","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":0}]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "unknown item", body: `{"customer_id":"alice","items":[{"item_id":"00000000-0000-0000-0000-0000000000ff","quantity":1}]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "unsupported currency", body: `{"customer_id":"alice","currency":"BRL","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":1}]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "unknown currency", body: `{"customer_id":"alice","currency":"XYZ","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":1}]}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "stale converted price", body: `{"customer_id":"alice","currency":"EUR","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":1,"price":"49.90 EUR"}]}`, expectStatus: http.StatusConflict},
+		{name: "stale price", body: `{"customer_id":"alice","items":[{"item_id":"00000000-0000-0000-0000-00000000000a","quantity":1,"price":{"amount":"39.90","currency":"USD"}}]}`, expectStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(keyboard)
+			handler := NewHandler(newTestService(store))
+
+			rec := serve(t, handler, http.MethodPost, "/orders", tt.body)
+			if rec.Code != tt.expectStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+			if len(store.messages) != 0 {
+				t.Errorf("Expected no saga to be started, got %d messages", len(store.messages))
+			}
+		})
+	}
+}
+
+func TestPlaceOrderInCustomerCurrency(t *testing.T) {
+	tests := []struct {
+		name         string
+		currency     string
+		expectPrice  models.Money
+		expectAmount models.Money
+	}{
+		{name: "EUR", currency: "eur", expectPrice: models.Money{Amount: 4591, Currency: "EUR"}, expectAmount: models.Money{Amount: 9182, Currency: "EUR"}},
+		{name: "JPY has no minor unit", currency: "JPY", expectPrice: models.Money{Amount: 7485, Currency: "JPY"}, expectAmount: models.Money{Amount: 14970, Currency: "JPY"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(keyboard)
+
+			order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+				CustomerID: "alice",
+				Currency:   tt.currency,
+				Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 2}},
+			})
+			if err != nil {
+				t.Fatalf("Failed to place order: %v", err)
+			}
+
+			if order.Currency != tt.expectPrice.Currency || order.Items[0].Price != tt.expectPrice {
+				t.Errorf("Expected items priced at %s, got %+v", tt.expectPrice, order)
+			}
+			if order.FXRate == nil || order.FXRate.Base != "USD" || order.FXRate.Quote != tt.expectPrice.Currency || !order.FXRate.AsOf.Equal(ratesAsOf) {
+				t.Errorf("Expected the USD/%s rate frozen on the order, got %+v", tt.expectPrice.Currency, order.FXRate)
+			}
+
+			event, err := models.DecodePayload[models.OrderCreatedEvent](store.messages[0].Event)
+			if err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			if event.Amount != tt.expectAmount || event.FXRate == nil || *event.FXRate != *order.FXRate {
+				t.Errorf("Expected ORDER_CREATED for %s with the order rate, got %+v", tt.expectAmount, event)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderInBaseCurrencyHasNoRate(t *testing.T) {
+	store := newMemoryStore(keyboard)
+
+	order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+		CustomerID: "alice",
+		Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to place order: %v", err)
+	}
+
+	if order.Currency != "USD" || order.FXRate != nil {
+		t.Errorf("Expected a USD order without a rate, got %s %+v", order.Currency, order.FXRate)
+	}
+}
+
+func TestPlaceOrderRetriesTakenPublicID(t *testing.T) {
+	tests := []struct {
+		name       string
+		collisions int
+		expectErr  bool
+	}{
+		{name: "one collision", collisions: 1},
+		{name: "every attempt collides", collisions: maxPublicIDAttempts, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(keyboard)
+			store.collisions = tt.collisions
+
+			order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+				CustomerID: "alice",
+				Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+			})
+			if tt.expectErr {
+				if !errors.Is(err, ErrPublicIDTaken) {
+					t.Errorf("Expected ErrPublicIDTaken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to place order: %v", err)
+			}
+
+			if _, ok := store.orders[order.PublicID]; !ok || len(store.messages) != 1 {
+				t.Fatalf("Expected the order stored once under %s, got %d orders and %d messages", order.PublicID, len(store.orders), len(store.messages))
+			}
+
+			event, err := models.DecodePayload[models.OrderCreatedEvent](store.messages[0].Event)
+			if err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			if event.PublicID != order.PublicID {
+				t.Errorf("Expected ORDER_CREATED for %s, got %s", order.PublicID, event.PublicID)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderFailsWithoutStartingSaga(t *testing.T) {
+	store := newMemoryStore(keyboard)
+	store.err = errors.New("connection refused")
+
+	_, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+		CustomerID: "alice",
+		Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+	})
+	if err == nil {
+		t.Fatalf("Expected the store error to be returned")
+	}
+
+	if len(store.orders) != 0 || len(store.messages) != 0 {
+		t.Errorf("Expected neither order nor event to be stored, got %d and %d", len(store.orders), len(store.messages))
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectReason string
+	}{
+		{name: "with reason", body: `{"reason":"changed my mind"}`, expectReason: "changed my mind"},
+		{name: "without body", body: "", expectReason: "cancelled by customer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(keyboard)
+			handler := NewHandler(newTestService(store))
+
+			order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+				CustomerID: "alice",
+				Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+			})
+			if err != nil {
+				t.Fatalf("Failed to place order: %v", err)
+			}
+
+			rec := serve(t, handler, http.MethodPost, "/orders/"+order.PublicID+"/cancel", tt.body)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			if len(store.messages) != 2 {
+				t.Fatalf("Expected ORDER_CREATED and CANCEL_ORDER queued, got %d messages", len(store.messages))
+			}
+
+			created, cancel := store.messages[0], store.messages[1]
+			if cancel.Topic != "orders" || cancel.Event.Event != models.EventCancelOrder || string(cancel.Key) != string(created.Key) || cancel.Event.SagaID != created.Event.SagaID {
+				t.Errorf("Expected CANCEL_ORDER for the saga of the order on orders, got %+v", cancel)
+			}
+
+			command, err := models.DecodePayload[models.CancelOrderCommand](cancel.Event)
+			if err != nil {
+				t.Fatalf("Failed to decode command: %v", err)
+			}
+			if command.Reason != tt.expectReason {
+				t.Errorf("Expected reason %q, got %q", tt.expectReason, command.Reason)
+			}
+
+			// The saga cancels the order, the request alone leaves it as it was
+			if stored, _ := store.GetByPublicID(context.Background(), order.PublicID); stored.Status != models.OrderPending {
+				t.Errorf("Expected the order to stay PENDING, got %s", stored.Status)
+			}
+		})
+	}
+}
+
+func TestCancelOrderRejected(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       models.OrderStatus
+		path         string
+		body         string
+		expectStatus int
+	}{
+		{name: "capturing payment", status: models.OrderFinalizing, expectStatus: http.StatusConflict},
+		{name: "completed", status: models.OrderCompleted, expectStatus: http.StatusConflict},
+		{name: "already cancelled", status: models.OrderCancelled, expectStatus: http.StatusConflict},
+		{name: "failed", status: models.OrderFailed, expectStatus: http.StatusConflict},
+		{name: "unknown order", status: models.OrderPending, path: "/orders/" + uuid.NewString() + "/cancel", expectStatus: http.StatusNotFound},
+		{name: "malformed public ID", status: models.OrderPending, path: "/orders/NOPE/cancel", expectStatus: http.StatusBadRequest},
+		{name: "malformed body", status: models.OrderPending, body: `{"reason":`, expectStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(keyboard)
+			handler := NewHandler(newTestService(store))
+
+			order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+				CustomerID: "alice",
+				Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+			})
+			if err != nil {
+				t.Fatalf("Failed to place order: %v", err)
+			}
+
+			store.orders[order.PublicID].Status = tt.status
+
+			path := tt.path
+			if path == "" {
+				path = "/orders/" + order.PublicID + "/cancel"
+			}
+
+			rec := serve(t, handler, http.MethodPost, path, tt.body)
+			if rec.Code != tt.expectStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+			if len(store.messages) != 1 {
+				t.Errorf("Expected no CANCEL_ORDER to be queued, got %d messages", len(store.messages))
+			}
+		})
+	}
+}
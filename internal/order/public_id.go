@@ -0,0 +1,120 @@
+package order
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPublicID = errors.New("invalid public ID")
+
+// publicIDAlphabet is Crockford's base32: it leaves out I, L, O and U, so no character can be
+// mistaken for another when an ID is read over the phone
+const publicIDAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	// publicIDRandomChars gives 35 random bits per region. Collisions are retried, see PlaceOrder
+	publicIDRandomChars = 7
+	// publicIDCodeChars are the random characters followed by the check character
+	publicIDCodeChars = publicIDRandomChars + 1
+)
+
+// PublicIDGenerator generates the IDs customers quote for their orders, e.g. BR-7KQ3-9XMD: the
+// region, seven random characters and a check character that catches any single mistyped
+// character and most swapped neighbours
+type PublicIDGenerator struct {
+	prefix string
+}
+
+// NewPublicIDGenerator prefixes IDs with region, which must be letters and digits
+func NewPublicIDGenerator(region string) (*PublicIDGenerator, error) {
+	prefix := strings.ToUpper(strings.TrimSpace(region))
+
+	if prefix == "" || strings.IndexFunc(prefix, func(r rune) bool { return (r < 'A' || r > 'Z') && (r < '0' || r > '9') }) >= 0 {
+		return nil, fmt.Errorf("region %q cannot prefix public IDs, it must be letters and digits", region)
+	}
+
+	return &PublicIDGenerator{prefix: prefix}, nil
+}
+
+// Generate returns a new random ID
+func (g *PublicIDGenerator) Generate() string {
+	b := make([]byte, publicIDRandomChars)
+	rand.Read(b)
+
+	code := make([]byte, 0, publicIDCodeChars)
+	for _, v := range b {
+		// 256 is a multiple of 32, so every character is equally likely
+		code = append(code, publicIDAlphabet[v%32])
+	}
+
+	code = append(code, publicIDAlphabet[checkDigit(code)])
+
+	return formatPublicID(g.prefix, string(code))
+}
+
+// NormalizePublicID turns an ID as a customer typed or read it into the form it is stored in.
+// Case, spaces and dashes do not matter, and O, I and L are read as 0, 1 and 1. IDs that are
+// malformed or fail the check character return ErrInvalidPublicID
+func NormalizePublicID(id string) (string, error) {
+	compact := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(id))
+
+	if len(compact) <= publicIDCodeChars {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPublicID, id)
+	}
+
+	prefix, raw := compact[:len(compact)-publicIDCodeChars], compact[len(compact)-publicIDCodeChars:]
+
+	code := make([]byte, 0, publicIDCodeChars)
+	for i := 0; i < len(raw); i++ {
+		v, ok := publicIDValue(raw[i])
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPublicID, id)
+		}
+
+		code = append(code, publicIDAlphabet[v])
+	}
+
+	if code[publicIDRandomChars] != publicIDAlphabet[checkDigit(code[:publicIDRandomChars])] {
+		return "", fmt.Errorf("%w: %q fails its check character", ErrInvalidPublicID, id)
+	}
+
+	return formatPublicID(prefix, string(code)), nil
+}
+
+func formatPublicID(prefix, code string) string {
+	return prefix + "-" + code[:4] + "-" + code[4:]
+}
+
+// publicIDValue returns the value of c in publicIDAlphabet, reading the letters it leaves out
+// as the digits they look like
+func publicIDValue(c byte) (int, bool) {
+	switch c {
+	case 'O':
+		return 0, true
+	case 'I', 'L':
+		return 1, true
+	}
+
+	i := strings.IndexByte(publicIDAlphabet, c)
+
+	return i, i >= 0
+}
+
+// checkDigit computes the Luhn mod 32 check value of code, whose characters must be in
+// publicIDAlphabet
+func checkDigit(code []byte) int {
+	const n = len(publicIDAlphabet)
+
+	sum, factor := 0, 2
+
+	for i := len(code) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(publicIDAlphabet, code[i])
+		sum += addend/n + addend%n
+
+		factor = 3 - factor
+	}
+
+	return (n - sum%n) % n
+}
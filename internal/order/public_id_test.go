@@ -0,0 +1,106 @@
+package order
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPublicIDGenerator(t *testing.T) {
+	gen, err := NewPublicIDGenerator(" br ")
+	if err != nil {
+		t.Fatalf("NewPublicIDGenerator() failed: %v", err)
+	}
+
+	format := regexp.MustCompile(`^BR-[0-9A-HJKMNP-TV-Z]{4}-[0-9A-HJKMNP-TV-Z]{4}$`)
+	seen := make(map[string]bool)
+
+	for range 1000 {
+		id := gen.Generate()
+
+		if !format.MatchString(id) {
+			t.Fatalf("Expected an ID like BR-7KQ3-9XMD, got %s", id)
+		}
+
+		if normalized, err := NormalizePublicID(id); err != nil || normalized != id {
+			t.Fatalf("Expected %s to pass its own check, got %s (%v)", id, normalized, err)
+		}
+
+		if seen[id] {
+			t.Fatalf("Expected 1000 distinct IDs, %s came up twice", id)
+		}
+		seen[id] = true
+	}
+
+	for _, region := range []string{"", "us-east", "BR!"} {
+		if _, err := NewPublicIDGenerator(region); err == nil {
+			t.Errorf("Expected region %q to be refused", region)
+		}
+	}
+}
+
+func TestNormalizePublicID(t *testing.T) {
+	code := []byte("0110ABC")
+	id := formatPublicID("BR", string(append(code, publicIDAlphabet[checkDigit(code)])))
+
+	// The same ID spelled with the letters customers confuse with 0 and 1
+	confusable := "BR-OIL0-" + id[len(id)-4:]
+
+	tests := []struct {
+		name      string
+		input     string
+		expect    string
+		expectErr bool
+	}{
+		{name: "canonical", input: id, expect: id},
+		{name: "lower case without dashes", input: strings.ToLower(strings.ReplaceAll(id, "-", "")), expect: id},
+		{name: "spaces", input: strings.ReplaceAll(id, "-", " "), expect: id},
+		{name: "confusable letters", input: confusable, expect: id},
+		{name: "too short", input: "BR-7KQ3", expectErr: true},
+		{name: "no region", input: strings.TrimPrefix(id, "BR-"), expectErr: true},
+		{name: "character outside the alphabet", input: id[:len(id)-1] + "U", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := NormalizePublicID(tt.input)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidPublicID) {
+					t.Errorf("Expected ErrInvalidPublicID, got %s (%v)", normalized, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizePublicID() failed: %v", err)
+			}
+
+			if normalized != tt.expect {
+				t.Errorf("Expected %s, got %s", tt.expect, normalized)
+			}
+		})
+	}
+}
+
+func TestPublicIDCheckCharacterCatchesTypos(t *testing.T) {
+	gen := &PublicIDGenerator{prefix: "BR"}
+
+	for range 100 {
+		id := gen.Generate()
+		code := []byte(strings.ReplaceAll(strings.TrimPrefix(id, "BR-"), "-", ""))
+
+		for i := range code {
+			for j := 0; j < len(publicIDAlphabet); j++ {
+				typo := append([]byte(nil), code...)
+				if typo[i] == publicIDAlphabet[j] {
+					continue
+				}
+				typo[i] = publicIDAlphabet[j]
+
+				if _, err := NormalizePublicID("BR" + string(typo)); !errors.Is(err, ErrInvalidPublicID) {
+					t.Fatalf("Expected %s mistyped as BR%s to be caught, got %v", id, typo, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/fx"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+var (
+	ErrInvalidOrder   = errors.New("invalid order")
+	ErrUnknownItem    = errors.New("unknown item")
+	ErrPriceMismatch  = errors.New("item price changed")
+	ErrNotCancellable = errors.New("order can no longer be cancelled")
+)
+
+// maxPublicIDAttempts bounds how often an order is stored with a fresh public ID after a collision
+const maxPublicIDAttempts = 3
+
+// PlaceOrderRequest is what a customer sends to place an order. Currency is the one the customer
+// pays in, the service default when empty
+type PlaceOrderRequest struct {
+	CustomerID string           `json:"customer_id"`
+	Currency   string           `json:"currency,omitempty"`
+	Items      []PlaceOrderItem `json:"items"`
+}
+
+// PlaceOrderItem is one line of an order. Price is optional: when given it is the price the
+// customer saw, in the order currency, and the order is refused if the converted catalog price
+// differs
+type PlaceOrderItem struct {
+	ItemID   uuid.UUID     `json:"item_id"`
+	Quantity int           `json:"quantity"`
+	Price    *models.Money `json:"price,omitempty"`
+}
+
+// Service places orders and starts their sagas
+type Service struct {
+	store           OrderStore
+	topic           string
+	ids             *PublicIDGenerator
+	rates           fx.Provider
+	baseCurrency    string
+	defaultCurrency string
+}
+
+// NewService starts sagas by queueing ORDER_CREATED for topic in the outbox and identifies orders
+// to customers with IDs from ids. Catalog prices are in baseCurrency and converted with rates into
+// the currency of each order, defaultCurrency when the customer does not pick one
+func NewService(store OrderStore, topic string, ids *PublicIDGenerator, rates fx.Provider, baseCurrency, defaultCurrency string) *Service {
+	return &Service{
+		store:           store,
+		topic:           topic,
+		ids:             ids,
+		rates:           rates,
+		baseCurrency:    baseCurrency,
+		defaultCurrency: defaultCurrency,
+	}
+}
+
+// PlaceOrder prices the request from the item catalog, converted into the order currency, and
+// stores the order as PENDING together with the ORDER_CREATED event that starts its saga, so
+// neither exists without the other. The rate used is frozen on the order, so every amount of
+// the saga derives from the same one
+func (s *Service) PlaceOrder(ctx context.Context, req PlaceOrderRequest) (*models.Order, error) {
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	rate, err := s.rate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.Items))
+	for _, item := range req.Items {
+		ids = append(ids, item.ItemID)
+	}
+
+	catalog, err := s.store.Items(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	order := &models.Order{
+		ID:         uuid.New(),
+		PublicID:   s.ids.Generate(),
+		SagaID:     uuid.New(),
+		CustomerID: req.CustomerID,
+		Currency:   currency,
+		FXRate:     rate,
+		Status:     models.OrderPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	for _, line := range req.Items {
+		item, ok := catalog[line.ItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownItem, line.ItemID)
+		}
+
+		if item.Price.Currency != s.baseCurrency {
+			return nil, fmt.Errorf("item %s is priced in %s, not the base currency %s", item.ID, item.Price.Currency, s.baseCurrency)
+		}
+
+		price := item.Price
+		if rate != nil {
+			if price, err = rate.Convert(item.Price); err != nil {
+				return nil, err
+			}
+		}
+
+		if line.Price != nil && *line.Price != price {
+			return nil, fmt.Errorf("%w: %s costs %s, not %s", ErrPriceMismatch, item.ID, price, *line.Price)
+		}
+
+		order.Items = append(order.Items, models.OrderItem{
+			ID:       uuid.New(),
+			OrderID:  order.ID,
+			ItemID:   item.ID,
+			Quantity: line.Quantity,
+			Price:    price,
+		})
+	}
+
+	total, err := order.Total()
+	if err != nil {
+		return nil, err
+	}
+
+	// A public ID is random, so the rare collision is settled by drawing another one
+	for attempt := 1; ; attempt++ {
+		created, err := s.createdMessage(order, total)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.store.Create(ctx, order, created)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, ErrPublicIDTaken) || attempt == maxPublicIDAttempts {
+			return nil, err
+		}
+
+		order.PublicID = s.ids.Generate()
+	}
+
+	log.Printf("Order %s placed by %s", order.PublicID, order.CustomerID)
+
+	return order, nil
+}
+
+// GetOrder returns the order with id, its UUID or its public ID, or ErrOrderNotFound. Public IDs
+// that fail their check character return ErrInvalidPublicID
+func (s *Service) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	if orderID, err := uuid.Parse(id); err == nil {
+		return s.store.Get(ctx, orderID)
+	}
+
+	publicID, err := NormalizePublicID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.GetByPublicID(ctx, publicID)
+}
+
+// CancelOrder asks the saga of the order with id, as in GetOrder, to stop and undo what it did, which ends
+// with the order CANCELLED. Orders that are FINALIZING or already COMPLETED, CANCELLED or FAILED
+// return ErrNotCancellable. The saga may still reach its pivot before it sees the request, in which
+// case the order goes on to complete
+func (s *Service) CancelOrder(ctx context.Context, id, reason string) (*models.Order, error) {
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason = strings.TrimSpace(reason); reason == "" {
+		reason = "cancelled by customer"
+	}
+
+	// Checked under the row lock the orchestrator takes to move the order, so an order it just
+	// finished or started charging is never cancelled
+	err = s.store.Update(ctx, order.ID, func(locked *models.Order) ([]outbox.Message, error) {
+		if !locked.Status.IsCancellable() {
+			return nil, fmt.Errorf("%w: %s is %s", ErrNotCancellable, locked.PublicID, locked.Status)
+		}
+
+		ev, err := models.NewEvent(models.EventCancelOrder, locked.SagaID, locked.ID, models.CancelOrderCommand{Reason: reason})
+		if err != nil {
+			return nil, err
+		}
+
+		// Keyed like ORDER_CREATED, so the orchestrator never sees the cancellation before the order
+		return []outbox.Message{{Topic: s.topic, Key: []byte(locked.SagaID.String()), Event: ev}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Cancellation of order %s requested: %s", order.PublicID, reason)
+
+	return order, nil
+}
+
+func (s *Service) createdMessage(order *models.Order, total models.Money) (outbox.Message, error) {
+	items := make([]models.InventoryItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, models.InventoryItem{ItemID: item.ItemID, Quantity: item.Quantity})
+	}
+
+	ev, err := models.NewEvent(models.EventOrderCreated, order.SagaID, order.ID, models.OrderCreatedEvent{
+		PublicID:   order.PublicID,
+		CustomerID: order.CustomerID,
+		Items:      items,
+		Amount:     total,
+		FXRate:     order.FXRate,
+	})
+	if err != nil {
+		return outbox.Message{}, err
+	}
+
+	return outbox.Message{Topic: s.topic, Key: []byte(order.SagaID.String()), Event: ev}, nil
+}
+
+// rate returns the rate from the base currency into currency, nil when they are the same
+func (s *Service) rate(ctx context.Context, currency string) (*models.ExchangeRate, error) {
+	if currency == s.baseCurrency {
+		return nil, nil
+	}
+
+	rate, err := s.rates.Rate(ctx, s.baseCurrency, currency)
+	if errors.Is(err, fx.ErrUnsupportedPair) || errors.Is(err, models.ErrUnknownCurrency) {
+		return nil, fmt.Errorf("%w: currency %s is not supported", ErrInvalidOrder, currency)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s/%s rate: %w", s.baseCurrency, currency, err)
+	}
+
+	return &rate, nil
+}
+
+func validate(req PlaceOrderRequest) error {
+	if strings.TrimSpace(req.CustomerID) == "" {
+		return fmt.Errorf("%w: customer_id is required", ErrInvalidOrder)
+	}
+
+	if len(req.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+
+	for _, item := range req.Items {
+		if item.ItemID == uuid.Nil {
+			return fmt.Errorf("%w: item_id is required", ErrInvalidOrder)
+		}
+
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: quantity of %s must be positive", ErrInvalidOrder, item.ItemID)
+		}
+	}
+
+	return nil
+}
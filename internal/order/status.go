@@ -0,0 +1,54 @@
+package order
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+// StatusUpdater moves orders through their statuses, announcing every change
+type StatusUpdater struct {
+	store OrderStore
+	topic string
+}
+
+// NewStatusUpdater queues ORDER_STATUS_CHANGED for topic in the outbox with every change
+func NewStatusUpdater(store OrderStore, topic string) *StatusUpdater {
+	return &StatusUpdater{
+		store: store,
+		topic: topic,
+	}
+}
+
+// Transition moves the order to status to on behalf of the saga sagaID, recording reason in its
+// history. An order already in status to is left alone, so a redelivered saga reply can drive
+// the same transition again. Illegal moves fail with models.ErrInvalidTransition
+func (u *StatusUpdater) Transition(ctx context.Context, sagaID, orderID uuid.UUID, to models.OrderStatus, reason string) error {
+	return u.store.Update(ctx, orderID, func(order *models.Order) ([]outbox.Message, error) {
+		if order.Status == to {
+			return nil, nil
+		}
+
+		if err := order.Transition(to, reason); err != nil {
+			return nil, err
+		}
+
+		change := order.History[len(order.History)-1]
+
+		ev, err := models.NewEvent(models.EventOrderStatusChanged, sagaID, order.ID, models.OrderStatusChangedEvent{
+			PublicID:  order.PublicID,
+			From:      change.From,
+			To:        change.To,
+			Reason:    change.Reason,
+			ChangedAt: change.ChangedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Keyed by order, so the changes of one order are read in the order they happened
+		return []outbox.Message{{Topic: u.topic, Key: []byte(order.ID.String()), Event: ev}}, nil
+	})
+}
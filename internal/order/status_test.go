@@ -0,0 +1,71 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+func TestStatusUpdaterTransition(t *testing.T) {
+	store := newMemoryStore(keyboard)
+
+	order, err := newTestService(store).PlaceOrder(context.Background(), PlaceOrderRequest{
+		CustomerID: "alice",
+		Items:      []PlaceOrderItem{{ItemID: keyboard.ID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to place order: %v", err)
+	}
+
+	store.messages = nil
+	updater := NewStatusUpdater(store, "order.events")
+	sagaID := uuid.New()
+
+	steps := []struct {
+		to           models.OrderStatus
+		expectErr    error
+		expectEvents int
+	}{
+		{to: models.OrderProcessing, expectEvents: 1},
+		{to: models.OrderProcessing, expectEvents: 1},
+		{to: models.OrderPending, expectErr: models.ErrInvalidTransition, expectEvents: 1},
+		{to: models.OrderCompleted, expectEvents: 2},
+		{to: models.OrderCancelled, expectErr: models.ErrInvalidTransition, expectEvents: 2},
+	}
+
+	for _, step := range steps {
+		err := updater.Transition(context.Background(), sagaID, order.ID, step.to, "step "+string(step.to))
+		if !errors.Is(err, step.expectErr) {
+			t.Errorf("Expected %v moving to %s, got %v", step.expectErr, step.to, err)
+		}
+
+		if len(store.messages) != step.expectEvents {
+			t.Errorf("Expected %d events after moving to %s, got %d", step.expectEvents, step.to, len(store.messages))
+		}
+	}
+
+	stored, err := store.GetByPublicID(context.Background(), order.PublicID)
+	if err != nil {
+		t.Fatalf("GetByPublicID() failed: %v", err)
+	}
+
+	if stored.Status != models.OrderCompleted || len(stored.History) != 2 || stored.History[1].From != models.OrderProcessing {
+		t.Errorf("Expected a COMPLETED order with two history entries, got %s %+v", stored.Status, stored.History)
+	}
+
+	msg := store.messages[1]
+	if msg.Topic != "order.events" || string(msg.Key) != order.ID.String() || msg.Event.SagaID != sagaID {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+
+	changed, err := models.DecodePayload[models.OrderStatusChangedEvent](msg.Event)
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if changed.PublicID != order.PublicID || changed.From != models.OrderProcessing || changed.To != models.OrderCompleted || changed.Reason != "step COMPLETED" {
+		t.Errorf("Unexpected ORDER_STATUS_CHANGED %+v", changed)
+	}
+}
@@ -0,0 +1,258 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrPublicIDTaken = errors.New("public ID already taken")
+)
+
+// OrderStore persists orders and reads the item catalog they are priced from
+type OrderStore interface {
+	// Items returns the catalog entries for ids, leaving out the ones that do not exist
+	Items(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]models.Item, error)
+	// Create stores the order together with its items, and queues messages in the outbox in
+	// the same transaction. It returns ErrPublicIDTaken when another order has its public ID
+	Create(ctx context.Context, order *models.Order, messages ...outbox.Message) error
+	// Get returns the order with its items, or ErrOrderNotFound
+	Get(ctx context.Context, orderID uuid.UUID) (*models.Order, error)
+	// GetByPublicID returns the order with its items, or ErrOrderNotFound
+	GetByPublicID(ctx context.Context, publicID string) (*models.Order, error)
+	// Update locks the order, without its items and history, and hands it to update. The status
+	// and the history entries update records are stored together with the messages it returns
+	Update(ctx context.Context, orderID uuid.UUID, update func(order *models.Order) ([]outbox.Message, error)) error
+}
+
+// PostgresStore keeps orders in the orders and order_items tables
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Items(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]models.Item, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, description, price::text || ' ' || currency, stock FROM items WHERE id = ANY($1)`,
+		pq.Array(uuidStrings(ids)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make(map[uuid.UUID]models.Item, len(ids))
+
+	for rows.Next() {
+		var item models.Item
+
+		if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Price, &item.Stock); err != nil {
+			return nil, err
+		}
+
+		items[item.ID] = item
+	}
+
+	return items, rows.Err()
+}
+
+func (s *PostgresStore) Create(ctx context.Context, order *models.Order, messages ...outbox.Message) error {
+	var fxRate []byte
+
+	if order.FXRate != nil {
+		data, err := sonic.Marshal(order.FXRate)
+		if err != nil {
+			return err
+		}
+
+		fxRate = data
+	}
+
+	return postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO orders (id, public_id, saga_id, customer_id, currency, fx_rate, status, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			 ON CONFLICT (public_id) DO NOTHING`,
+			order.ID, order.PublicID, order.SagaID, order.CustomerID, order.Currency, fxRate, order.Status, order.CreatedAt, order.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return fmt.Errorf("%w: %s", ErrPublicIDTaken, order.PublicID)
+		}
+
+		for _, item := range order.Items {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO order_items (id, order_id, item_id, quantity, price, currency) VALUES ($1, $2, $3, $4, $5, $6)`,
+				item.ID, item.OrderID, item.ItemID, item.Quantity, item.Price.Decimal(), item.Price.Currency,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return outbox.Enqueue(ctx, tx, messages...)
+	})
+}
+
+func (s *PostgresStore) Get(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	return s.getBy(ctx, "id", orderID)
+}
+
+func (s *PostgresStore) GetByPublicID(ctx context.Context, publicID string) (*models.Order, error) {
+	return s.getBy(ctx, "public_id", publicID)
+}
+
+// getBy returns the order whose column holds value. column is one of the unique columns of orders
+func (s *PostgresStore) getBy(ctx context.Context, column string, value any) (*models.Order, error) {
+	var (
+		order  models.Order
+		fxRate []byte
+	)
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, public_id, saga_id, customer_id, currency, fx_rate, status, created_at, updated_at FROM orders WHERE `+column+` = $1`,
+		value,
+	).Scan(&order.ID, &order.PublicID, &order.SagaID, &order.CustomerID, &order.Currency, &fxRate, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %v", ErrOrderNotFound, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fxRate != nil {
+		order.FXRate = new(models.ExchangeRate)
+
+		if err := sonic.Unmarshal(fxRate, order.FXRate); err != nil {
+			return nil, fmt.Errorf("failed to decode FX rate of order %s: %w", order.PublicID, err)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, order_id, item_id, quantity, price::text || ' ' || currency FROM order_items WHERE order_id = $1 ORDER BY id`,
+		order.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ItemID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+
+		order.Items = append(order.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if order.History, err = s.history(ctx, order.ID); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (s *PostgresStore) history(ctx context.Context, orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT from_status, to_status, reason, changed_at FROM order_status_history WHERE order_id = $1 ORDER BY id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+
+	for rows.Next() {
+		var change models.OrderStatusChange
+
+		if err := rows.Scan(&change.From, &change.To, &change.Reason, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *PostgresStore) Update(ctx context.Context, orderID uuid.UUID, update func(order *models.Order) ([]outbox.Message, error)) error {
+	return postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var order models.Order
+
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, public_id, saga_id, customer_id, currency, status, created_at, updated_at FROM orders WHERE id = $1 FOR UPDATE`,
+			orderID,
+		).Scan(&order.ID, &order.PublicID, &order.SagaID, &order.CustomerID, &order.Currency, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrOrderNotFound, orderID)
+		}
+		if err != nil {
+			return err
+		}
+
+		messages, err := update(&order)
+		if err != nil {
+			return err
+		}
+
+		if len(order.History) == 0 {
+			return outbox.Enqueue(ctx, tx, messages...)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3`,
+			order.Status, order.UpdatedAt, order.ID,
+		); err != nil {
+			return err
+		}
+
+		for _, change := range order.History {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO order_status_history (order_id, from_status, to_status, reason, changed_at) VALUES ($1, $2, $3, $4, $5)`,
+				order.ID, change.From, change.To, change.Reason, change.ChangedAt,
+			); err != nil {
+				return err
+			}
+		}
+
+		return outbox.Enqueue(ctx, tx, messages...)
+	})
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	result := make([]string, len(ids))
+	for i, id := range ids {
+		result[i] = id.String()
+	}
+
+	return result
+}
@@ -0,0 +1,234 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+func newMockStore(t *testing.T) (*PostgresStore, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations: %v", err)
+		}
+		db.Close()
+	})
+
+	return NewPostgresStore(db), mock
+}
+
+func TestCreateRollsBackOnItemFailure(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	now := time.Now().UTC()
+	order := &models.Order{ID: uuid.New(), PublicID: "ABC123", SagaID: uuid.New(), CustomerID: "alice", Currency: "USD", Status: models.OrderPending, CreatedAt: now, UpdatedAt: now}
+	order.Items = []models.OrderItem{
+		{ID: uuid.New(), OrderID: order.ID, ItemID: uuid.New(), Quantity: 1, Price: models.Money{Amount: 1000, Currency: "USD"}},
+		{ID: uuid.New(), OrderID: order.ID, ItemID: uuid.New(), Quantity: 2, Price: models.Money{Amount: 500, Currency: "USD"}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO orders`).
+		WithArgs(order.ID, "ABC123", order.SagaID, "alice", "USD", []byte(nil), models.OrderPending, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO order_items`).
+		WithArgs(order.Items[0].ID, order.ID, order.Items[0].ItemID, 1, "10.00", "USD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO order_items`).
+		WillReturnError(errors.New("foreign key violation"))
+	mock.ExpectRollback()
+
+	if err := store.Create(context.Background(), order); err == nil {
+		t.Fatalf("Expected the item failure to be returned")
+	}
+}
+
+func TestCreateQueuesMessagesInSameTransaction(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	now := time.Now().UTC()
+	order := &models.Order{ID: uuid.New(), PublicID: "ABC123", CustomerID: "alice", Status: models.OrderPending, CreatedAt: now, UpdatedAt: now}
+	order.Items = []models.OrderItem{{ID: uuid.New(), OrderID: order.ID, ItemID: uuid.New(), Quantity: 1, Price: models.Money{Amount: 1000, Currency: "USD"}}}
+
+	created := outbox.Message{
+		Topic: "orders",
+		Key:   []byte("saga-1"),
+		Event: models.Event{Event: models.EventOrderCreated, OrderID: order.ID},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO orders`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).
+		WithArgs("orders", []byte("saga-1"), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := store.Create(context.Background(), order, created); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestGetByPublicID(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	orderID, itemID, sagaID := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectQuery(`SELECT id, public_id, saga_id, customer_id, currency, fx_rate, status, created_at, updated_at FROM orders`).
+		WithArgs("ABC123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "fx_rate", "status", "created_at", "updated_at"}).
+			AddRow(orderID, "ABC123", sagaID, "alice", "EUR", []byte(`{"base":"USD","quote":"EUR","rate":"0.92","as_of":"2026-10-01T00:00:00Z"}`), models.OrderPending, now, now))
+	mock.ExpectQuery(`SELECT id, order_id, item_id, quantity, price::text \|\| ' ' \|\| currency FROM order_items`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "item_id", "quantity", "price"}).
+			AddRow(uuid.New(), orderID, itemID, 3, "12.500 EUR"))
+	mock.ExpectQuery(`SELECT from_status, to_status, reason, changed_at FROM order_status_history`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"from_status", "to_status", "reason", "changed_at"}).
+			AddRow(models.OrderPending, models.OrderProcessing, "saga started", now))
+
+	order, err := store.GetByPublicID(context.Background(), "ABC123")
+	if err != nil {
+		t.Fatalf("GetByPublicID() failed: %v", err)
+	}
+
+	if order.ID != orderID || order.SagaID != sagaID || order.Currency != "EUR" || len(order.Items) != 1 || order.Items[0].ItemID != itemID {
+		t.Errorf("Unexpected order %+v", order)
+	}
+
+	if len(order.History) != 1 || order.History[0].To != models.OrderProcessing || order.History[0].Reason != "saga started" {
+		t.Errorf("Expected the status history to be loaded, got %+v", order.History)
+	}
+
+	if order.FXRate == nil || order.FXRate.Quote != "EUR" || order.FXRate.Rate != "0.92" {
+		t.Errorf("Expected the frozen USD/EUR rate, got %+v", order.FXRate)
+	}
+
+	if total, err := order.Total(); err != nil || total != (models.Money{Amount: 3750, Currency: "EUR"}) {
+		t.Errorf("Expected a total of 37.50 EUR, got %s (%v)", total, err)
+	}
+
+	mock.ExpectQuery(`SELECT id, public_id`).
+		WithArgs("MISSING").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "fx_rate", "status", "created_at", "updated_at"}))
+
+	if _, err := store.GetByPublicID(context.Background(), "MISSING"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestUpdateStoresTransitionWithMessages(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	orderID := uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, public_id, saga_id, customer_id, currency, status, created_at, updated_at FROM orders WHERE id = \$1 FOR UPDATE`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "status", "created_at", "updated_at"}).
+			AddRow(orderID, "ABC123", uuid.New(), "alice", "USD", models.OrderPending, now, now))
+	mock.ExpectExec(`UPDATE orders SET status`).
+		WithArgs(models.OrderProcessing, sqlmock.AnyArg(), orderID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO order_status_history`).
+		WithArgs(orderID, models.OrderPending, models.OrderProcessing, "saga started", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).
+		WithArgs("order.events", []byte(orderID.String()), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := NewStatusUpdater(store, "order.events").Transition(context.Background(), uuid.New(), orderID, models.OrderProcessing, "saga started"); err != nil {
+		t.Fatalf("Transition() failed: %v", err)
+	}
+}
+
+func TestUpdateWritesNothingWithoutHistory(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	orderID := uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, public_id`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "status", "created_at", "updated_at"}).
+			AddRow(orderID, "ABC123", uuid.New(), "alice", "USD", models.OrderProcessing, now, now))
+	mock.ExpectCommit()
+
+	if err := NewStatusUpdater(store, "order.events").Transition(context.Background(), uuid.New(), orderID, models.OrderProcessing, "saga started"); err != nil {
+		t.Fatalf("Transition() failed: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, public_id`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "status", "created_at", "updated_at"}))
+	mock.ExpectRollback()
+
+	err := NewStatusUpdater(store, "order.events").Transition(context.Background(), uuid.New(), orderID, models.OrderProcessing, "saga started")
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestCreateReportsTakenPublicID(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	now := time.Now().UTC()
+	order := &models.Order{ID: uuid.New(), PublicID: "US-7KQ3-9XMD", SagaID: uuid.New(), CustomerID: "alice", Currency: "USD", Status: models.OrderPending, CreatedAt: now, UpdatedAt: now}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO orders .* ON CONFLICT \(public_id\) DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := store.Create(context.Background(), order); !errors.Is(err, ErrPublicIDTaken) {
+		t.Errorf("Expected ErrPublicIDTaken, got %v", err)
+	}
+}
+
+func TestGetByUUID(t *testing.T) {
+	store, mock := newMockStore(t)
+
+	orderID := uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "saga_id", "customer_id", "currency", "fx_rate", "status", "created_at", "updated_at"}).
+			AddRow(orderID, "US-7KQ3-9XMD", uuid.New(), "alice", "USD", nil, models.OrderPending, now, now))
+	mock.ExpectQuery(`FROM order_items`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "item_id", "quantity", "price"}))
+	mock.ExpectQuery(`FROM order_status_history`).
+		WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"from_status", "to_status", "reason", "changed_at"}))
+
+	order, err := store.Get(context.Background(), orderID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+
+	if order.ID != orderID || order.PublicID != "US-7KQ3-9XMD" || order.FXRate != nil {
+		t.Errorf("Unexpected order %+v", order)
+	}
+}
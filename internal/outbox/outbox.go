@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/bytedance/sonic"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// Message is an event waiting in the outbox table to be published by the Relay
+type Message struct {
+	Topic string
+	Key   []byte
+	Event models.Event
+}
+
+// Enqueue writes messages to the outbox inside tx, so they are only published if tx commits.
+// Messages with the same key are published in the order they were enqueued
+func Enqueue(ctx context.Context, tx *sql.Tx, messages ...Message) error {
+	for _, msg := range messages {
+		event, err := sonic.Marshal(msg.Event)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO outbox (topic, key, event) VALUES ($1, $2, $3)`,
+			msg.Topic, msg.Key, event,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
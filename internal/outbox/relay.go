@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/lib/pq"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+// EventPublisher is the part of kafka.Producer the relay needs
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// relayLockID is the advisory lock that lets a single relay replica publish at a time, which is
+// what keeps messages of the same key in order
+const relayLockID = 0x6f7574626f78
+
+// purgeInterval is how often sent messages older than the retention are deleted
+const purgeInterval = time.Minute
+
+// Relay publishes pending outbox messages through Kafka and marks them sent
+type Relay struct {
+	db        *sql.DB
+	publisher EventPublisher
+	batchSize int
+	retention time.Duration
+}
+
+// NewRelay publishes up to batchSize messages per round and keeps sent ones for retention
+func NewRelay(db *sql.DB, publisher EventPublisher, batchSize int, retention time.Duration) *Relay {
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		batchSize: batchSize,
+		retention: retention,
+	}
+}
+
+// Run relays every interval until ctx is done. A full batch is followed by the next one right away
+func (r *Relay) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+
+	for {
+		sent, err := r.RelayOnce(ctx)
+		if err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		if time.Since(lastPurge) >= purgeInterval {
+			if purged, err := r.Purge(ctx); err != nil {
+				log.Printf("Failed to purge outbox: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d sent outbox messages", purged)
+			}
+
+			lastPurge = time.Now()
+		}
+
+		if err == nil && sent == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type pendingMessage struct {
+	id int64
+	Message
+}
+
+// RelayOnce publishes the oldest pending messages and returns how many were sent. When a message
+// cannot be published, the later messages with the same key wait for the next round, so a key
+// is never published out of order. Another replica holding the relay lock makes this a no-op
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	sent := 0
+
+	err := postgres.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var locked bool
+		if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockID).Scan(&locked); err != nil {
+			return err
+		}
+
+		if !locked {
+			return nil
+		}
+
+		pending, err := r.pending(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		blocked := make(map[string]bool)
+		ids := make([]int64, 0, len(pending))
+
+		for _, msg := range pending {
+			if blocked[string(msg.Key)] {
+				continue
+			}
+
+			if err := r.publisher.PublishEvent(ctx, msg.Topic, msg.Key, msg.Event); err != nil {
+				log.Printf("Failed to relay outbox message %d to %s: %v", msg.id, msg.Topic, err)
+
+				blocked[string(msg.Key)] = true
+
+				_, err := tx.ExecContext(ctx,
+					`UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`,
+					err.Error(), msg.id,
+				)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			ids = append(ids, msg.id)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE outbox SET sent_at = now(), attempts = attempts + 1 WHERE id = ANY($1)`,
+			pq.Array(ids),
+		)
+		if err != nil {
+			return err
+		}
+
+		sent = len(ids)
+
+		return nil
+	})
+
+	return sent, err
+}
+
+func (r *Relay) pending(ctx context.Context, tx *sql.Tx) ([]pendingMessage, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, topic, key, event FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1`,
+		r.batchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var pending []pendingMessage
+
+	for rows.Next() {
+		var (
+			msg   pendingMessage
+			event []byte
+		)
+
+		if err := rows.Scan(&msg.id, &msg.Topic, &msg.Key, &event); err != nil {
+			return nil, err
+		}
+
+		if err := sonic.Unmarshal(event, &msg.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode outbox message %d: %w", msg.id, err)
+		}
+
+		pending = append(pending, msg)
+	}
+
+	return pending, rows.Err()
+}
+
+// Purge deletes messages that were sent longer than the retention ago
+func (r *Relay) Purge(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE sent_at < now() - $1 * interval '1 millisecond'`,
+		r.retention.Milliseconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type fakePublisher struct {
+	failKeys  map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	if p.failKeys[string(key)] {
+		return errors.New("broker down")
+	}
+
+	p.published = append(p.published, string(key)+":"+string(ev.Event))
+
+	return nil
+}
+
+func newMockRelay(t *testing.T, publisher EventPublisher) (*Relay, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations: %v", err)
+		}
+		db.Close()
+	})
+
+	return NewRelay(db, publisher, 10, time.Hour), mock
+}
+
+func eventJSON(t *testing.T, eventType models.EventType) []byte {
+	t.Helper()
+
+	data, err := sonic.Marshal(models.Event{Event: eventType, EventID: uuid.New()})
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	return data
+}
+
+func TestRelayOnceKeepsKeyOrder(t *testing.T) {
+	publisher := &fakePublisher{failKeys: map[string]bool{"saga-b": true}}
+	relay, mock := newMockRelay(t, publisher)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`SELECT id, topic, key, event FROM outbox WHERE sent_at IS NULL ORDER BY id`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "key", "event"}).
+			AddRow(1, "orders", []byte("saga-a"), eventJSON(t, models.EventOrderCreated)).
+			AddRow(2, "payment.commands", []byte("saga-b"), eventJSON(t, models.EventAuthorizePayment)).
+			AddRow(3, "inventory.commands", []byte("saga-a"), eventJSON(t, models.EventReserveInventory)).
+			AddRow(4, "inventory.commands", []byte("saga-b"), eventJSON(t, models.EventReserveInventory)))
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error`).
+		WithArgs("broker down", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET sent_at = now\(\)`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	sent, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce() failed: %v", err)
+	}
+
+	if sent != 2 {
+		t.Errorf("Expected 2 messages sent, got %d", sent)
+	}
+
+	expected := []string{"saga-a:ORDER_CREATED", "saga-a:RESERVE_INVENTORY"}
+	if len(publisher.published) != len(expected) {
+		t.Fatalf("Expected %v to be published, got %v", expected, publisher.published)
+	}
+
+	for i := range expected {
+		if publisher.published[i] != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, publisher.published[i])
+		}
+	}
+}
+
+func TestRelayOnceSkipsWhileAnotherRelayHoldsTheLock(t *testing.T) {
+	publisher := &fakePublisher{}
+	relay, mock := newMockRelay(t, publisher)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	sent, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce() failed: %v", err)
+	}
+
+	if sent != 0 || len(publisher.published) != 0 {
+		t.Errorf("Expected nothing to be relayed, got %d", sent)
+	}
+}
@@ -0,0 +1,288 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// FakeRule makes the fake gateway decline or time out matching calls. Empty CustomerID and
+// nil MinAmount match anything, so a rule with neither applies to every call of its operation.
+// MinAmount is in major units of whatever currency the call is in
+type FakeRule struct {
+	Operation  FakeOperation
+	CustomerID string
+	MinAmount  *big.Rat
+	Outcome    FakeOutcome
+}
+
+func (r FakeRule) matches(op FakeOperation, customerID string, amount models.Money) bool {
+	if r.Operation != op {
+		return false
+	}
+
+	if r.CustomerID != "" && r.CustomerID != customerID {
+		return false
+	}
+
+	return r.MinAmount == nil || amount.Rat().Cmp(r.MinAmount) >= 0
+}
+
+// ParseFakeRules reads rules in the form "operation:condition:outcome" separated by commas,
+// where operation is charge, refund, authorize, capture or void and condition is
+// "customer=<id>", "min=<amount>" or "*". For example
+// "charge:customer=bob:decline,charge:min=1000:timeout,refund:*:decline"
+func ParseFakeRules(spec string) ([]FakeRule, error) {
+	var rules []FakeRule
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid fake rule %q: expected operation:condition:outcome", part)
+		}
+
+		rule := FakeRule{Operation: FakeOperation(fields[0]), Outcome: FakeOutcome(fields[2])}
+
+		switch rule.Operation {
+		case FakeCharge, FakeRefund, FakeAuthorize, FakeCapture, FakeVoid:
+		default:
+			return nil, fmt.Errorf("invalid fake rule %q: unknown operation %q", part, fields[0])
+		}
+
+		if rule.Outcome != FakeSucceed && rule.Outcome != FakeDecline && rule.Outcome != FakeTimeout {
+			return nil, fmt.Errorf("invalid fake rule %q: unknown outcome %q", part, fields[2])
+		}
+
+		switch condition := fields[1]; {
+		case condition == "*":
+		case strings.HasPrefix(condition, "customer="):
+			rule.CustomerID = strings.TrimPrefix(condition, "customer=")
+		case strings.HasPrefix(condition, "min="):
+			amount, ok := new(big.Rat).SetString(strings.TrimPrefix(condition, "min="))
+			if !ok {
+				return nil, fmt.Errorf("invalid fake rule %q: invalid amount", part)
+			}
+			rule.MinAmount = amount
+		default:
+			return nil, fmt.Errorf("invalid fake rule %q: unknown condition %q", part, condition)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+type fakePayment struct {
+	customerID string
+	amount     models.Money
+	status     PaymentStatus
+}
+
+// FakeGateway is a deterministic in-memory PaymentGateway for local runs and tests. Calls
+// succeed unless the first matching rule says otherwise, and payment IDs are derived from the
+// idempotency key so the same charge always gets the same ID
+type FakeGateway struct {
+	rules []FakeRule
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+func NewFakeGateway(rules ...FakeRule) *FakeGateway {
+	return &FakeGateway{
+		rules:    rules,
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+func (g *FakeGateway) outcome(op FakeOperation, customerID string, amount models.Money) FakeOutcome {
+	for _, rule := range g.rules {
+		if rule.matches(op, customerID, amount) {
+			return rule.Outcome
+		}
+	}
+
+	return FakeSucceed
+}
+
+func (g *FakeGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	return g.open(ctx, FakeCharge, req, PaymentSucceeded)
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, req ChargeRequest) (string, error) {
+	return g.open(ctx, FakeAuthorize, req, PaymentAuthorized)
+}
+
+// open creates the payment of a charge or authorization in status, unless a rule declines it
+func (g *FakeGateway) open(ctx context.Context, op FakeOperation, req ChargeRequest, status PaymentStatus) (string, error) {
+	paymentID := fakePaymentID(req.IdempotencyKey)
+
+	if existing, err := g.GetStatus(ctx, paymentID); err == nil {
+		// Same idempotency key, same result
+		if existing == PaymentDeclined {
+			return "", ErrDeclined
+		}
+		return paymentID, nil
+	}
+
+	switch g.outcome(op, req.CustomerID, req.Amount) {
+	case FakeTimeout:
+		<-ctx.Done()
+		return "", fmt.Errorf("%w: %v", ErrGatewayTimeout, ctx.Err())
+	case FakeDecline:
+		g.store(paymentID, &fakePayment{customerID: req.CustomerID, amount: req.Amount, status: PaymentDeclined})
+		return "", ErrDeclined
+	}
+
+	g.store(paymentID, &fakePayment{customerID: req.CustomerID, amount: req.Amount, status: status})
+
+	return paymentID, nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, paymentID string, amount models.Money) error {
+	p, err := g.snapshot(paymentID)
+	if err != nil {
+		return err
+	}
+
+	switch p.status {
+	case PaymentRefunded:
+		return nil
+	case PaymentDeclined:
+		return fmt.Errorf("%w: payment %s was declined", ErrInvalidRefund, paymentID)
+	case PaymentAuthorized, PaymentVoided:
+		return fmt.Errorf("%w: payment %s was never captured", ErrInvalidRefund, paymentID)
+	}
+
+	if cmp, err := amount.Cmp(p.amount); err != nil || cmp > 0 {
+		return fmt.Errorf("%w: %s does not fit charged %s", ErrInvalidRefund, amount, p.amount)
+	}
+
+	if err := g.apply(ctx, FakeRefund, p, amount); err != nil {
+		return err
+	}
+
+	g.setStatus(paymentID, PaymentRefunded)
+
+	return nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, paymentID string, amount models.Money) error {
+	p, err := g.snapshot(paymentID)
+	if err != nil {
+		return err
+	}
+
+	switch p.status {
+	case PaymentSucceeded:
+		return nil
+	case PaymentAuthorized:
+	default:
+		return fmt.Errorf("%w: cannot capture %s payment %s", ErrInvalidState, p.status, paymentID)
+	}
+
+	if cmp, err := amount.Cmp(p.amount); err != nil || cmp > 0 {
+		return fmt.Errorf("%w: %s does not fit authorized %s", ErrInvalidState, amount, p.amount)
+	}
+
+	if err := g.apply(ctx, FakeCapture, p, amount); err != nil {
+		return err
+	}
+
+	g.setStatus(paymentID, PaymentSucceeded)
+
+	return nil
+}
+
+func (g *FakeGateway) Void(ctx context.Context, paymentID string) error {
+	p, err := g.snapshot(paymentID)
+	if err != nil {
+		return err
+	}
+
+	switch p.status {
+	case PaymentVoided, PaymentDeclined:
+		// Nothing is held anymore
+		return nil
+	case PaymentAuthorized:
+	default:
+		return fmt.Errorf("%w: cannot void %s payment %s", ErrInvalidState, p.status, paymentID)
+	}
+
+	if err := g.apply(ctx, FakeVoid, p, p.amount); err != nil {
+		return err
+	}
+
+	g.setStatus(paymentID, PaymentVoided)
+
+	return nil
+}
+
+func (g *FakeGateway) GetStatus(ctx context.Context, paymentID string) (PaymentStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[paymentID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownPayment, paymentID)
+	}
+
+	return p.status, nil
+}
+
+// snapshot copies the payment so it can be inspected without holding the lock
+func (g *FakeGateway) snapshot(paymentID string) (fakePayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[paymentID]
+	if !ok {
+		return fakePayment{}, fmt.Errorf("%w: %s", ErrUnknownPayment, paymentID)
+	}
+
+	return *p, nil
+}
+
+// apply runs the rules of a follow-up operation on an existing payment
+func (g *FakeGateway) apply(ctx context.Context, op FakeOperation, p fakePayment, amount models.Money) error {
+	switch g.outcome(op, p.customerID, amount) {
+	case FakeTimeout:
+		<-ctx.Done()
+		return fmt.Errorf("%w: %v", ErrGatewayTimeout, ctx.Err())
+	case FakeDecline:
+		return ErrDeclined
+	}
+
+	return nil
+}
+
+func (g *FakeGateway) setStatus(paymentID string, status PaymentStatus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.payments[paymentID].status = status
+}
+
+func (g *FakeGateway) store(paymentID string, p *fakePayment) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.payments[paymentID] = p
+}
+
+func fakePaymentID(idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(idempotencyKey))
+	return "fake_" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,155 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+func TestParseFakeRules(t *testing.T) {
+	rules, err := ParseFakeRules("charge:customer=bob:decline, charge:min=1000:timeout,refund:*:decline")
+	if err != nil {
+		t.Fatalf("ParseFakeRules() failed: %v", err)
+	}
+
+	expected := []FakeRule{
+		{Operation: FakeCharge, CustomerID: "bob", Outcome: FakeDecline},
+		{Operation: FakeCharge, MinAmount: big.NewRat(1000, 1), Outcome: FakeTimeout},
+		{Operation: FakeRefund, Outcome: FakeDecline},
+	}
+
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(rules))
+	}
+	for i, rule := range rules {
+		sameMin := rule.MinAmount == nil && expected[i].MinAmount == nil ||
+			rule.MinAmount != nil && expected[i].MinAmount != nil && rule.MinAmount.Cmp(expected[i].MinAmount) == 0
+
+		if rule.Operation != expected[i].Operation || rule.CustomerID != expected[i].CustomerID || rule.Outcome != expected[i].Outcome || !sameMin {
+			t.Errorf("Expected rule %+v, got %+v", expected[i], rule)
+		}
+	}
+
+	for _, spec := range []string{"charge:decline", "payout:*:decline", "charge:*:explode", "charge:min=abc:decline", "charge:who=bob:decline"} {
+		if _, err := ParseFakeRules(spec); err == nil {
+			t.Errorf("Expected error for spec %q", spec)
+		}
+	}
+}
+
+func TestFakeGatewayOutcomes(t *testing.T) {
+	gateway := NewFakeGateway(
+		FakeRule{Operation: FakeCharge, CustomerID: "bob", Outcome: FakeDecline},
+		FakeRule{Operation: FakeCharge, MinAmount: big.NewRat(1000, 1), Outcome: FakeTimeout},
+	)
+
+	tests := []struct {
+		name      string
+		req       ChargeRequest
+		expectErr error
+	}{
+		{name: "succeed", req: ChargeRequest{IdempotencyKey: "a", CustomerID: "alice", Amount: models.Money{Amount: 1000, Currency: "USD"}}},
+		{name: "decline by customer", req: ChargeRequest{IdempotencyKey: "b", CustomerID: "bob", Amount: models.Money{Amount: 1000, Currency: "USD"}}, expectErr: ErrDeclined},
+		{name: "timeout by amount", req: ChargeRequest{IdempotencyKey: "c", CustomerID: "alice", Amount: models.Money{Amount: 150000, Currency: "USD"}}, expectErr: ErrGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			paymentID, err := gateway.Charge(ctx, tt.req)
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Fatalf("Expected %v, got %v", tt.expectErr, err)
+				}
+				return
+			}
+
+			if err != nil || paymentID == "" {
+				t.Fatalf("Expected a payment ID, got %q (%v)", paymentID, err)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayIdempotentChargeAndRefund(t *testing.T) {
+	ctx := context.Background()
+	gateway := NewFakeGateway()
+
+	first, err := gateway.Charge(ctx, ChargeRequest{IdempotencyKey: "saga-1", CustomerID: "alice", Amount: models.Money{Amount: 2000, Currency: "USD"}})
+	if err != nil {
+		t.Fatalf("Charge() failed: %v", err)
+	}
+
+	second, err := gateway.Charge(ctx, ChargeRequest{IdempotencyKey: "saga-1", CustomerID: "alice", Amount: models.Money{Amount: 2000, Currency: "USD"}})
+	if err != nil || second != first {
+		t.Fatalf("Expected the same payment %s for a repeated charge, got %s (%v)", first, second, err)
+	}
+
+	if err := gateway.Refund(ctx, first, models.Money{Amount: 3000, Currency: "USD"}); !errors.Is(err, ErrInvalidRefund) {
+		t.Errorf("Expected ErrInvalidRefund for refund above the charge, got %v", err)
+	}
+
+	for range 2 {
+		if err := gateway.Refund(ctx, first, models.Money{Amount: 2000, Currency: "USD"}); err != nil {
+			t.Fatalf("Refund() failed: %v", err)
+		}
+	}
+
+	status, err := gateway.GetStatus(ctx, first)
+	if err != nil || status != PaymentRefunded {
+		t.Errorf("Expected REFUNDED, got %s (%v)", status, err)
+	}
+
+	if err := gateway.Refund(ctx, "fake_missing", models.Money{Amount: 100, Currency: "USD"}); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("Expected ErrUnknownPayment, got %v", err)
+	}
+}
+
+func TestFakeGatewayAuthorizeCaptureVoid(t *testing.T) {
+	ctx := context.Background()
+	gateway := NewFakeGateway()
+
+	captured, err := gateway.Authorize(ctx, ChargeRequest{IdempotencyKey: "saga-1", CustomerID: "alice", Amount: models.Money{Amount: 2000, Currency: "USD"}})
+	if err != nil {
+		t.Fatalf("Authorize() failed: %v", err)
+	}
+
+	if err := gateway.Capture(ctx, captured, models.Money{Amount: 3000, Currency: "USD"}); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState for capture above the authorization, got %v", err)
+	}
+
+	for range 2 {
+		if err := gateway.Capture(ctx, captured, models.Money{Amount: 2000, Currency: "USD"}); err != nil {
+			t.Fatalf("Capture() failed: %v", err)
+		}
+	}
+
+	if err := gateway.Void(ctx, captured); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState when voiding a captured payment, got %v", err)
+	}
+
+	voided, err := gateway.Authorize(ctx, ChargeRequest{IdempotencyKey: "saga-2", CustomerID: "alice", Amount: models.Money{Amount: 2000, Currency: "USD"}})
+	if err != nil {
+		t.Fatalf("Authorize() failed: %v", err)
+	}
+
+	for range 2 {
+		if err := gateway.Void(ctx, voided); err != nil {
+			t.Fatalf("Void() failed: %v", err)
+		}
+	}
+
+	if err := gateway.Capture(ctx, voided, models.Money{Amount: 2000, Currency: "USD"}); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState when capturing a voided authorization, got %v", err)
+	}
+
+	if status, err := gateway.GetStatus(ctx, voided); err != nil || status != PaymentVoided {
+		t.Errorf("Expected VOIDED, got %s (%v)", status, err)
+	}
+}
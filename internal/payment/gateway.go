@@ -0,0 +1,43 @@
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+var (
+	ErrDeclined       = errors.New("payment declined")
+	ErrGatewayTimeout = errors.New("payment gateway timed out")
+	ErrUnknownPayment = errors.New("unknown payment")
+	ErrInvalidRefund  = errors.New("invalid refund")
+	ErrInvalidState   = errors.New("payment is not in a valid state for this operation")
+)
+
+// ChargeRequest asks the gateway to take Amount from a customer. Charges with the same
+// IdempotencyKey are only executed once and return the original result
+type ChargeRequest struct {
+	IdempotencyKey string
+	CustomerID     string
+	Amount         models.Money
+}
+
+// PaymentGateway is the payment provider the service charges and refunds through. Providers with
+// two-phase payments also authorize first and capture or void the authorization later
+type PaymentGateway interface {
+	// Charge takes the money and returns the payment ID, or ErrDeclined
+	Charge(ctx context.Context, req ChargeRequest) (string, error)
+	// Authorize holds the money without taking it and returns the payment ID, or ErrDeclined.
+	// Authorizations are idempotent by IdempotencyKey like charges
+	Authorize(ctx context.Context, req ChargeRequest) (string, error)
+	// Capture takes up to the authorized amount. Capturing twice is a no-op, capturing a voided
+	// authorization or more than was authorized fails with ErrInvalidState
+	Capture(ctx context.Context, paymentID string, amount models.Money) error
+	// Void releases an authorization. Voiding twice is a no-op, voiding a captured payment fails with ErrInvalidState
+	Void(ctx context.Context, paymentID string) error
+	// Refund gives amount of a succeeded payment back. Refunding an already refunded payment is a no-op
+	Refund(ctx context.Context, paymentID string, amount models.Money) error
+	// GetStatus returns the current status of a payment, or ErrUnknownPayment
+	GetStatus(ctx context.Context, paymentID string) (PaymentStatus, error)
+}
@@ -0,0 +1,30 @@
+package payment
+
+// PaymentStatus represents the status of a payment at the gateway.
+type PaymentStatus string
+
+const (
+	PaymentAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentSucceeded  PaymentStatus = "SUCCEEDED"
+	PaymentDeclined   PaymentStatus = "DECLINED"
+	PaymentRefunded   PaymentStatus = "REFUNDED"
+	PaymentVoided     PaymentStatus = "VOIDED"
+)
+
+// FakeOperation is the gateway call a FakeRule applies to.
+type FakeOperation string
+
+// FakeOutcome is what the fake gateway does when a FakeRule matches.
+type FakeOutcome string
+
+const (
+	FakeCharge    FakeOperation = "charge"
+	FakeRefund    FakeOperation = "refund"
+	FakeAuthorize FakeOperation = "authorize"
+	FakeCapture   FakeOperation = "capture"
+	FakeVoid      FakeOperation = "void"
+
+	FakeSucceed FakeOutcome = "succeed"
+	FakeDecline FakeOutcome = "decline"
+	FakeTimeout FakeOutcome = "timeout"
+)
@@ -0,0 +1,136 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// EventPublisher is the part of kafka.Producer the service needs to send replies
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// Service handles payment commands through a PaymentGateway and replies to the saga orchestrator
+type Service struct {
+	gateway        PaymentGateway
+	publisher      EventPublisher
+	replyTopic     string
+	gatewayTimeout time.Duration
+}
+
+func NewService(gateway PaymentGateway, publisher EventPublisher, replyTopic string, gatewayTimeout time.Duration) *Service {
+	return &Service{
+		gateway:        gateway,
+		publisher:      publisher,
+		replyTopic:     replyTopic,
+		gatewayTimeout: gatewayTimeout,
+	}
+}
+
+// Routes returns the router for the payment commands. Declines are answered with a failure reply, while
+// timeouts and other gateway errors are returned so the record can be retried. Charges and
+// authorizations use the saga ID as idempotency key, so a retried command never takes or holds
+// the money twice
+func (s *Service) Routes() *kafka.Router {
+	r := kafka.NewCommandRouter()
+
+	kafka.Route(r, models.EventProcessPayment, s.processPayment)
+	kafka.Route(r, models.EventRefundPayment, s.refundPayment)
+	kafka.Route(r, models.EventAuthorizePayment, s.authorizePayment)
+	kafka.Route(r, models.EventCapturePayment, s.capturePayment)
+	kafka.Route(r, models.EventVoidAuthorization, s.voidAuthorization)
+
+	return r
+}
+
+func (s *Service) processPayment(ctx context.Context, ev models.Event, cmd models.ProcessPaymentCommand) error {
+	gatewayCtx, cancel := context.WithTimeout(ctx, s.gatewayTimeout)
+	defer cancel()
+
+	paymentID, err := s.gateway.Charge(gatewayCtx, ChargeRequest{
+		IdempotencyKey: ev.SagaID.String(),
+		CustomerID:     cmd.CustomerID,
+		Amount:         cmd.Amount,
+	})
+
+	return s.reply(ctx, ev, paymentID, err, models.EventPaymentProcessed, models.EventPaymentFailed)
+}
+
+func (s *Service) refundPayment(ctx context.Context, ev models.Event, cmd models.RefundPaymentCommand) error {
+	gatewayCtx, cancel := context.WithTimeout(ctx, s.gatewayTimeout)
+	defer cancel()
+
+	err := s.gateway.Refund(gatewayCtx, cmd.PaymentID, cmd.Amount)
+
+	return s.reply(ctx, ev, cmd.PaymentID, err, models.EventPaymentRefunded, models.EventPaymentRefundFailed)
+}
+
+func (s *Service) authorizePayment(ctx context.Context, ev models.Event, cmd models.AuthorizePaymentCommand) error {
+	gatewayCtx, cancel := context.WithTimeout(ctx, s.gatewayTimeout)
+	defer cancel()
+
+	paymentID, err := s.gateway.Authorize(gatewayCtx, ChargeRequest{
+		IdempotencyKey: ev.SagaID.String(),
+		CustomerID:     cmd.CustomerID,
+		Amount:         cmd.Amount,
+	})
+
+	return s.reply(ctx, ev, paymentID, err, models.EventPaymentAuthorized, models.EventPaymentAuthorizationFailed)
+}
+
+func (s *Service) capturePayment(ctx context.Context, ev models.Event, cmd models.CapturePaymentCommand) error {
+	gatewayCtx, cancel := context.WithTimeout(ctx, s.gatewayTimeout)
+	defer cancel()
+
+	err := s.gateway.Capture(gatewayCtx, cmd.PaymentID, cmd.Amount)
+
+	return s.reply(ctx, ev, cmd.PaymentID, err, models.EventPaymentCaptured, models.EventPaymentCaptureFailed)
+}
+
+func (s *Service) voidAuthorization(ctx context.Context, ev models.Event, cmd models.VoidAuthorizationCommand) error {
+	gatewayCtx, cancel := context.WithTimeout(ctx, s.gatewayTimeout)
+	defer cancel()
+
+	err := s.gateway.Void(gatewayCtx, cmd.PaymentID)
+
+	return s.reply(ctx, ev, cmd.PaymentID, err, models.EventAuthorizationVoided, models.EventAuthorizationVoidFailed)
+}
+
+func (s *Service) reply(ctx context.Context, cmd models.Event, paymentID string, result error, success, failure models.EventType) error {
+	if result != nil && !isBusinessError(result) {
+		return result
+	}
+
+	eventType := success
+	reply := models.PaymentReply{Success: true, PaymentID: paymentID, Message: "ok"}
+
+	if result != nil {
+		eventType = failure
+		reply = models.PaymentReply{Success: false, PaymentID: paymentID, Message: result.Error()}
+	}
+
+	ev, err := models.NewEvent(eventType, cmd.SagaID, cmd.OrderID, reply)
+	if err != nil {
+		return err
+	}
+
+	if err := s.publisher.PublishEvent(ctx, s.replyTopic, []byte(cmd.SagaID.String()), ev); err != nil {
+		return err
+	}
+
+	log.Printf("%s for saga %s: %s", eventType, cmd.SagaID, reply.Message)
+
+	return nil
+}
+
+func isBusinessError(err error) bool {
+	return errors.Is(err, ErrDeclined) ||
+		errors.Is(err, ErrUnknownPayment) ||
+		errors.Is(err, ErrInvalidRefund) ||
+		errors.Is(err, ErrInvalidState)
+}
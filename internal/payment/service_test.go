@@ -0,0 +1,138 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+type fakePublisher struct {
+	events []models.Event
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func command(t *testing.T, eventType models.EventType, sagaID uuid.UUID, payload any) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(eventType, sagaID, uuid.New(), payload)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func decodeReply(t *testing.T, ev models.Event) models.PaymentReply {
+	t.Helper()
+
+	var reply models.PaymentReply
+	if err := sonic.Unmarshal(ev.Payload, &reply); err != nil {
+		t.Fatalf("Failed to decode reply: %v", err)
+	}
+
+	return reply
+}
+
+func TestServiceChargesAndRefunds(t *testing.T) {
+	publisher := &fakePublisher{}
+	handle := NewService(NewFakeGateway(), publisher, "payment.replies", time.Second).Routes().HandleEvent
+	sagaID := uuid.New()
+
+	charge := command(t, models.EventProcessPayment, sagaID, models.ProcessPaymentCommand{Amount: models.Money{Amount: 3000, Currency: "USD"}, CustomerID: "alice"})
+	if err := handle(context.Background(), charge); err != nil {
+		t.Fatalf("handle(PROCESS_PAYMENT) failed: %v", err)
+	}
+
+	processed := publisher.events[0]
+	reply := decodeReply(t, processed)
+	if processed.Event != models.EventPaymentProcessed || !reply.Success || reply.PaymentID == "" {
+		t.Fatalf("Expected PAYMENT_PROCESSED with a payment ID, got %s %+v", processed.Event, reply)
+	}
+
+	refund := command(t, models.EventRefundPayment, sagaID, models.RefundPaymentCommand{PaymentID: reply.PaymentID, Amount: models.Money{Amount: 3000, Currency: "USD"}})
+	if err := handle(context.Background(), refund); err != nil {
+		t.Fatalf("handle(REFUND_PAYMENT) failed: %v", err)
+	}
+
+	refunded := publisher.events[1]
+	if refunded.Event != models.EventPaymentRefunded || decodeReply(t, refunded).PaymentID != reply.PaymentID {
+		t.Errorf("Expected PAYMENT_REFUNDED for %s, got %s", reply.PaymentID, refunded.Event)
+	}
+}
+
+func TestServiceRepliesToDecline(t *testing.T) {
+	publisher := &fakePublisher{}
+	gateway := NewFakeGateway(FakeRule{Operation: FakeCharge, CustomerID: "bob", Outcome: FakeDecline})
+	handle := NewService(gateway, publisher, "payment.replies", time.Second).Routes().HandleEvent
+
+	charge := command(t, models.EventProcessPayment, uuid.New(), models.ProcessPaymentCommand{Amount: models.Money{Amount: 3000, Currency: "USD"}, CustomerID: "bob"})
+	if err := handle(context.Background(), charge); err != nil {
+		t.Fatalf("handle() failed: %v", err)
+	}
+
+	if len(publisher.events) != 1 || publisher.events[0].Event != models.EventPaymentFailed {
+		t.Fatalf("Expected PAYMENT_FAILED, got %+v", publisher.events)
+	}
+	if decodeReply(t, publisher.events[0]).Success {
+		t.Errorf("Expected an unsuccessful reply")
+	}
+}
+
+func TestServiceReturnsGatewayTimeout(t *testing.T) {
+	publisher := &fakePublisher{}
+	gateway := NewFakeGateway(FakeRule{Operation: FakeCharge, Outcome: FakeTimeout})
+	handle := NewService(gateway, publisher, "payment.replies", 10*time.Millisecond).Routes().HandleEvent
+
+	charge := command(t, models.EventProcessPayment, uuid.New(), models.ProcessPaymentCommand{Amount: models.Money{Amount: 3000, Currency: "USD"}, CustomerID: "alice"})
+	if err := handle(context.Background(), charge); err == nil {
+		t.Fatalf("Expected the gateway timeout to be returned for a retry")
+	}
+
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no reply on timeout, got %d", len(publisher.events))
+	}
+}
+
+func TestServiceAuthorizesAndCaptures(t *testing.T) {
+	publisher := &fakePublisher{}
+	handle := NewService(NewFakeGateway(), publisher, "payment.replies", time.Second).Routes().HandleEvent
+	sagaID := uuid.New()
+
+	authorize := command(t, models.EventAuthorizePayment, sagaID, models.AuthorizePaymentCommand{Amount: models.Money{Amount: 3000, Currency: "USD"}, CustomerID: "alice"})
+	if err := handle(context.Background(), authorize); err != nil {
+		t.Fatalf("handle(AUTHORIZE_PAYMENT) failed: %v", err)
+	}
+
+	authorized := publisher.events[0]
+	reply := decodeReply(t, authorized)
+	if authorized.Event != models.EventPaymentAuthorized || reply.PaymentID == "" {
+		t.Fatalf("Expected PAYMENT_AUTHORIZED with a payment ID, got %s %+v", authorized.Event, reply)
+	}
+
+	capture := command(t, models.EventCapturePayment, sagaID, models.CapturePaymentCommand{PaymentID: reply.PaymentID, Amount: models.Money{Amount: 3000, Currency: "USD"}})
+	if err := handle(context.Background(), capture); err != nil {
+		t.Fatalf("handle(CAPTURE_PAYMENT) failed: %v", err)
+	}
+
+	if publisher.events[1].Event != models.EventPaymentCaptured {
+		t.Fatalf("Expected PAYMENT_CAPTURED, got %s", publisher.events[1].Event)
+	}
+
+	// The authorization is gone once captured, so a late void is answered with a failure
+	void := command(t, models.EventVoidAuthorization, sagaID, models.VoidAuthorizationCommand{PaymentID: reply.PaymentID})
+	if err := handle(context.Background(), void); err != nil {
+		t.Fatalf("handle(VOID_AUTHORIZATION) failed: %v", err)
+	}
+
+	if publisher.events[2].Event != models.EventAuthorizationVoidFailed {
+		t.Errorf("Expected AUTHORIZATION_VOID_FAILED, got %s", publisher.events[2].Event)
+	}
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/config"
+
+	_ "github.com/lib/pq"
+)
+
+// Open connects to the configured Postgres database and checks the connection is usable
+func Open(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.GetPostgresConnectionString())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	return db, nil
+}
+
+// InTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
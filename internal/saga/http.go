@@ -0,0 +1,76 @@
+package saga
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+)
+
+// expiredSaga is a saga together with the deadline its current step missed
+type expiredSaga struct {
+	*SagaState
+	Deadline time.Time `json:"deadline"`
+}
+
+// NewQueryHandler exposes read-only saga queries over HTTP:
+//
+//	GET /sagas/expired  active sagas whose current step is past its timeout
+//	GET /sagas/{id}     a single saga
+func NewQueryHandler(o *Orchestrator) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /sagas/expired", func(w http.ResponseWriter, r *http.Request) {
+		sagas, err := o.Expired(r.Context(), time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		result := make([]expiredSaga, 0, len(sagas))
+		for _, state := range sagas {
+			deadline, _ := o.Deadline(state)
+			result = append(result, expiredSaga{SagaState: state, Deadline: deadline})
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	mux.HandleFunc("GET /sagas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sagaID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid saga id"})
+			return
+		}
+
+		state, err := o.store.Get(r.Context(), sagaID)
+		if errors.Is(err, ErrSagaNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, state)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	data, err := sonic.Marshal(body)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,78 @@
+package saga
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-process SagaStore, meant for tests and local runs
+type MemoryStore struct {
+	mu    sync.RWMutex
+	sagas map[uuid.UUID]SagaState
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sagas: make(map[uuid.UUID]SagaState)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, sagaID uuid.UUID) (*SagaState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, ok := m.sagas[sagaID]
+	if !ok {
+		return nil, ErrSagaNotFound
+	}
+
+	return &state, nil
+}
+
+func (m *MemoryStore) Create(ctx context.Context, state *SagaState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sagas[state.SagaID]; exists {
+		return ErrSagaExists
+	}
+
+	state.Version = 1
+	m.sagas[state.SagaID] = *state
+
+	return nil
+}
+
+func (m *MemoryStore) Update(ctx context.Context, state *SagaState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.sagas[state.SagaID]
+	if !ok {
+		return ErrSagaNotFound
+	}
+
+	if stored.Version != state.Version {
+		return ErrVersionConflict
+	}
+
+	state.Version++
+	m.sagas[state.SagaID] = *state
+
+	return nil
+}
+
+func (m *MemoryStore) ListByStatus(ctx context.Context, status SagaStatus) ([]*SagaState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*SagaState
+
+	for _, state := range m.sagas {
+		if state.Status == status {
+			result = append(result, &state)
+		}
+	}
+
+	return result, nil
+}
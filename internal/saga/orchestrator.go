@@ -0,0 +1,615 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// EventPublisher is the part of kafka.Producer the orchestrator needs to send commands
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error
+}
+
+// OrderStatusUpdater moves orders through their statuses, see order.StatusUpdater
+type OrderStatusUpdater interface {
+	Transition(ctx context.Context, sagaID, orderID uuid.UUID, to models.OrderStatus, reason string) error
+}
+
+// Orchestrator drives sagas through a workflow: it starts one per created order, sends the
+// command of the current step and moves forward when the matching reply arrives. The order of
+// each saga follows it from PROCESSING to COMPLETED, CANCELLED or FAILED
+type Orchestrator struct {
+	workflow  *SagaWorkflow
+	store     SagaStore
+	publisher EventPublisher
+	orders    OrderStatusUpdater
+}
+
+// maxUpdateAttempts bounds how often a reply is re-applied after losing a version race
+const maxUpdateAttempts = 3
+
+// stepReply holds the fields shared by every service reply payload
+type stepReply struct {
+	Success   bool   `json:"success"`
+	PaymentID string `json:"payment_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// NewOrchestrator sends commands through publisher, unless store is an OutboxStore that queues
+// them, and moves orders through orders
+func NewOrchestrator(workflow *SagaWorkflow, store SagaStore, publisher EventPublisher, orders OrderStatusUpdater) *Orchestrator {
+	return &Orchestrator{
+		workflow:  workflow,
+		store:     store,
+		publisher: publisher,
+		orders:    orders,
+	}
+}
+
+// HandleRecord decodes the event envelope from record and processes it, so it can be used as a kafka.RecordHandler
+func (o *Orchestrator) HandleRecord(ctx context.Context, record *kgo.Record) error {
+	ev, err := kafka.DecodeEvent(record)
+	if err != nil {
+		return err
+	}
+
+	return o.HandleEvent(ctx, ev)
+}
+
+// HandleEvent starts a saga for ORDER_CREATED events, cancels one for CANCEL_ORDER and treats
+// everything else as a step reply. A reply that loses a version race is re-applied on the fresh
+// state, where it usually turns out stale
+func (o *Orchestrator) HandleEvent(ctx context.Context, ev models.Event) error {
+	handle := o.handleReply
+
+	switch ev.Event {
+	case models.EventOrderCreated:
+		return o.start(ctx, ev)
+	case models.EventCancelOrder:
+		handle = o.handleCancel
+	case models.EventInventoryHoldExpired:
+		handle = o.handleHoldExpired
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := handle(ctx, ev)
+		if !errors.Is(err, ErrVersionConflict) || attempt == maxUpdateAttempts {
+			return err
+		}
+
+		log.Printf("Saga %s changed concurrently, retrying %s (attempt %d)", ev.SagaID, ev.Event, attempt)
+	}
+}
+
+func (o *Orchestrator) start(ctx context.Context, ev models.Event) error {
+	if len(o.workflow.Steps) == 0 {
+		return fmt.Errorf("workflow has no steps")
+	}
+
+	sagaID := ev.SagaID
+	if sagaID == uuid.Nil {
+		// A made-up ID would start a second saga every time the event is redelivered
+		return kafka.Fatal(fmt.Errorf("order %s was created without a saga ID", ev.OrderID))
+	}
+
+	order, err := models.DecodePayload[models.OrderCreatedEvent](ev)
+	if err != nil {
+		return kafka.Fatal(fmt.Errorf("failed to decode order for saga %s: %w", sagaID, err))
+	}
+
+	data := OrderSagaData{
+		PublicID:   order.PublicID,
+		CustomerID: order.CustomerID,
+		Items:      order.Items,
+		Amount:     order.Amount,
+		FXRate:     order.FXRate,
+	}
+
+	payload, err := sonic.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	state := &SagaState{
+		SagaID:      sagaID,
+		OrderID:     ev.OrderID,
+		Status:      SagaStatusStarted,
+		CurrentStep: o.workflow.Steps[0].Step,
+		Payload:     payload,
+		StartedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = o.store.Create(ctx, state)
+	if errors.Is(err, ErrSagaExists) {
+		// A saga stays STARTED until its first command is out, so a redelivered order can finish the job
+		state, err = o.store.Get(ctx, sagaID)
+		if err != nil {
+			return err
+		}
+
+		if state.Status != SagaStatusStarted {
+			log.Printf("Saga %s already started, ignoring duplicate %s", sagaID, ev.EventID)
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	state.Status = SagaStatusInProgress
+	state.Attempts = 1
+	state.UpdatedAt = time.Now().UTC()
+
+	if err := o.moveOrder(ctx, state, models.OrderProcessing, "saga started"); err != nil {
+		return err
+	}
+
+	if err := o.transition(ctx, state, true, o.workflow.Steps[0]); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			log.Printf("Saga %s was started concurrently", sagaID)
+			return nil
+		}
+
+		return err
+	}
+
+	log.Printf("Saga %s started for order %s", sagaID, state.OrderID)
+
+	return nil
+}
+
+func (o *Orchestrator) handleReply(ctx context.Context, ev models.Event) error {
+	def, succeeded, ok := o.matchReply(ev.Event)
+	if !ok {
+		log.Printf("Ignoring event %s of unexpected type %s", ev.EventID, ev.Event)
+		return nil
+	}
+
+	state, err := o.store.Get(ctx, ev.SagaID)
+	if errors.Is(err, ErrSagaNotFound) {
+		log.Printf("Ignoring %s for unknown saga %s", ev.Event, ev.SagaID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if state.IsTerminal() || state.CurrentStep != def.Step {
+		log.Printf("Ignoring stale %s for saga %s at step %s (%s)", ev.Event, ev.SagaID, state.CurrentStep, state.Status)
+		return nil
+	}
+
+	var reply stepReply
+	if err := sonic.Unmarshal(ev.Payload, &reply); err != nil {
+		return kafka.Fatal(fmt.Errorf("failed to decode %s reply for saga %s: %w", ev.Event, ev.SagaID, err))
+	}
+
+	state.UpdatedAt = time.Now().UTC()
+
+	if o.workflow.IsCompensation(def.Step) {
+		return o.handleCompensationReply(ctx, state, def, succeeded && reply.Success, reply.Message)
+	}
+
+	if !succeeded || !reply.Success {
+		log.Printf("Saga %s failed at step %s: %s", state.SagaID, def.Step, reply.Message)
+
+		return o.compensate(ctx, state, o.workflow.StepIndex(def.Step), fmt.Sprintf("%s failed: %s", def.Step, reply.Message))
+	}
+
+	data, err := state.OrderData()
+	if err != nil {
+		return err
+	}
+
+	// The charge or authorization reply carries the payment later steps and compensations refer to
+	if reply.PaymentID != "" {
+		data.PaymentID = reply.PaymentID
+
+		if err := state.SetOrderData(data); err != nil {
+			return err
+		}
+	}
+
+	// A cancelled saga undoes the step that just succeeded along with the ones before it
+	if data.CancelReason != "" {
+		log.Printf("Saga %s cancelled after step %s", state.SagaID, def.Step)
+
+		return o.compensate(ctx, state, o.workflow.StepIndex(def.Step)+1, data.CancelReason)
+	}
+
+	next := o.workflow.StepIndex(def.Step) + 1
+	if next == len(o.workflow.Steps) {
+		// Completion commands go out first: if sending fails the reply is redelivered and they are
+		// sent again, which is fine because they are idempotent
+		state.Status = SagaStatusCompleted
+
+		if err := o.moveOrder(ctx, state, models.OrderCompleted, "saga completed"); err != nil {
+			return err
+		}
+
+		if err := o.transition(ctx, state, true, o.workflow.OnComplete...); err != nil {
+			return err
+		}
+
+		log.Printf("Saga %s completed", state.SagaID)
+
+		return nil
+	}
+
+	// The order stops being cancellable before the pivot command can go out, see CancelOrder
+	if o.workflow.Steps[next].Pivot {
+		if err := o.moveOrder(ctx, state, models.OrderFinalizing, fmt.Sprintf("%s started", o.workflow.Steps[next].Step)); err != nil {
+			return err
+		}
+	}
+
+	// Claim the transition before sending, so a replica that lost the race never emits the command
+	state.CurrentStep = o.workflow.Steps[next].Step
+	state.Attempts = 1
+
+	return o.transition(ctx, state, false, o.workflow.Steps[next])
+}
+
+// handleCancel records the cancellation of a saga that is still moving forward. The command of
+// the current step is already out, so the saga stops once its reply arrives: a success is undone
+// with the steps before it, a failure compensates as usual. Either way the saga ends CANCELLED.
+// Sagas that completed, are already being undone or sent their pivot command ignore the
+// cancellation, since undoing them would leave the customer charged for nothing
+func (o *Orchestrator) handleCancel(ctx context.Context, ev models.Event) error {
+	command, err := models.DecodePayload[models.CancelOrderCommand](ev)
+	if err != nil {
+		return kafka.Fatal(fmt.Errorf("failed to decode cancellation of saga %s: %w", ev.SagaID, err))
+	}
+
+	state, err := o.store.Get(ctx, ev.SagaID)
+	if errors.Is(err, ErrSagaNotFound) {
+		log.Printf("Ignoring %s for unknown saga %s", ev.Event, ev.SagaID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if state.Status != SagaStatusStarted && state.Status != SagaStatusInProgress {
+		log.Printf("Rejecting cancellation of saga %s, it is %s", state.SagaID, state.Status)
+		return nil
+	}
+
+	if o.workflow.PastPivot(state.CurrentStep) {
+		log.Printf("Rejecting cancellation of saga %s, it is past its pivot at step %s", state.SagaID, state.CurrentStep)
+		return nil
+	}
+
+	data, err := state.OrderData()
+	if err != nil {
+		return err
+	}
+
+	if data.CancelReason != "" {
+		return nil
+	}
+
+	data.CancelReason = command.Reason
+	if data.CancelReason == "" {
+		data.CancelReason = "cancelled by customer"
+	}
+
+	if err := state.SetOrderData(data); err != nil {
+		return err
+	}
+
+	state.UpdatedAt = time.Now().UTC()
+
+	if err := o.store.Update(ctx, state); err != nil {
+		return err
+	}
+
+	log.Printf("Saga %s will be cancelled after step %s: %s", state.SagaID, state.CurrentStep, data.CancelReason)
+
+	return nil
+}
+
+// handleHoldExpired stops a saga whose stock hold was reaped before it completed. The released
+// stock is gone, so the saga is compensated from its current step. A saga past its pivot cannot
+// be undone anymore and finishes instead, its confirmation then finds the hold gone and is
+// dead-lettered for an operator, see inventory.Service
+func (o *Orchestrator) handleHoldExpired(ctx context.Context, ev models.Event) error {
+	state, err := o.store.Get(ctx, ev.SagaID)
+	if errors.Is(err, ErrSagaNotFound) {
+		log.Printf("Ignoring %s for unknown saga %s", ev.Event, ev.SagaID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if state.Status != SagaStatusStarted && state.Status != SagaStatusInProgress {
+		return nil
+	}
+
+	if o.workflow.PastPivot(state.CurrentStep) {
+		log.Printf("Saga %s lost its inventory hold past its pivot at step %s, leaving it to finish", state.SagaID, state.CurrentStep)
+		return nil
+	}
+
+	log.Printf("Saga %s lost its inventory hold at step %s", state.SagaID, state.CurrentStep)
+
+	state.UpdatedAt = time.Now().UTC()
+
+	return o.compensate(ctx, state, o.workflow.StepIndex(state.CurrentStep), "inventory hold expired")
+}
+
+// compensate records reason and starts undoing the steps completed before the step at index
+// from. A saga with nothing to undo ends as FAILED straight away, or CANCELLED when it was
+// cancelled
+func (o *Orchestrator) compensate(ctx context.Context, state *SagaState, from int, reason string) error {
+	state.FailureReason = reason
+
+	comp, ok := o.workflow.NextCompensation(from)
+	if !ok {
+		data, err := state.OrderData()
+		if err != nil {
+			return err
+		}
+
+		if data.CancelReason != "" {
+			return o.finishCompensation(ctx, state, data)
+		}
+
+		state.Status = SagaStatusFailed
+
+		if err := o.moveOrder(ctx, state, models.OrderFailed, reason); err != nil {
+			return err
+		}
+
+		return o.store.Update(ctx, state)
+	}
+
+	state.Status = SagaStatusCompensating
+	state.CurrentStep = comp.Step
+	state.Attempts = 1
+
+	if err := o.transition(ctx, state, false, comp); err != nil {
+		return err
+	}
+
+	log.Printf("Saga %s compensating with %s", state.SagaID, comp.Step)
+
+	return nil
+}
+
+// handleCompensationReply moves to the previous compensation, or ends the saga as COMPENSATED
+// once everything was undone. A failed compensation leaves the saga FAILED for manual repair
+func (o *Orchestrator) handleCompensationReply(ctx context.Context, state *SagaState, def StepDefinition, succeeded bool, message string) error {
+	if !succeeded {
+		state.Status = SagaStatusFailed
+		state.FailureReason = fmt.Sprintf("%s; %s failed: %s", state.FailureReason, def.Step, message)
+
+		if err := o.moveOrder(ctx, state, models.OrderFailed, state.FailureReason); err != nil {
+			return err
+		}
+
+		if err := o.store.Update(ctx, state); err != nil {
+			return err
+		}
+
+		log.Printf("Saga %s compensation %s failed, manual intervention required: %s", state.SagaID, def.Step, message)
+
+		return nil
+	}
+
+	data, err := state.OrderData()
+	if err != nil {
+		return err
+	}
+
+	if def.Step == StepCompensatePayment {
+		data.Refunded = true
+
+		if err := state.SetOrderData(data); err != nil {
+			return err
+		}
+	}
+
+	next, ok := o.workflow.NextCompensation(o.workflow.compensatedIndex(def.Step) - 1)
+	if !ok {
+		return o.finishCompensation(ctx, state, data)
+	}
+
+	state.CurrentStep = next.Step
+	state.Attempts = 1
+
+	return o.transition(ctx, state, false, next)
+}
+
+// finishCompensation ends a saga with nothing left to undo as COMPENSATED, or CANCELLED when the
+// customer cancelled it, and cancels its order
+func (o *Orchestrator) finishCompensation(ctx context.Context, state *SagaState, data OrderSagaData) error {
+	state.Status = SagaStatusCompensated
+	if data.CancelReason != "" {
+		state.Status = SagaStatusCancelled
+	}
+
+	if err := o.moveOrder(ctx, state, models.OrderCancelled, state.FailureReason); err != nil {
+		return err
+	}
+
+	// Like completion commands, these go out first and are sent again if the reply is redelivered
+	if err := o.transition(ctx, state, true, o.workflow.OnCompensated...); err != nil {
+		return err
+	}
+
+	log.Printf("Saga %s %s", state.SagaID, strings.ToLower(string(state.Status)))
+
+	return nil
+}
+
+// moveOrder moves the order of state to status to. It runs before the saga update that goes
+// with it, so a move whose update failed is driven again when the reply is redelivered, which
+// leaves an order already in status to alone. A move the order status does not allow cannot
+// succeed on a retry, so it is fatal
+func (o *Orchestrator) moveOrder(ctx context.Context, state *SagaState, to models.OrderStatus, reason string) error {
+	err := o.orders.Transition(ctx, state.SagaID, state.OrderID, to, reason)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		return kafka.Fatal(fmt.Errorf("saga %s cannot move order %s: %w", state.SagaID, state.OrderID, err))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move order %s of saga %s to %s: %w", state.OrderID, state.SagaID, to, err)
+	}
+
+	return nil
+}
+
+// matchReply finds the step a reply event type belongs to and whether it reports success
+func (o *Orchestrator) matchReply(eventType models.EventType) (StepDefinition, bool, bool) {
+	for _, def := range o.workflow.Steps {
+		switch eventType {
+		case def.SuccessEvent:
+			return def, true, true
+		case def.FailureEvent:
+			return def, false, true
+		}
+	}
+
+	for _, def := range o.workflow.Compensations {
+		switch eventType {
+		case def.SuccessEvent:
+			return def, true, true
+		case def.FailureEvent:
+			return def, false, true
+		}
+	}
+
+	return StepDefinition{}, false, false
+}
+
+// transition stores state and sends the commands of defs. With an OutboxStore both happen in one
+// transaction. Otherwise the commands are published before the update when sendFirst is set,
+// which suits idempotent commands whose trigger is redelivered if the update fails, and after it
+// when the update claims the transition, so a replica that lost the race never sends them
+func (o *Orchestrator) transition(ctx context.Context, state *SagaState, sendFirst bool, defs ...StepDefinition) error {
+	commands := make([]outbox.Message, 0, len(defs))
+
+	for _, def := range defs {
+		msg, err := o.command(state, def)
+		if err != nil {
+			return err
+		}
+
+		commands = append(commands, msg)
+	}
+
+	if store, ok := o.store.(OutboxStore); ok {
+		return store.UpdateWithCommands(ctx, state, commands...)
+	}
+
+	if sendFirst {
+		if err := o.send(ctx, commands); err != nil {
+			return err
+		}
+	}
+
+	if err := o.store.Update(ctx, state); err != nil {
+		return err
+	}
+
+	if !sendFirst {
+		return o.send(ctx, commands)
+	}
+
+	return nil
+}
+
+// send publishes commands in order
+func (o *Orchestrator) send(ctx context.Context, commands []outbox.Message) error {
+	for _, msg := range commands {
+		if err := o.publisher.PublishEvent(ctx, msg.Topic, msg.Key, msg.Event); err != nil {
+			return fmt.Errorf("failed to send %s for saga %s: %w", msg.Event.Event, msg.Event.SagaID, err)
+		}
+	}
+
+	return nil
+}
+
+// command builds the command for def on behalf of state
+func (o *Orchestrator) command(state *SagaState, def StepDefinition) (outbox.Message, error) {
+	data, err := state.OrderData()
+	if err != nil {
+		return outbox.Message{}, err
+	}
+
+	command, err := buildCommand(def.Step, state, data)
+	if err != nil {
+		return outbox.Message{}, err
+	}
+
+	ev, err := models.NewEvent(def.CommandEvent, state.SagaID, state.OrderID, command)
+	if err != nil {
+		return outbox.Message{}, err
+	}
+
+	return outbox.Message{Topic: def.CommandTopic, Key: []byte(state.SagaID.String()), Event: ev}, nil
+}
+
+func buildCommand(step SagaStep, state *SagaState, data OrderSagaData) (any, error) {
+	switch step {
+	case StepReserveInventory:
+		return models.ReserveInventoryCommand{Items: data.Items}, nil
+	case StepProcessPayment:
+		return models.ProcessPaymentCommand{Amount: data.Amount, CustomerID: data.CustomerID}, nil
+	case StepSendNotification:
+		return models.SendNotificationCommand{
+			CustomerID: data.CustomerID,
+			OrderID:    state.OrderID,
+			PublicID:   data.PublicID,
+			Kind:       models.NotificationOrderConfirmed,
+			Amount:     data.Amount,
+		}, nil
+	case StepNotifyCancellation:
+		kind := models.NotificationOrderCancelled
+		if data.Refunded {
+			kind = models.NotificationRefundIssued
+		}
+
+		reason := data.CancelReason
+		if reason == "" {
+			reason = state.FailureReason
+		}
+
+		return models.SendNotificationCommand{
+			CustomerID: data.CustomerID,
+			OrderID:    state.OrderID,
+			PublicID:   data.PublicID,
+			Kind:       kind,
+			Amount:     data.Amount,
+			Reason:     reason,
+		}, nil
+	case StepCompensateInventory:
+		return models.ReleaseInventoryCommand{Items: data.Items}, nil
+	case StepConfirmInventory:
+		return models.ConfirmInventoryCommand{}, nil
+	case StepCompensatePayment:
+		return models.RefundPaymentCommand{PaymentID: data.PaymentID, Amount: data.Amount}, nil
+	case StepAuthorizePayment:
+		return models.AuthorizePaymentCommand{Amount: data.Amount, CustomerID: data.CustomerID}, nil
+	case StepCapturePayment:
+		return models.CapturePaymentCommand{PaymentID: data.PaymentID, Amount: data.Amount}, nil
+	case StepVoidAuthorization:
+		return models.VoidAuthorizationCommand{PaymentID: data.PaymentID}, nil
+	default:
+		return nil, fmt.Errorf("no command defined for step %s", step)
+	}
+}
@@ -0,0 +1,817 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/kafka"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+type publishedEvent struct {
+	topic string
+	event models.Event
+}
+
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []publishedEvent
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, topic string, key []byte, ev models.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, publishedEvent{topic: topic, event: ev})
+
+	return nil
+}
+
+func (p *fakePublisher) last(t *testing.T) publishedEvent {
+	t.Helper()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.events) == 0 {
+		t.Fatalf("Expected a published event, got none")
+	}
+
+	return p.events[len(p.events)-1]
+}
+
+// fakeOrders keeps order statuses in memory, starting every order as PENDING
+type fakeOrders struct {
+	mu     sync.Mutex
+	orders map[uuid.UUID]*models.Order
+}
+
+func newFakeOrders() *fakeOrders {
+	return &fakeOrders{orders: make(map[uuid.UUID]*models.Order)}
+}
+
+func (f *fakeOrders) Transition(ctx context.Context, sagaID, orderID uuid.UUID, to models.OrderStatus, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, ok := f.orders[orderID]
+	if !ok {
+		order = &models.Order{ID: orderID, Status: models.OrderPending}
+		f.orders[orderID] = order
+	}
+
+	if order.Status == to {
+		return nil
+	}
+
+	return order.Transition(to, reason)
+}
+
+// history returns the statuses orderID moved through
+func (f *fakeOrders) history(orderID uuid.UUID) []models.OrderStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var statuses []models.OrderStatus
+
+	if order, ok := f.orders[orderID]; ok {
+		for _, change := range order.History {
+			statuses = append(statuses, change.To)
+		}
+	}
+
+	return statuses
+}
+
+func mustEvent(t *testing.T, eventType models.EventType, sagaID, orderID uuid.UUID, payload any) models.Event {
+	t.Helper()
+
+	ev, err := models.NewEvent(eventType, sagaID, orderID, payload)
+	if err != nil {
+		t.Fatalf("NewEvent() failed: %v", err)
+	}
+
+	return ev
+}
+
+func mustGet(t *testing.T, store SagaStore, sagaID uuid.UUID) *SagaState {
+	t.Helper()
+
+	state, err := store.Get(context.Background(), sagaID)
+	if err != nil {
+		t.Fatalf("Get(%s) failed: %v", sagaID, err)
+	}
+
+	return state
+}
+
+func startOrderSaga(t *testing.T, o *Orchestrator) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+
+	sagaID, orderID := uuid.New(), uuid.New()
+	order := models.OrderCreatedEvent{
+		PublicID:   "US-7KQ3-9XMD",
+		CustomerID: "customer-1",
+		Items:      []models.InventoryItem{{ItemID: uuid.New(), Quantity: 2}},
+		Amount:     models.Money{Amount: 4250, Currency: "USD"},
+	}
+
+	if err := o.HandleEvent(context.Background(), mustEvent(t, models.EventOrderCreated, sagaID, orderID, order)); err != nil {
+		t.Fatalf("HandleEvent(ORDER_CREATED) failed: %v", err)
+	}
+
+	return sagaID, orderID
+}
+
+func TestOrchestratorHappyPath(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+	ctx := context.Background()
+
+	sagaID, orderID := startOrderSaga(t, o)
+
+	sent := publisher.last(t)
+	if sent.topic != "inventory.commands" || sent.event.Event != models.EventReserveInventory {
+		t.Fatalf("Expected RESERVE_INVENTORY on inventory.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing}) {
+		t.Errorf("Expected the order PROCESSING once the saga started, got %v", history)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusInProgress || state.CurrentStep != StepReserveInventory {
+		t.Fatalf("Expected IN_PROGRESS at RESERVE_INVENTORY, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	replies := []struct {
+		reply     models.EventType
+		payload   any
+		nextTopic string
+		nextEvent models.EventType
+	}{
+		{models.EventInventoryReserved, models.InventoryReply{Success: true}, "payment.commands", models.EventProcessPayment},
+		{models.EventPaymentProcessed, models.PaymentReply{Success: true, PaymentID: "pay-1"}, "notification.commands", models.EventSendNotification},
+	}
+
+	for _, r := range replies {
+		if err := o.HandleEvent(ctx, mustEvent(t, r.reply, sagaID, orderID, r.payload)); err != nil {
+			t.Fatalf("HandleEvent(%s) failed: %v", r.reply, err)
+		}
+
+		sent := publisher.last(t)
+		if sent.topic != r.nextTopic || sent.event.Event != r.nextEvent {
+			t.Fatalf("Expected %s on %s after %s, got %s on %s", r.nextEvent, r.nextTopic, r.reply, sent.event.Event, sent.topic)
+		}
+	}
+
+	var payment models.ProcessPaymentCommand
+	if err := sonic.Unmarshal(publisher.events[1].event.Payload, &payment); err != nil {
+		t.Fatalf("Failed to decode payment command: %v", err)
+	}
+	if payment.Amount != (models.Money{Amount: 4250, Currency: "USD"}) || payment.CustomerID != "customer-1" {
+		t.Errorf("Unexpected payment command %+v", payment)
+	}
+
+	if err := o.HandleEvent(ctx, mustEvent(t, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})); err != nil {
+		t.Fatalf("HandleEvent(NOTIFICATION_SENT) failed: %v", err)
+	}
+
+	state = mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompleted {
+		t.Fatalf("Expected saga COMPLETED, got %s", state.Status)
+	}
+
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderCompleted}) {
+		t.Errorf("Expected the order COMPLETED with the saga, got %v", history)
+	}
+
+	if sent := publisher.last(t); sent.topic != "inventory.commands" || sent.event.Event != models.EventConfirmInventory {
+		t.Errorf("Expected CONFIRM_INVENTORY on inventory.commands after completion, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	var data OrderSagaData
+	if err := sonic.Unmarshal(state.Payload, &data); err != nil {
+		t.Fatalf("Failed to decode saga payload: %v", err)
+	}
+	if data.PaymentID != "pay-1" {
+		t.Errorf("Expected payment ID 'pay-1', got '%s'", data.PaymentID)
+	}
+}
+
+func TestOrchestratorFailureReply(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+
+	err := o.HandleEvent(context.Background(), mustEvent(t, models.EventInventoryFailed, sagaID, orderID, models.InventoryReply{Message: "out of stock"}))
+	if err != nil {
+		t.Fatalf("HandleEvent(INVENTORY_FAILED) failed: %v", err)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusFailed {
+		t.Fatalf("Expected saga FAILED, got %s", state.Status)
+	}
+	if state.FailureReason == "" {
+		t.Errorf("Expected a failure reason to be recorded")
+	}
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderFailed}) {
+		t.Errorf("Expected the order FAILED with the saga, got %v", history)
+	}
+	if len(publisher.events) != 1 {
+		t.Errorf("Expected no further commands after failure, got %d events", len(publisher.events))
+	}
+}
+
+func TestOrchestratorRejectsIllegalOrderTransition(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+
+	// The order was failed behind the saga's back, so it can no longer complete
+	orders.orders[orderID].Status = models.OrderFailed
+
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+
+	err := o.HandleEvent(context.Background(), mustEvent(t, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true}))
+	if !errors.Is(err, models.ErrInvalidTransition) || kafka.IsRetryable(err) {
+		t.Fatalf("Expected a fatal ErrInvalidTransition, got %v", err)
+	}
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusInProgress {
+		t.Errorf("Expected the saga to stay IN_PROGRESS, got %s", state.Status)
+	}
+}
+
+func TestOrchestratorRejectsOrderWithoutSagaID(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+
+	order := models.OrderCreatedEvent{
+		PublicID:   "US-7KQ3-9XMD",
+		CustomerID: "customer-1",
+		Items:      []models.InventoryItem{{ItemID: uuid.New(), Quantity: 1}},
+		Amount:     models.Money{Amount: 1000, Currency: "USD"},
+	}
+
+	err := o.HandleEvent(context.Background(), mustEvent(t, models.EventOrderCreated, uuid.Nil, uuid.New(), order))
+	if err == nil || kafka.IsRetryable(err) {
+		t.Fatalf("Expected a fatal error, got %v", err)
+	}
+
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no commands to be sent, got %d", len(publisher.events))
+	}
+}
+
+func TestOrchestratorIgnoresStaleReply(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+
+	err := o.HandleEvent(context.Background(), mustEvent(t, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true}))
+	if err != nil {
+		t.Fatalf("HandleEvent(PAYMENT_PROCESSED) failed: %v", err)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.CurrentStep != StepReserveInventory || state.Status != SagaStatusInProgress {
+		t.Fatalf("Expected saga to stay at RESERVE_INVENTORY, got %s (%s)", state.CurrentStep, state.Status)
+	}
+	if len(publisher.events) != 1 {
+		t.Errorf("Expected no command for a stale reply, got %d events", len(publisher.events))
+	}
+}
+
+func reply(t *testing.T, o *Orchestrator, eventType models.EventType, sagaID, orderID uuid.UUID, payload any) {
+	t.Helper()
+
+	if err := o.HandleEvent(context.Background(), mustEvent(t, eventType, sagaID, orderID, payload)); err != nil {
+		t.Fatalf("HandleEvent(%s) failed: %v", eventType, err)
+	}
+}
+
+func TestOrchestratorCompensatesPaymentFailure(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentFailed, sagaID, orderID, models.PaymentReply{Message: "card declined"})
+
+	sent := publisher.last(t)
+	if sent.topic != "inventory.commands" || sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY on inventory.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	var release models.ReleaseInventoryCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &release); err != nil {
+		t.Fatalf("Failed to decode release command: %v", err)
+	}
+	if len(release.Items) != 1 || release.Items[0].Quantity != 2 {
+		t.Errorf("Expected reserved items to be released, got %+v", release.Items)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompensating || state.CurrentStep != StepCompensateInventory {
+		t.Fatalf("Expected COMPENSATING at COMPENSATE_INVENTORY, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	reply(t, o, models.EventInventoryReleased, sagaID, orderID, models.InventoryReply{Success: true})
+
+	state = mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompensated {
+		t.Fatalf("Expected saga COMPENSATED, got %s", state.Status)
+	}
+
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderCancelled}) {
+		t.Errorf("Expected the order CANCELLED once compensated, got %v", history)
+	}
+	if reason := orders.orders[orderID].History[1].Reason; !strings.Contains(reason, "card declined") {
+		t.Errorf("Expected the cancellation to carry the failure reason, got %q", reason)
+	}
+	if reason := lastNotification(t, publisher).Reason; !strings.Contains(reason, "card declined") {
+		t.Errorf("Expected the customer to be told about the failure, got %q", reason)
+	}
+}
+
+func TestOrchestratorCompensatesInReverseOrder(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+	reply(t, o, models.EventNotificationFailed, sagaID, orderID, models.NotificationReply{Message: "smtp down"})
+
+	sent := publisher.last(t)
+	if sent.topic != "payment.commands" || sent.event.Event != models.EventRefundPayment {
+		t.Fatalf("Expected REFUND_PAYMENT on payment.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	var refund models.RefundPaymentCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &refund); err != nil {
+		t.Fatalf("Failed to decode refund command: %v", err)
+	}
+	if refund.PaymentID != "pay-1" || refund.Amount != (models.Money{Amount: 4250, Currency: "USD"}) {
+		t.Errorf("Unexpected refund command %+v", refund)
+	}
+
+	reply(t, o, models.EventPaymentRefunded, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+
+	sent = publisher.last(t)
+	if sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY after refund, got %s", sent.event.Event)
+	}
+
+	reply(t, o, models.EventInventoryReleased, sagaID, orderID, models.InventoryReply{Success: true})
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompensated {
+		t.Fatalf("Expected saga COMPENSATED, got %s", state.Status)
+	}
+
+	if kind := lastNotification(t, publisher).Kind; kind != models.NotificationRefundIssued {
+		t.Errorf("Expected a REFUND_ISSUED notification, got %s", kind)
+	}
+}
+
+// lastNotification returns the last command, which must be a notification
+func lastNotification(t *testing.T, publisher *fakePublisher) models.SendNotificationCommand {
+	t.Helper()
+
+	sent := publisher.last(t)
+	if sent.topic != "notification.commands" || sent.event.Event != models.EventSendNotification {
+		t.Fatalf("Expected SEND_NOTIFICATION on notification.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	var cmd models.SendNotificationCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &cmd); err != nil {
+		t.Fatalf("Failed to decode notification command: %v", err)
+	}
+
+	return cmd
+}
+
+func TestOrchestratorFailedCompensation(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+	reply(t, o, models.EventNotificationFailed, sagaID, orderID, models.NotificationReply{Message: "smtp down"})
+	reply(t, o, models.EventPaymentRefundFailed, sagaID, orderID, models.PaymentReply{Message: "gateway unavailable"})
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusFailed || state.CurrentStep != StepCompensatePayment {
+		t.Fatalf("Expected FAILED at COMPENSATE_PAYMENT, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	if sent := publisher.last(t); sent.event.Event != models.EventRefundPayment {
+		t.Errorf("Expected no command after the failed refund, got %s", sent.event.Event)
+	}
+}
+
+func TestOrchestratorCompensatesExpiredHold(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventInventoryHoldExpired, sagaID, orderID, models.InventoryHoldExpiredEvent{})
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompensating || state.CurrentStep != StepCompensateInventory {
+		t.Fatalf("Expected COMPENSATING at COMPENSATE_INVENTORY, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	// A late payment reply no longer moves the saga forward
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventReleaseInventory {
+		t.Errorf("Expected RELEASE_INVENTORY to be the last command, got %s", sent.event.Event)
+	}
+}
+
+func TestOrchestratorTwoPhasePaymentHappyPath(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+
+	if sent := publisher.last(t); sent.topic != "payment.commands" || sent.event.Event != models.EventAuthorizePayment {
+		t.Fatalf("Expected AUTHORIZE_PAYMENT on payment.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	sent := publisher.last(t)
+	if sent.topic != "payment.commands" || sent.event.Event != models.EventCapturePayment {
+		t.Fatalf("Expected CAPTURE_PAYMENT on payment.commands, got %s on %s", sent.event.Event, sent.topic)
+	}
+
+	var capture models.CapturePaymentCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &capture); err != nil {
+		t.Fatalf("Failed to decode capture command: %v", err)
+	}
+	if capture.PaymentID != "auth-1" || capture.Amount != (models.Money{Amount: 4250, Currency: "USD"}) {
+		t.Errorf("Unexpected capture command %+v", capture)
+	}
+
+	reply(t, o, models.EventPaymentCaptured, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCompleted {
+		t.Fatalf("Expected saga COMPLETED, got %s", state.Status)
+	}
+
+	if sent := publisher.last(t); sent.event.Event != models.EventConfirmInventory {
+		t.Errorf("Expected CONFIRM_INVENTORY after capture, got %s", sent.event.Event)
+	}
+}
+
+func TestOrchestratorVoidsAuthorizationInsteadOfRefund(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventNotificationFailed, sagaID, orderID, models.NotificationReply{Message: "smtp down"})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY first, got %s", sent.event.Event)
+	}
+
+	reply(t, o, models.EventInventoryReleased, sagaID, orderID, models.InventoryReply{Success: true})
+
+	sent := publisher.last(t)
+	if sent.event.Event != models.EventVoidAuthorization {
+		t.Fatalf("Expected VOID_AUTHORIZATION after the release, got %s", sent.event.Event)
+	}
+
+	var void models.VoidAuthorizationCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &void); err != nil {
+		t.Fatalf("Failed to decode void command: %v", err)
+	}
+	if void.PaymentID != "auth-1" {
+		t.Errorf("Expected void of 'auth-1', got '%s'", void.PaymentID)
+	}
+
+	reply(t, o, models.EventAuthorizationVoided, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCompensated {
+		t.Fatalf("Expected saga COMPENSATED, got %s", state.Status)
+	}
+
+	if kind := lastNotification(t, publisher).Kind; kind != models.NotificationOrderCancelled {
+		t.Errorf("Expected an ORDER_CANCELLED notification, got %s", kind)
+	}
+
+	for _, p := range publisher.events {
+		if p.event.Event == models.EventRefundPayment {
+			t.Errorf("Expected no refund in the two-phase workflow")
+		}
+	}
+}
+
+// outboxMemoryStore is a MemoryStore that queues commands like the Postgres store does
+type outboxMemoryStore struct {
+	*MemoryStore
+	queued []outbox.Message
+}
+
+func (s *outboxMemoryStore) UpdateWithCommands(ctx context.Context, state *SagaState, commands ...outbox.Message) error {
+	if err := s.MemoryStore.Update(ctx, state); err != nil {
+		return err
+	}
+
+	s.queued = append(s.queued, commands...)
+
+	return nil
+}
+
+func TestOrchestratorQueuesCommandsWithOutboxStore(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := &outboxMemoryStore{MemoryStore: NewMemoryStore()}
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, newFakeOrders())
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected nothing to be published directly, got %d events", len(publisher.events))
+	}
+
+	if len(store.queued) != 2 {
+		t.Fatalf("Expected 2 queued commands, got %d", len(store.queued))
+	}
+
+	if cmd := store.queued[1]; cmd.Topic != "inventory.commands" || cmd.Event.Event != models.EventReserveInventory || string(cmd.Key) != sagaID.String() {
+		t.Errorf("Expected RESERVE_INVENTORY keyed by saga on inventory.commands, got %s on %s", cmd.Event.Event, cmd.Topic)
+	}
+
+	// A reply applied on a stale version loses the race and must not queue anything
+	state := mustGet(t, store, sagaID)
+	state.Version--
+
+	if err := o.transition(context.Background(), state, false, GetOrderWorkflow().Steps[2]); err != ErrVersionConflict {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	if len(store.queued) != 2 {
+		t.Errorf("Expected no command queued by a conflicting update, got %d", len(store.queued))
+	}
+}
+
+func cancel(t *testing.T, o *Orchestrator, sagaID, orderID uuid.UUID, reason string) {
+	t.Helper()
+
+	reply(t, o, models.EventCancelOrder, sagaID, orderID, models.CancelOrderCommand{Reason: reason})
+}
+
+func TestOrchestratorCancelsMidSaga(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	cancel(t, o, sagaID, orderID, "changed my mind")
+
+	// The payment command is already out, so the saga waits for its reply
+	if len(publisher.events) != 2 {
+		t.Fatalf("Expected no command on cancellation, got %d events", len(publisher.events))
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusInProgress || state.CurrentStep != StepProcessPayment {
+		t.Fatalf("Expected IN_PROGRESS at PROCESS_PAYMENT, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	// The charge went through, so it is refunded instead of moving on to the notification
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+
+	sent := publisher.last(t)
+	if sent.event.Event != models.EventRefundPayment {
+		t.Fatalf("Expected REFUND_PAYMENT after the cancelled charge, got %s", sent.event.Event)
+	}
+
+	var refund models.RefundPaymentCommand
+	if err := sonic.Unmarshal(sent.event.Payload, &refund); err != nil {
+		t.Fatalf("Failed to decode refund command: %v", err)
+	}
+	if refund.PaymentID != "pay-1" {
+		t.Errorf("Expected the cancelled charge to be refunded, got %+v", refund)
+	}
+
+	reply(t, o, models.EventPaymentRefunded, sagaID, orderID, models.PaymentReply{Success: true})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY after the refund, got %s", sent.event.Event)
+	}
+
+	reply(t, o, models.EventInventoryReleased, sagaID, orderID, models.InventoryReply{Success: true})
+
+	state = mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCancelled || state.FailureReason != "changed my mind" {
+		t.Fatalf("Expected saga CANCELLED for 'changed my mind', got %s (%s)", state.Status, state.FailureReason)
+	}
+
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderCancelled}) {
+		t.Errorf("Expected the order CANCELLED, got %v", history)
+	}
+
+	notification := lastNotification(t, publisher)
+	if notification.Kind != models.NotificationRefundIssued {
+		t.Errorf("Expected the customer to be told about the refund, got %s", notification.Kind)
+	}
+	if notification.Reason != "changed my mind" {
+		t.Errorf("Expected the cancellation reason in the notification, got %q", notification.Reason)
+	}
+	if notification.PublicID != "US-7KQ3-9XMD" {
+		t.Errorf("Expected the notification to carry the public order ID, got %q", notification.PublicID)
+	}
+}
+
+func TestOrchestratorCancelsWithNothingToUndo(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	cancel(t, o, sagaID, orderID, "")
+	reply(t, o, models.EventInventoryFailed, sagaID, orderID, models.InventoryReply{Message: "out of stock"})
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCancelled {
+		t.Fatalf("Expected saga CANCELLED, got %s", state.Status)
+	}
+
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderCancelled}) {
+		t.Errorf("Expected the order CANCELLED, got %v", history)
+	}
+}
+
+func TestOrchestratorRejectsCancellingCompletedSaga(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentProcessed, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "pay-1"})
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	sent := len(publisher.events)
+
+	cancel(t, o, sagaID, orderID, "too late")
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCompleted {
+		t.Errorf("Expected saga to stay COMPLETED, got %s", state.Status)
+	}
+	if len(publisher.events) != sent {
+		t.Errorf("Expected no commands for a rejected cancellation, got %d more", len(publisher.events)-sent)
+	}
+	if history := orders.history(orderID); !slices.Equal(history, []models.OrderStatus{models.OrderProcessing, models.OrderCompleted}) {
+		t.Errorf("Expected the order to stay COMPLETED, got %v", history)
+	}
+}
+
+func TestOrchestratorRejectsCancellingDuringCapture(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventCapturePayment {
+		t.Fatalf("Expected CAPTURE_PAYMENT in flight, got %s", sent.event.Event)
+	}
+
+	// Voiding a captured payment fails, so a cancellation now would leave the customer charged
+	// without stock
+	cancel(t, o, sagaID, orderID, "too late")
+	reply(t, o, models.EventPaymentCaptured, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCompleted {
+		t.Fatalf("Expected saga COMPLETED, got %s", state.Status)
+	}
+
+	for _, sent := range publisher.events {
+		if sent.event.Event == models.EventVoidAuthorization || sent.event.Event == models.EventReleaseInventory {
+			t.Errorf("Expected no compensation after the capture, got %s", sent.event.Event)
+		}
+	}
+
+	expected := []models.OrderStatus{models.OrderProcessing, models.OrderFinalizing, models.OrderCompleted}
+	if history := orders.history(orderID); !slices.Equal(history, expected) {
+		t.Errorf("Expected order history %v, got %v", expected, history)
+	}
+}
+
+func TestOrchestratorFinishesCaptureAfterHoldExpired(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	// Voiding now would race the capture, the customer could be charged for a failed order
+	reply(t, o, models.EventInventoryHoldExpired, sagaID, orderID, models.InventoryHoldExpiredEvent{})
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusInProgress || state.CurrentStep != StepCapturePayment {
+		t.Fatalf("Expected IN_PROGRESS at CAPTURE_PAYMENT, got %s at %s", state.Status, state.CurrentStep)
+	}
+
+	reply(t, o, models.EventPaymentCaptured, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusCompleted {
+		t.Fatalf("Expected saga COMPLETED, got %s", state.Status)
+	}
+
+	for _, sent := range publisher.events {
+		if sent.event.Event == models.EventVoidAuthorization || sent.event.Event == models.EventReleaseInventory {
+			t.Errorf("Expected no compensation past the pivot, got %s", sent.event.Event)
+		}
+	}
+
+	if sent := publisher.last(t); sent.event.Event != models.EventConfirmInventory {
+		t.Errorf("Expected CONFIRM_INVENTORY to be the last command, got %s", sent.event.Event)
+	}
+}
+
+func TestOrchestratorCancelsBeforeCapture(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	orders := newFakeOrders()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, orders)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	cancel(t, o, sagaID, orderID, "changed my mind")
+
+	// The notification reply would move on to the capture, the cancellation stops the saga first
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY instead of the capture, got %s", sent.event.Event)
+	}
+
+	reply(t, o, models.EventInventoryReleased, sagaID, orderID, models.InventoryReply{Success: true})
+
+	if sent := publisher.last(t); sent.event.Event != models.EventVoidAuthorization {
+		t.Fatalf("Expected VOID_AUTHORIZATION after the release, got %s", sent.event.Event)
+	}
+
+	for _, sent := range publisher.events {
+		if sent.event.Event == models.EventCapturePayment {
+			t.Errorf("Expected the cancelled saga never to capture")
+		}
+	}
+
+	if history := orders.history(orderID); slices.Contains(history, models.OrderFinalizing) {
+		t.Errorf("Expected the order never to be FINALIZING, got %v", history)
+	}
+}
@@ -0,0 +1,161 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+	"github.com/mateusmlo/altimit-ecomm/internal/postgres"
+)
+
+// PostgresStore is an OutboxStore keeping sagas in the sagas table, so the commands of a
+// transition are queued in the outbox in the same transaction as the saga itself
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, sagaID uuid.UUID) (*SagaState, error) {
+	var data []byte
+
+	err := s.db.QueryRowContext(ctx, `SELECT state FROM sagas WHERE saga_id = $1`, sagaID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saga %s: %w", sagaID, err)
+	}
+
+	return decodeState(sagaID, data)
+}
+
+func (s *PostgresStore) Create(ctx context.Context, state *SagaState) error {
+	created := *state
+	created.Version = 1
+
+	data, err := sonic.Marshal(created)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO sagas (saga_id, status, version, state, updated_at) VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (saga_id) DO NOTHING`,
+		state.SagaID, state.Status, created.Version, data, state.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create saga %s: %w", state.SagaID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrSagaExists
+	}
+
+	state.Version = created.Version
+
+	return nil
+}
+
+func (s *PostgresStore) Update(ctx context.Context, state *SagaState) error {
+	return s.UpdateWithCommands(ctx, state)
+}
+
+func (s *PostgresStore) UpdateWithCommands(ctx context.Context, state *SagaState, commands ...outbox.Message) error {
+	updated := *state
+	updated.Version = state.Version + 1
+
+	data, err := sonic.Marshal(updated)
+	if err != nil {
+		return err
+	}
+
+	err = postgres.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE sagas SET status = $1, version = $2, state = $3, updated_at = $4
+			 WHERE saga_id = $5 AND version = $6`,
+			state.Status, updated.Version, data, state.UpdatedAt, state.SagaID, state.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sagas WHERE saga_id = $1)`, state.SagaID).Scan(&exists); err != nil {
+				return err
+			}
+
+			if !exists {
+				return ErrSagaNotFound
+			}
+
+			return ErrVersionConflict
+		}
+
+		return outbox.Enqueue(ctx, tx, commands...)
+	})
+	if errors.Is(err, ErrSagaNotFound) || errors.Is(err, ErrVersionConflict) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update saga %s: %w", state.SagaID, err)
+	}
+
+	state.Version = updated.Version
+
+	return nil
+}
+
+func (s *PostgresStore) ListByStatus(ctx context.Context, status SagaStatus) ([]*SagaState, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT saga_id, state FROM sagas WHERE status = $1`, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s sagas: %w", status, err)
+	}
+
+	defer rows.Close()
+
+	var result []*SagaState
+
+	for rows.Next() {
+		var (
+			sagaID uuid.UUID
+			data   []byte
+		)
+
+		if err := rows.Scan(&sagaID, &data); err != nil {
+			return nil, err
+		}
+
+		state, err := decodeState(sagaID, data)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, state)
+	}
+
+	return result, rows.Err()
+}
+
+func decodeState(sagaID uuid.UUID, data []byte) (*SagaState, error) {
+	var state SagaState
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode saga %s: %w", sagaID, err)
+	}
+
+	return &state, nil
+}
@@ -0,0 +1,115 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+func newMockPostgresStore(t *testing.T) (*PostgresStore, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unmet expectations: %v", err)
+		}
+		db.Close()
+	})
+
+	return NewPostgresStore(db), mock
+}
+
+func testState() *SagaState {
+	return &SagaState{
+		SagaID:      uuid.New(),
+		OrderID:     uuid.New(),
+		Status:      SagaStatusInProgress,
+		CurrentStep: StepReserveInventory,
+		Payload:     []byte(`{}`),
+		Version:     3,
+		UpdatedAt:   time.Now().UTC(),
+	}
+}
+
+func TestPostgresStoreUpdateQueuesCommands(t *testing.T) {
+	store, mock := newMockPostgresStore(t)
+	state := testState()
+
+	command := outbox.Message{
+		Topic: "inventory.commands",
+		Key:   []byte(state.SagaID.String()),
+		Event: models.Event{Event: models.EventReserveInventory, SagaID: state.SagaID},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE sagas SET status`).
+		WithArgs(SagaStatusInProgress, int64(4), sqlmock.AnyArg(), state.UpdatedAt, state.SagaID, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).
+		WithArgs("inventory.commands", []byte(state.SagaID.String()), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := store.UpdateWithCommands(context.Background(), state, command); err != nil {
+		t.Fatalf("UpdateWithCommands() failed: %v", err)
+	}
+
+	if state.Version != 4 {
+		t.Errorf("Expected version 4, got %d", state.Version)
+	}
+}
+
+func TestPostgresStoreUpdateConflictQueuesNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		want   error
+	}{
+		{name: "stale version", exists: true, want: ErrVersionConflict},
+		{name: "unknown saga", exists: false, want: ErrSagaNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock := newMockPostgresStore(t)
+			state := testState()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE sagas SET status`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT EXISTS`).
+				WithArgs(state.SagaID).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.exists))
+			mock.ExpectRollback()
+
+			err := store.UpdateWithCommands(context.Background(), state, outbox.Message{Topic: "inventory.commands"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+
+			if state.Version != 3 {
+				t.Errorf("Expected version to stay 3, got %d", state.Version)
+			}
+		})
+	}
+}
+
+func TestPostgresStoreCreateExisting(t *testing.T) {
+	store, mock := newMockPostgresStore(t)
+	state := testState()
+
+	mock.ExpectExec(`INSERT INTO sagas`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.Create(context.Background(), state); !errors.Is(err, ErrSagaExists) {
+		t.Fatalf("Expected ErrSagaExists, got %v", err)
+	}
+}
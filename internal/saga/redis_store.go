@@ -0,0 +1,167 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sagaKeyPrefix   = "saga:"
+	statusKeyPrefix = "saga:status:"
+)
+
+// Each saga is a hash with its JSON state, status and version. Per-status sets index the
+// saga IDs for ListByStatus. Both scripts run atomically, so the version check and the write
+// cannot interleave with another replica
+var (
+	createScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'version', ARGV[1], 'status', ARGV[2], 'data', ARGV[3])
+redis.call('SADD', KEYS[2], ARGV[4])
+return 1
+`)
+
+	updateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'version')
+if not current then
+	return -1
+end
+if tonumber(current) ~= tonumber(ARGV[1]) then
+	return 0
+end
+local previous = redis.call('HGET', KEYS[1], 'status')
+redis.call('HSET', KEYS[1], 'version', ARGV[2], 'status', ARGV[3], 'data', ARGV[4])
+if previous ~= ARGV[3] then
+	redis.call('SREM', ARGV[5] .. previous, ARGV[6])
+	redis.call('SADD', ARGV[5] .. ARGV[3], ARGV[6])
+end
+return 1
+`)
+)
+
+// RedisStore is a SagaStore backed by Redis, using Lua compare-and-set on the saga version
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func sagaKey(sagaID uuid.UUID) string {
+	return sagaKeyPrefix + sagaID.String()
+}
+
+func statusKey(status SagaStatus) string {
+	return statusKeyPrefix + string(status)
+}
+
+func (r *RedisStore) Get(ctx context.Context, sagaID uuid.UUID) (*SagaState, error) {
+	data, err := r.client.HGet(ctx, sagaKey(sagaID), "data").Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saga %s: %w", sagaID, err)
+	}
+
+	var state SagaState
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode saga %s: %w", sagaID, err)
+	}
+
+	return &state, nil
+}
+
+func (r *RedisStore) Create(ctx context.Context, state *SagaState) error {
+	created := *state
+	created.Version = 1
+
+	data, err := sonic.Marshal(created)
+	if err != nil {
+		return err
+	}
+
+	res, err := createScript.Run(ctx, r.client,
+		[]string{sagaKey(state.SagaID), statusKey(state.Status)},
+		created.Version, string(state.Status), data, state.SagaID.String(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to create saga %s: %w", state.SagaID, err)
+	}
+
+	if res == 0 {
+		return ErrSagaExists
+	}
+
+	state.Version = created.Version
+
+	return nil
+}
+
+func (r *RedisStore) Update(ctx context.Context, state *SagaState) error {
+	updated := *state
+	updated.Version = state.Version + 1
+
+	data, err := sonic.Marshal(updated)
+	if err != nil {
+		return err
+	}
+
+	res, err := updateScript.Run(ctx, r.client,
+		[]string{sagaKey(state.SagaID)},
+		state.Version, updated.Version, string(state.Status), data, statusKeyPrefix, state.SagaID.String(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update saga %s: %w", state.SagaID, err)
+	}
+
+	switch res {
+	case -1:
+		return ErrSagaNotFound
+	case 0:
+		return ErrVersionConflict
+	}
+
+	state.Version = updated.Version
+
+	return nil
+}
+
+func (r *RedisStore) ListByStatus(ctx context.Context, status SagaStatus) ([]*SagaState, error) {
+	ids, err := r.client.SMembers(ctx, statusKey(status)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s sagas: %w", status, err)
+	}
+
+	result := make([]*SagaState, 0, len(ids))
+
+	for _, id := range ids {
+		sagaID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid saga id %q in %s index: %w", id, status, err)
+		}
+
+		state, err := r.Get(ctx, sagaID)
+		if errors.Is(err, ErrSagaNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The index and the hash are written together, but skip anything that moved since SMEMBERS
+		if state.Status == status {
+			result = append(result, state)
+		}
+	}
+
+	return result, nil
+}
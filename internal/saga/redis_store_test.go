@@ -0,0 +1,82 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// assertIndexed fails unless sagaID is indexed under status and no other of statuses
+func assertIndexed(t *testing.T, server *miniredis.Miniredis, sagaID uuid.UUID, status SagaStatus, statuses ...SagaStatus) {
+	t.Helper()
+
+	for _, other := range append(statuses, status) {
+		members, _ := server.SMembers(statusKey(other))
+
+		if slices.Contains(members, sagaID.String()) != (other == status) {
+			t.Errorf("Expected saga %s indexed under %s only, %s index holds %v", sagaID, status, other, members)
+		}
+	}
+}
+
+func TestRedisStoreCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisStore(t)
+
+	state := &SagaState{SagaID: uuid.New(), OrderID: uuid.New(), Status: SagaStatusStarted, CurrentStep: StepReserveInventory}
+
+	if err := store.Create(ctx, state); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	if version := server.HGet(sagaKey(state.SagaID), "version"); version != "1" {
+		t.Errorf("Expected version 1 stored on create, got %q", version)
+	}
+	assertIndexed(t, server, state.SagaID, SagaStatusStarted, SagaStatusInProgress)
+
+	stale := *state
+
+	state.Status = SagaStatusInProgress
+	if err := store.Update(ctx, state); err != nil {
+		t.Fatalf("Update() at the current version failed: %v", err)
+	}
+
+	if version := server.HGet(sagaKey(state.SagaID), "version"); version != "2" {
+		t.Errorf("Expected version 2 stored on update, got %q", version)
+	}
+	assertIndexed(t, server, state.SagaID, SagaStatusInProgress, SagaStatusStarted)
+
+	// The stale copy still carries version 1, so neither the hash nor the index may change
+	stale.Status = SagaStatusFailed
+	if err := store.Update(ctx, &stale); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict for a stale version, got %v", err)
+	}
+
+	if status := server.HGet(sagaKey(state.SagaID), "status"); status != string(SagaStatusInProgress) {
+		t.Errorf("Expected the stale update to leave status IN_PROGRESS, got %q", status)
+	}
+	assertIndexed(t, server, state.SagaID, SagaStatusInProgress, SagaStatusStarted, SagaStatusFailed)
+}
+
+func TestRedisStoreListsExpiredSagas(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, &fakePublisher{}, newFakeOrders())
+
+	stuck, _ := startOrderSaga(t, o)
+	fresh, _ := startOrderSaga(t, o)
+	ageSaga(t, store, stuck, time.Minute, 1)
+
+	expired, err := o.Expired(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("Expired() failed: %v", err)
+	}
+
+	if len(expired) != 1 || expired[0].SagaID != stuck {
+		t.Errorf("Expected only saga %s expired, not %s, got %v", stuck, fresh, expired)
+	}
+}
@@ -1,55 +1,381 @@
 package saga
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
 )
 
 type SagaState struct {
-	SagaID      uuid.UUID              `json:"saga_id"`
-	OrderID     uuid.UUID              `json:"order_id"`
-	Status      SagaStatus             `json:"status"`
-	CurrentStep SagaStep               `json:"current_step"`
-	Payload     sonic.NoCopyRawMessage `json:"payload"`
-	StartedAt   time.Time              `json:"started_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
+	SagaID        uuid.UUID              `json:"saga_id"`
+	OrderID       uuid.UUID              `json:"order_id"`
+	Status        SagaStatus             `json:"status"`
+	CurrentStep   SagaStep               `json:"current_step"`
+	Payload       sonic.NoCopyRawMessage `json:"payload"`
+	Attempts      int                    `json:"attempts"`
+	FailureReason string                 `json:"failure_reason,omitempty"`
+	Version       int64                  `json:"version"`
+	StartedAt     time.Time              `json:"started_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
 }
 
+// IsActive reports whether the saga is waiting on a step reply
+func (s *SagaState) IsActive() bool {
+	switch s.Status {
+	case SagaStatusStarted, SagaStatusInProgress, SagaStatusCompensating:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTerminal reports whether the saga has reached a final status and must not move anymore
+func (s *SagaState) IsTerminal() bool {
+	switch s.Status {
+	case SagaStatusCompleted, SagaStatusCompensated, SagaStatusFailed, SagaStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrderSagaData is the order context carried in SagaState.Payload across the workflow steps
+type OrderSagaData struct {
+	PublicID   string                 `json:"public_id,omitempty"`
+	CustomerID string                 `json:"customer_id"`
+	Items      []models.InventoryItem `json:"items"`
+	Amount     models.Money           `json:"amount"`
+	// FXRate is the rate the amount was converted with when the order was placed
+	FXRate    *models.ExchangeRate `json:"fx_rate,omitempty"`
+	PaymentID string               `json:"payment_id,omitempty"`
+	Refunded  bool                 `json:"refunded,omitempty"`
+	// CancelReason is set once the customer cancelled the order. The saga then stops moving
+	// forward and ends CANCELLED instead of COMPENSATED
+	CancelReason string `json:"cancel_reason,omitempty"`
+}
+
+// OrderData decodes the order context from the saga payload
+func (s *SagaState) OrderData() (OrderSagaData, error) {
+	var data OrderSagaData
+
+	if err := sonic.Unmarshal(s.Payload, &data); err != nil {
+		return data, fmt.Errorf("failed to decode payload of saga %s: %w", s.SagaID, err)
+	}
+
+	return data, nil
+}
+
+// SetOrderData replaces the saga payload with data
+func (s *SagaState) SetOrderData(data OrderSagaData) error {
+	payload, err := sonic.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.Payload = payload
+
+	return nil
+}
+
+// SagaWorkflow lists the forward steps in order. A step's CompensationStep undoes the step
+// before it, and is looked up in Compensations when that step (or a later one) fails.
+// OnComplete and OnCompensated commands are sent when the saga completes or has been rolled
+// back, and their replies are not awaited
 type SagaWorkflow struct {
-	Steps []StepDefinition
+	Steps         []StepDefinition
+	Compensations map[SagaStep]StepDefinition
+	OnComplete    []StepDefinition
+	OnCompensated []StepDefinition
 }
 
 type StepDefinition struct {
 	Step             SagaStep
 	CommandTopic     string
 	ReplyTopic       string
+	CommandEvent     models.EventType
+	SuccessEvent     models.EventType
+	FailureEvent     models.EventType
 	CompensationStep *SagaStep
+	// Timeout is how long the step waits for its reply before the command is sent again
+	Timeout time.Duration
+	// MaxAttempts is how many times the command is sent before the step is given up
+	MaxAttempts int
+	// Pivot marks a step whose success cannot be undone, e.g. capturing a payment. Once its
+	// command is out the saga can no longer be cancelled
+	Pivot bool
+}
+
+const (
+	DefaultStepTimeout     = 30 * time.Second
+	DefaultStepMaxAttempts = 3
+)
+
+// StepTimeout returns the step timeout, falling back to DefaultStepTimeout
+func (d StepDefinition) StepTimeout() time.Duration {
+	if d.Timeout <= 0 {
+		return DefaultStepTimeout
+	}
+
+	return d.Timeout
+}
+
+// StepMaxAttempts returns the step attempt limit, falling back to DefaultStepMaxAttempts
+func (d StepDefinition) StepMaxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return DefaultStepMaxAttempts
+	}
+
+	return d.MaxAttempts
+}
+
+// StepIndex returns the position of step in the workflow, or -1 if it is not part of it
+func (w *SagaWorkflow) StepIndex(step SagaStep) int {
+	for i, def := range w.Steps {
+		if def.Step == step {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Definition returns the forward or compensation step definition for step
+func (w *SagaWorkflow) Definition(step SagaStep) (StepDefinition, bool) {
+	if i := w.StepIndex(step); i >= 0 {
+		return w.Steps[i], true
+	}
+
+	def, ok := w.Compensations[step]
+
+	return def, ok
+}
+
+// IsCompensation reports whether step is one of the workflow's compensation steps
+func (w *SagaWorkflow) IsCompensation(step SagaStep) bool {
+	_, ok := w.Compensations[step]
+	return ok
+}
+
+// PastPivot reports whether step is a pivot or comes after one, see StepDefinition.Pivot
+func (w *SagaWorkflow) PastPivot(step SagaStep) bool {
+	for i := w.StepIndex(step); i >= 0; i-- {
+		if w.Steps[i].Pivot {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextCompensation walks the steps backwards starting at index from and returns the first
+// compensation to run, or false once there is nothing left to undo
+func (w *SagaWorkflow) NextCompensation(from int) (StepDefinition, bool) {
+	for i := min(from, len(w.Steps)-1); i >= 0; i-- {
+		comp := w.Steps[i].CompensationStep
+		if comp == nil {
+			continue
+		}
+
+		if def, ok := w.Compensations[*comp]; ok {
+			return def, true
+		}
+	}
+
+	return StepDefinition{}, false
+}
+
+// compensatedIndex returns the index of the forward step that declares step as its compensation
+func (w *SagaWorkflow) compensatedIndex(step SagaStep) int {
+	for i, def := range w.Steps {
+		if def.CompensationStep != nil && *def.CompensationStep == step {
+			return i
+		}
+	}
+
+	return -1
 }
 
+// ReplyTopics returns the distinct reply topics the workflow listens to, in step order
+func (w *SagaWorkflow) ReplyTopics() []string {
+	seen := make(map[string]bool, len(w.Steps))
+	topics := make([]string, 0, len(w.Steps))
+
+	add := func(topic string) {
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+
+	for _, def := range w.Steps {
+		add(def.ReplyTopic)
+
+		if def.CompensationStep != nil {
+			if comp, ok := w.Compensations[*def.CompensationStep]; ok {
+				add(comp.ReplyTopic)
+			}
+		}
+	}
+
+	return topics
+}
+
+// GetOrderWorkflow authorizes the payment first, reserves inventory and notifies the customer,
+// and only captures the money at the end. Compensation voids the authorization, so no money
+// ever has to be refunded
 func GetOrderWorkflow() *SagaWorkflow {
+	return &SagaWorkflow{
+		Steps: []StepDefinition{
+			{
+				Step:             StepAuthorizePayment,
+				CommandTopic:     "payment.commands",
+				ReplyTopic:       "payment.replies",
+				CommandEvent:     models.EventAuthorizePayment,
+				SuccessEvent:     models.EventPaymentAuthorized,
+				FailureEvent:     models.EventPaymentAuthorizationFailed,
+				CompensationStep: nil,
+				Timeout:          time.Minute,
+				MaxAttempts:      3,
+			},
+			{
+				Step:             StepReserveInventory,
+				CommandTopic:     "inventory.commands",
+				ReplyTopic:       "inventory.replies",
+				CommandEvent:     models.EventReserveInventory,
+				SuccessEvent:     models.EventInventoryReserved,
+				FailureEvent:     models.EventInventoryFailed,
+				CompensationStep: ptrTo(StepVoidAuthorization),
+				Timeout:          30 * time.Second,
+				MaxAttempts:      3,
+			},
+			{
+				Step:             StepSendNotification,
+				CommandTopic:     "notification.commands",
+				ReplyTopic:       "notification.replies",
+				CommandEvent:     models.EventSendNotification,
+				SuccessEvent:     models.EventNotificationSent,
+				FailureEvent:     models.EventNotificationFailed,
+				CompensationStep: ptrTo(StepCompensateInventory),
+				Timeout:          30 * time.Second,
+				MaxAttempts:      3,
+			},
+			{
+				Step:             StepCapturePayment,
+				CommandTopic:     "payment.commands",
+				ReplyTopic:       "payment.replies",
+				CommandEvent:     models.EventCapturePayment,
+				SuccessEvent:     models.EventPaymentCaptured,
+				FailureEvent:     models.EventPaymentCaptureFailed,
+				CompensationStep: nil,
+				Timeout:          time.Minute,
+				MaxAttempts:      3,
+				Pivot:            true,
+			},
+		},
+		Compensations: map[SagaStep]StepDefinition{
+			StepCompensateInventory: releaseInventoryStep(),
+			StepVoidAuthorization: {
+				Step:         StepVoidAuthorization,
+				CommandTopic: "payment.commands",
+				ReplyTopic:   "payment.replies",
+				CommandEvent: models.EventVoidAuthorization,
+				SuccessEvent: models.EventAuthorizationVoided,
+				FailureEvent: models.EventAuthorizationVoidFailed,
+				Timeout:      time.Minute,
+				MaxAttempts:  5,
+			},
+		},
+		OnComplete:    []StepDefinition{confirmInventoryStep()},
+		OnCompensated: []StepDefinition{notifyCancellationStep()},
+	}
+}
+
+// GetChargeOrderWorkflow reserves inventory and charges the payment in one go, for gateways
+// without authorize/capture support. A notification failure has to refund the charge
+func GetChargeOrderWorkflow() *SagaWorkflow {
 	return &SagaWorkflow{
 		Steps: []StepDefinition{
 			{
 				Step:             StepReserveInventory,
 				CommandTopic:     "inventory.commands",
 				ReplyTopic:       "inventory.replies",
+				CommandEvent:     models.EventReserveInventory,
+				SuccessEvent:     models.EventInventoryReserved,
+				FailureEvent:     models.EventInventoryFailed,
 				CompensationStep: nil,
+				Timeout:          30 * time.Second,
+				MaxAttempts:      3,
 			},
 			{
 				Step:             StepProcessPayment,
 				CommandTopic:     "payment.commands",
 				ReplyTopic:       "payment.replies",
+				CommandEvent:     models.EventProcessPayment,
+				SuccessEvent:     models.EventPaymentProcessed,
+				FailureEvent:     models.EventPaymentFailed,
 				CompensationStep: ptrTo(StepCompensateInventory),
+				Timeout:          time.Minute,
+				MaxAttempts:      3,
 			},
 			{
 				Step:             StepSendNotification,
 				CommandTopic:     "notification.commands",
 				ReplyTopic:       "notification.replies",
+				CommandEvent:     models.EventSendNotification,
+				SuccessEvent:     models.EventNotificationSent,
+				FailureEvent:     models.EventNotificationFailed,
 				CompensationStep: ptrTo(StepCompensatePayment),
+				Timeout:          30 * time.Second,
+				MaxAttempts:      3,
+			},
+		},
+		Compensations: map[SagaStep]StepDefinition{
+			StepCompensateInventory: releaseInventoryStep(),
+			StepCompensatePayment: {
+				Step:         StepCompensatePayment,
+				CommandTopic: "payment.commands",
+				ReplyTopic:   "payment.replies",
+				CommandEvent: models.EventRefundPayment,
+				SuccessEvent: models.EventPaymentRefunded,
+				FailureEvent: models.EventPaymentRefundFailed,
+				Timeout:      time.Minute,
+				MaxAttempts:  5,
 			},
 		},
+		OnComplete:    []StepDefinition{confirmInventoryStep()},
+		OnCompensated: []StepDefinition{notifyCancellationStep()},
+	}
+}
+
+func releaseInventoryStep() StepDefinition {
+	return StepDefinition{
+		Step:         StepCompensateInventory,
+		CommandTopic: "inventory.commands",
+		ReplyTopic:   "inventory.replies",
+		CommandEvent: models.EventReleaseInventory,
+		SuccessEvent: models.EventInventoryReleased,
+		FailureEvent: models.EventInventoryReleaseFailed,
+		Timeout:      30 * time.Second,
+		MaxAttempts:  5,
+	}
+}
+
+func confirmInventoryStep() StepDefinition {
+	return StepDefinition{
+		Step:         StepConfirmInventory,
+		CommandTopic: "inventory.commands",
+		CommandEvent: models.EventConfirmInventory,
+	}
+}
+
+func notifyCancellationStep() StepDefinition {
+	return StepDefinition{
+		Step:         StepNotifyCancellation,
+		CommandTopic: "notification.commands",
+		CommandEvent: models.EventSendNotification,
 	}
 }
 
@@ -4,16 +4,22 @@ type SagaStatus string
 type SagaStep string
 
 const (
-	SagaStatusStarted     SagaStatus = "STARTED"
-	SagaStatusCompleted   SagaStatus = "COMPLETED"
-	SagaStatusInProgress  SagaStatus = "IN_PROGRESS"
-	SagaStatusCancelled   SagaStatus = "CANCELLED"
-	SagaStatusFailed      SagaStatus = "FAILED"
-	SagaStatusCompensated SagaStatus = "COMPENSATED"
+	SagaStatusStarted      SagaStatus = "STARTED"
+	SagaStatusCompleted    SagaStatus = "COMPLETED"
+	SagaStatusInProgress   SagaStatus = "IN_PROGRESS"
+	SagaStatusCompensating SagaStatus = "COMPENSATING"
+	SagaStatusCancelled    SagaStatus = "CANCELLED"
+	SagaStatusFailed       SagaStatus = "FAILED"
+	SagaStatusCompensated  SagaStatus = "COMPENSATED"
 
 	StepReserveInventory    SagaStep = "RESERVE_INVENTORY"
 	StepProcessPayment      SagaStep = "PROCESS_PAYMENT"
 	StepSendNotification    SagaStep = "SEND_NOTIFICATION"
 	StepCompensatePayment   SagaStep = "COMPENSATE_PAYMENT"
 	StepCompensateInventory SagaStep = "COMPENSATE_INVENTORY"
+	StepConfirmInventory    SagaStep = "CONFIRM_INVENTORY"
+	StepAuthorizePayment    SagaStep = "AUTHORIZE_PAYMENT"
+	StepCapturePayment      SagaStep = "CAPTURE_PAYMENT"
+	StepVoidAuthorization   SagaStep = "VOID_AUTHORIZATION"
+	StepNotifyCancellation  SagaStep = "NOTIFY_CANCELLATION"
 )
@@ -0,0 +1,39 @@
+package saga
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/outbox"
+)
+
+var (
+	ErrSagaNotFound    = errors.New("saga not found")
+	ErrSagaExists      = errors.New("saga already exists")
+	ErrVersionConflict = errors.New("saga was modified concurrently")
+)
+
+// SagaStore persists SagaState with optimistic concurrency: Update only succeeds when the
+// stored Version still matches the one the caller read, so two orchestrator replicas
+// cannot advance the same saga at once
+type SagaStore interface {
+	// Get returns the saga with sagaID or ErrSagaNotFound
+	Get(ctx context.Context, sagaID uuid.UUID) (*SagaState, error)
+	// Create stores a new saga at version 1, failing with ErrSagaExists if the ID is taken
+	Create(ctx context.Context, state *SagaState) error
+	// Update replaces the saga if its stored version equals state.Version, then bumps
+	// state.Version. It fails with ErrVersionConflict otherwise
+	Update(ctx context.Context, state *SagaState) error
+	// ListByStatus returns every saga currently in status
+	ListByStatus(ctx context.Context, status SagaStatus) ([]*SagaState, error)
+}
+
+// OutboxStore is a SagaStore that queues commands in an outbox in the same transaction as an
+// update. The orchestrator uses it instead of publishing, so a transition and its commands are
+// never persisted one without the other
+type OutboxStore interface {
+	SagaStore
+	// UpdateWithCommands is Update that also queues commands, or does neither
+	UpdateWithCommands(ctx context.Context, state *SagaState, commands ...outbox.Message) error
+}
@@ -0,0 +1,126 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisStore returns a RedisStore on a fresh miniredis server, which is returned too so
+// tests can look at the keys the scripts wrote
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisStore(client), server
+}
+
+func TestSagaStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SagaStore{
+		"memory": func(t *testing.T) SagaStore { return NewMemoryStore() },
+		"redis": func(t *testing.T) SagaStore {
+			store, _ := newTestRedisStore(t)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testSagaStore(t, newStore(t))
+		})
+	}
+}
+
+func testSagaStore(t *testing.T, store SagaStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	state := &SagaState{
+		SagaID:      uuid.New(),
+		OrderID:     uuid.New(),
+		Status:      SagaStatusStarted,
+		CurrentStep: StepReserveInventory,
+		Payload:     []byte(`{"customer_id":"customer-1"}`),
+		StartedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if _, err := store.Get(ctx, state.SagaID); !errors.Is(err, ErrSagaNotFound) {
+		t.Fatalf("Expected ErrSagaNotFound before create, got %v", err)
+	}
+
+	if err := store.Create(ctx, state); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if state.Version != 1 {
+		t.Errorf("Expected version 1 after create, got %d", state.Version)
+	}
+
+	if err := store.Create(ctx, state); !errors.Is(err, ErrSagaExists) {
+		t.Errorf("Expected ErrSagaExists on second create, got %v", err)
+	}
+
+	// Two replicas read the same version, only the first update wins
+	first, err := store.Get(ctx, state.SagaID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	second, err := store.Get(ctx, state.SagaID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+
+	first.Status = SagaStatusInProgress
+	first.CurrentStep = StepProcessPayment
+	if err := store.Update(ctx, first); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", first.Version)
+	}
+
+	second.Status = SagaStatusFailed
+	if err := store.Update(ctx, second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict for stale update, got %v", err)
+	}
+
+	stored, err := store.Get(ctx, state.SagaID)
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if stored.Status != SagaStatusInProgress || stored.CurrentStep != StepProcessPayment || stored.Version != 2 {
+		t.Errorf("Unexpected stored saga %+v", stored)
+	}
+	if string(stored.Payload) != `{"customer_id":"customer-1"}` {
+		t.Errorf("Expected payload to round-trip, got %s", stored.Payload)
+	}
+
+	started, err := store.ListByStatus(ctx, SagaStatusStarted)
+	if err != nil {
+		t.Fatalf("ListByStatus(STARTED) failed: %v", err)
+	}
+	if len(started) != 0 {
+		t.Errorf("Expected no STARTED sagas, got %d", len(started))
+	}
+
+	inProgress, err := store.ListByStatus(ctx, SagaStatusInProgress)
+	if err != nil {
+		t.Fatalf("ListByStatus(IN_PROGRESS) failed: %v", err)
+	}
+	if len(inProgress) != 1 || inProgress[0].SagaID != state.SagaID {
+		t.Errorf("Expected saga %s IN_PROGRESS, got %v", state.SagaID, inProgress)
+	}
+
+	missing := &SagaState{SagaID: uuid.New(), Status: SagaStatusStarted}
+	if err := store.Update(ctx, missing); !errors.Is(err, ErrSagaNotFound) {
+		t.Errorf("Expected ErrSagaNotFound updating unknown saga, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// activeStatuses are the statuses in which a saga waits on a step reply and can time out
+var activeStatuses = []SagaStatus{SagaStatusStarted, SagaStatusInProgress, SagaStatusCompensating}
+
+// Deadline returns when the current step of state times out, counted from its last update
+func (o *Orchestrator) Deadline(state *SagaState) (time.Time, bool) {
+	def, ok := o.workflow.Definition(state.CurrentStep)
+	if !ok || !state.IsActive() {
+		return time.Time{}, false
+	}
+
+	return state.UpdatedAt.Add(def.StepTimeout()), true
+}
+
+// Expired returns the active sagas whose current step has been waiting past its timeout at now
+func (o *Orchestrator) Expired(ctx context.Context, now time.Time) ([]*SagaState, error) {
+	var expired []*SagaState
+
+	for _, status := range activeStatuses {
+		sagas, err := o.store.ListByStatus(ctx, status)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, state := range sagas {
+			if deadline, ok := o.Deadline(state); ok && now.After(deadline) {
+				expired = append(expired, state)
+			}
+		}
+	}
+
+	return expired, nil
+}
+
+// HandleTimeout sends the current step's command again while attempts are left. After that a
+// forward step is given up and compensated, and a compensation step leaves the saga FAILED.
+// Steps past the pivot are never given up, since undoing them could void a payment that was
+// already captured. Their commands are idempotent, so they are sent again until a reply arrives
+func (o *Orchestrator) HandleTimeout(ctx context.Context, state *SagaState) error {
+	def, ok := o.workflow.Definition(state.CurrentStep)
+	if !ok {
+		return fmt.Errorf("saga %s is at unknown step %s", state.SagaID, state.CurrentStep)
+	}
+
+	state.UpdatedAt = time.Now().UTC()
+
+	pastPivot := o.workflow.PastPivot(def.Step)
+
+	if state.Attempts < def.StepMaxAttempts() || pastPivot {
+		state.Attempts++
+
+		if state.Status == SagaStatusStarted {
+			state.Status = SagaStatusInProgress
+		}
+
+		if state.Attempts > def.StepMaxAttempts() {
+			log.Printf("Saga %s timed out at %s past its pivot, retrying until it replies (attempt %d)", state.SagaID, def.Step, state.Attempts)
+		} else {
+			log.Printf("Saga %s timed out at %s, retrying (attempt %d/%d)", state.SagaID, def.Step, state.Attempts, def.StepMaxAttempts())
+		}
+
+		return o.transition(ctx, state, false, def)
+	}
+
+	reason := fmt.Sprintf("%s timed out after %d attempts", def.Step, state.Attempts)
+
+	if o.workflow.IsCompensation(def.Step) {
+		state.Status = SagaStatusFailed
+		state.FailureReason = fmt.Sprintf("%s; %s", state.FailureReason, reason)
+
+		if err := o.moveOrder(ctx, state, models.OrderFailed, state.FailureReason); err != nil {
+			return err
+		}
+
+		if err := o.store.Update(ctx, state); err != nil {
+			return err
+		}
+
+		log.Printf("Saga %s compensation %s timed out, manual intervention required", state.SagaID, def.Step)
+
+		return nil
+	}
+
+	log.Printf("Saga %s giving up: %s", state.SagaID, reason)
+
+	return o.compensate(ctx, state, o.workflow.StepIndex(def.Step), reason)
+}
+
+// Sweeper periodically looks for sagas stuck on a step and hands them to the orchestrator
+type Sweeper struct {
+	orchestrator *Orchestrator
+	interval     time.Duration
+	now          func() time.Time
+}
+
+func NewSweeper(orchestrator *Orchestrator, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		orchestrator: orchestrator,
+		interval:     interval,
+		now:          time.Now,
+	}
+}
+
+// Run sweeps every interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("Saga sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Sweep handles every expired saga once and returns how many were handled. A saga that
+// moved in the meantime is skipped, its fresh state is looked at on the next sweep
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	expired, err := s.orchestrator.Expired(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+
+	for _, state := range expired {
+		err := s.orchestrator.HandleTimeout(ctx, state)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to handle timeout of saga %s: %v", state.SagaID, err)
+			continue
+		}
+
+		handled++
+	}
+
+	return handled, nil
+}
@@ -0,0 +1,165 @@
+package saga
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/mateusmlo/altimit-ecomm/internal/models"
+)
+
+// ageSaga moves the saga's last update into the past and sets its attempt count
+func ageSaga(t *testing.T, store SagaStore, sagaID uuid.UUID, age time.Duration, attempts int) {
+	t.Helper()
+
+	state := mustGet(t, store, sagaID)
+	state.UpdatedAt = time.Now().UTC().Add(-age)
+	state.Attempts = attempts
+
+	if err := store.Update(context.Background(), state); err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+}
+
+func TestSweeperRetriesTimedOutStep(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+	sweeper := NewSweeper(o, time.Second)
+
+	sagaID, _ := startOrderSaga(t, o)
+
+	handled, err := sweeper.Sweep(context.Background())
+	if err != nil || handled != 0 {
+		t.Fatalf("Expected nothing to sweep for a fresh saga, got %d (%v)", handled, err)
+	}
+
+	ageSaga(t, store, sagaID, time.Minute, 1)
+
+	handled, err = sweeper.Sweep(context.Background())
+	if err != nil || handled != 1 {
+		t.Fatalf("Expected one swept saga, got %d (%v)", handled, err)
+	}
+
+	if len(publisher.events) != 2 || publisher.last(t).event.Event != models.EventReserveInventory {
+		t.Fatalf("Expected RESERVE_INVENTORY to be sent again, got %d events", len(publisher.events))
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Attempts != 2 || state.Status != SagaStatusInProgress {
+		t.Errorf("Expected attempt 2 IN_PROGRESS, got attempt %d %s", state.Attempts, state.Status)
+	}
+}
+
+func TestSweeperCompensatesExhaustedStep(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+	sweeper := NewSweeper(o, time.Second)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+
+	ageSaga(t, store, sagaID, 2*time.Minute, 3)
+
+	if _, err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() failed: %v", err)
+	}
+
+	if sent := publisher.last(t); sent.event.Event != models.EventReleaseInventory {
+		t.Fatalf("Expected RELEASE_INVENTORY after payment timed out, got %s", sent.event.Event)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusCompensating || state.CurrentStep != StepCompensateInventory || state.Attempts != 1 {
+		t.Errorf("Expected COMPENSATING at COMPENSATE_INVENTORY attempt 1, got %s at %s attempt %d", state.Status, state.CurrentStep, state.Attempts)
+	}
+	if state.FailureReason == "" {
+		t.Errorf("Expected the timeout to be recorded as failure reason")
+	}
+}
+
+func TestSweeperKeepsRetryingCapture(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetOrderWorkflow(), store, publisher, newFakeOrders())
+	sweeper := NewSweeper(o, time.Second)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventPaymentAuthorized, sagaID, orderID, models.PaymentReply{Success: true, PaymentID: "auth-1"})
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventNotificationSent, sagaID, orderID, models.NotificationReply{Success: true})
+
+	ageSaga(t, store, sagaID, 2*time.Minute, 3)
+
+	if _, err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() failed: %v", err)
+	}
+
+	// The capture may have gone through, so it is sent again instead of voiding the authorization
+	if sent := publisher.last(t); sent.event.Event != models.EventCapturePayment {
+		t.Fatalf("Expected CAPTURE_PAYMENT to be sent again, got %s", sent.event.Event)
+	}
+
+	state := mustGet(t, store, sagaID)
+	if state.Status != SagaStatusInProgress || state.CurrentStep != StepCapturePayment || state.Attempts != 4 {
+		t.Errorf("Expected IN_PROGRESS at CAPTURE_PAYMENT attempt 4, got %s at %s attempt %d", state.Status, state.CurrentStep, state.Attempts)
+	}
+}
+
+func TestSweeperFailsExhaustedCompensation(t *testing.T) {
+	publisher := &fakePublisher{}
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, publisher, newFakeOrders())
+	sweeper := NewSweeper(o, time.Second)
+
+	sagaID, orderID := startOrderSaga(t, o)
+	reply(t, o, models.EventInventoryReserved, sagaID, orderID, models.InventoryReply{Success: true})
+	reply(t, o, models.EventPaymentFailed, sagaID, orderID, models.PaymentReply{Message: "card declined"})
+
+	ageSaga(t, store, sagaID, time.Hour, 5)
+
+	if _, err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatalf("Sweep() failed: %v", err)
+	}
+
+	if state := mustGet(t, store, sagaID); state.Status != SagaStatusFailed {
+		t.Errorf("Expected saga FAILED after compensation timed out, got %s", state.Status)
+	}
+}
+
+func TestQueryHandlerListsExpiredSagas(t *testing.T) {
+	store := NewMemoryStore()
+	o := NewOrchestrator(GetChargeOrderWorkflow(), store, &fakePublisher{}, newFakeOrders())
+
+	expiredID, _ := startOrderSaga(t, o)
+	startOrderSaga(t, o)
+
+	ageSaga(t, store, expiredID, time.Minute, 1)
+
+	rec := httptest.NewRecorder()
+	NewQueryHandler(o).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sagas/expired", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body []struct {
+		SagaID   uuid.UUID `json:"saga_id"`
+		Deadline time.Time `json:"deadline"`
+	}
+	if err := sonic.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", rec.Body.String(), err)
+	}
+
+	if len(body) != 1 || body[0].SagaID != expiredID {
+		t.Fatalf("Expected only saga %s to be expired, got %s", expiredID, rec.Body.String())
+	}
+	if body[0].Deadline.IsZero() {
+		t.Errorf("Expected the missed deadline in the response")
+	}
+}